@@ -0,0 +1,685 @@
+package xmldom
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// C14NMethod selects a canonicalization algorithm.
+type C14NMethod uint
+
+const (
+	// C14N10 is Canonical XML 1.0.
+	C14N10 C14NMethod = iota
+	// C14N11 is Canonical XML 1.1. It differs from 1.0 in document subsets,
+	// where xml:id is not inherited from the omitted ancestors of an element
+	// and xml:base is resolved against theirs.
+	C14N11
+	// ExclusiveC14N is Exclusive XML Canonicalization 1.0. Elements only
+	// declare the namespaces they visibly use and do not inherit the xml
+	// attributes of omitted ancestors, so that a subset canonicalizes the
+	// same whatever the document it is found in.
+	ExclusiveC14N
+)
+
+// Identifiers of the canonicalization algorithms in XML signatures.
+const (
+	C14N10Algorithm                    = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	C14N10WithCommentsAlgorithm        = C14N10Algorithm + "#WithComments"
+	C14N11Algorithm                    = "http://www.w3.org/2006/12/xml-c14n11"
+	C14N11WithCommentsAlgorithm        = C14N11Algorithm + "#WithComments"
+	ExclusiveC14NAlgorithm             = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	ExclusiveC14NWithCommentsAlgorithm = ExclusiveC14NAlgorithm + "WithComments"
+)
+
+// Canonicalizer writes nodes in canonical XML form, the serialization of their
+// content that does not depend on the syntax of the source, as needed to hash
+// or sign documents. Unlike the Serializer, it ignores Raw.
+//
+// The document type declaration is not written, but the attributes it
+// declares with a default value are added and the values of the ones it
+// declares with another type than CDATA are normalized. Entity references are
+// replaced by their children, so documents using entities other than the
+// predefined ones should be parsed with EntityExpand or EntityKeep. The
+// namespaces of the elements and attributes created with the namespace aware
+// factories are declared if needed.
+type Canonicalizer struct {
+	Method       C14NMethod
+	WithComments bool
+	// InclusiveNamespaces lists the prefixes whose declarations
+	// ExclusiveC14N renders as the inclusive methods do, "#default"
+	// standing for the default namespace.
+	InclusiveNamespaces []string
+}
+
+// NewCanonicalizer returns a canonicalizer for an algorithm identifier of XML
+// signatures, or NotSupportedError.
+func NewCanonicalizer(algorithm string) (*Canonicalizer, Error) {
+	switch algorithm {
+	case C14N10Algorithm:
+		return &Canonicalizer{Method: C14N10}, nil
+	case C14N10WithCommentsAlgorithm:
+		return &Canonicalizer{Method: C14N10, WithComments: true}, nil
+	case C14N11Algorithm:
+		return &Canonicalizer{Method: C14N11}, nil
+	case C14N11WithCommentsAlgorithm:
+		return &Canonicalizer{Method: C14N11, WithComments: true}, nil
+	case ExclusiveC14NAlgorithm:
+		return &Canonicalizer{Method: ExclusiveC14N}, nil
+	case ExclusiveC14NWithCommentsAlgorithm:
+		return &Canonicalizer{Method: ExclusiveC14N, WithComments: true}, nil
+	}
+	return nil, err(NotSupportedError)
+}
+
+// Algorithm returns the identifier of the algorithm in XML signatures.
+func (c *Canonicalizer) Algorithm() string {
+	var res string
+	switch c.Method {
+	case C14N11:
+		res = C14N11Algorithm
+	case ExclusiveC14N:
+		res = ExclusiveC14NAlgorithm
+		if c.WithComments {
+			return res + "WithComments"
+		}
+	default:
+		res = C14N10Algorithm
+	}
+	if c.WithComments {
+		res += "#WithComments"
+	}
+	return res
+}
+
+// Canonicalize writes the canonical form of the node with its descendants.
+// For a document, it is the whole document. For an element, the namespaces
+// in scope are declared on it and, except for ExclusiveC14N, it inherits the
+// xml attributes of its ancestors, like the subset made of its subtree.
+func (c *Canonicalizer) Canonicalize(w io.Writer, n *Node) error {
+	cz := c.newCanonicalizer(w, n)
+	cz.apex = n
+	switch n.nodeType {
+	case DocumentNode:
+		cz.document(n)
+	case ElementNode:
+		cz.element(n, inScopeNamespaces(n.parentElement()), nil)
+	default:
+		cz.node(n, nil, nil)
+	}
+	return cz.flush()
+}
+
+// CanonicalizeSubset writes the canonical form of a document subset, the
+// nodes of a document selected for instance by an XPath expression, in
+// document order. The tags of the elements missing from nodes are omitted
+// but their content is written if it is in nodes. The attributes of the
+// elements must be in nodes to be written, while their namespace
+// declarations are considered included with them.
+func (c *Canonicalizer) CanonicalizeSubset(w io.Writer, nodes []*Node) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	root := nodes[0]
+	if root.nodeType == AttributeNode && root.ownerElement != nil {
+		root = root.ownerElement
+	}
+	for root.parentNode != nil {
+		root = root.parentNode
+	}
+	cz := c.newCanonicalizer(w, root)
+	cz.set = map[*Node]bool{}
+	for _, n := range nodes {
+		cz.set[n] = true
+	}
+	if root.nodeType == DocumentNode {
+		cz.document(root)
+	} else {
+		cz.node(root, nil, nil)
+	}
+	return cz.flush()
+}
+
+type canonicalizer struct {
+	*Canonicalizer
+	w         *bufio.Writer
+	err       error
+	apex      *Node          // node canonicalized with its subtree
+	set       map[*Node]bool // nodes of the document subset canonicalized
+	attlists  map[string]map[string]attributeDecl
+	inclusive map[string]bool // prefixes of InclusiveNamespaces
+}
+
+func (c *Canonicalizer) newCanonicalizer(w io.Writer, n *Node) *canonicalizer {
+	cz := &canonicalizer{Canonicalizer: c, w: bufio.NewWriter(w)}
+	doc := n.ownerDocument
+	if n.nodeType == DocumentNode {
+		doc = n
+	}
+	if doctype := doc.Doctype(); doctype != nil {
+		for _, decl := range parseMarkupDecls(doctype.decl.internalSubset) {
+			for _, ad := range decl.attributeDecls() {
+				if cz.attlists == nil {
+					cz.attlists = map[string]map[string]attributeDecl{}
+				}
+				if cz.attlists[ad.element] == nil {
+					cz.attlists[ad.element] = map[string]attributeDecl{}
+				}
+				if _, ok := cz.attlists[ad.element][ad.name]; !ok {
+					cz.attlists[ad.element][ad.name] = ad
+				}
+			}
+		}
+	}
+	if c.Method == ExclusiveC14N {
+		cz.inclusive = map[string]bool{}
+		for _, prefix := range c.InclusiveNamespaces {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			cz.inclusive[prefix] = true
+		}
+	}
+	return cz
+}
+
+func (c *canonicalizer) flush() error {
+	if c.err == nil {
+		c.err = c.w.Flush()
+	}
+	return c.err
+}
+
+func (c *canonicalizer) write(s string) {
+	if c.err == nil {
+		_, c.err = c.w.WriteString(s)
+	}
+}
+
+// included tells if a node is part of the document subset.
+func (c *canonicalizer) included(n *Node) bool {
+	return c.set == nil || c.set[n]
+}
+
+// namespaces maps prefixes to namespace URIs, the default namespace having
+// the empty prefix. It is shared by the elements until one of them changes
+// the bindings.
+type namespaces map[string]string
+
+// declare returns the namespaces in scope of an element from the ones in
+// scope of its parent.
+func (ns namespaces) declare(e *Node) namespaces {
+	res, copied := ns, false
+	bind := func(prefix, uri string) {
+		if prefix == "xml" || prefix == "xmlns" || res[prefix] == uri {
+			return
+		}
+		if !copied {
+			res, copied = namespaces{}, true
+			for p, u := range ns {
+				res[p] = u
+			}
+		}
+		if uri == "" {
+			delete(res, prefix)
+		} else {
+			res[prefix] = uri
+		}
+	}
+	for i := 0; i < e.attributes.Length(); i++ {
+		a := e.attributes.Item(i)
+		if a.nodeName == "xmlns" {
+			bind("", a.nodeValue)
+		} else if strings.HasPrefix(a.nodeName, "xmlns:") {
+			bind(a.nodeName[len("xmlns:"):], a.nodeValue)
+		}
+	}
+	if e.localName != "" {
+		bind(e.prefix, e.namespaceURI)
+	}
+	for i := 0; i < e.attributes.Length(); i++ {
+		a := e.attributes.Item(i)
+		if a.localName != "" && a.prefix != "" && a.namespaceURI != XMLNSNamespace {
+			bind(a.prefix, a.namespaceURI)
+		}
+	}
+	return res
+}
+
+func (ns namespaces) lookup(prefix string) string {
+	if prefix == "xml" {
+		return XMLNamespace
+	}
+	return ns[prefix]
+}
+
+// inScopeNamespaces returns the namespaces in scope of an element, or none if
+// it is nil.
+func inScopeNamespaces(e *Node) namespaces {
+	var ancestors []*Node
+	for ; e != nil; e = e.parentElement() {
+		ancestors = append(ancestors, e)
+	}
+	var res namespaces
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		res = res.declare(ancestors[i])
+	}
+	return res
+}
+
+// document writes the children of a document, separating the comments and
+// processing instructions outside of the document element from it by a line
+// break.
+func (c *canonicalizer) document(d *Node) {
+	after := false
+	for _, n := range d.childNodes {
+		switch n.nodeType {
+		case ElementNode:
+			c.element(n, nil, nil)
+			after = true
+		case ProcessingInstructionNode, CommentNode:
+			if !c.rendered(n) {
+				continue
+			}
+			if after {
+				c.write("\n")
+			}
+			c.node(n, nil, nil)
+			if !after {
+				c.write("\n")
+			}
+		}
+	}
+}
+
+// rendered tells if a comment or processing instruction is written.
+func (c *canonicalizer) rendered(n *Node) bool {
+	switch n.nodeType {
+	case CommentNode:
+		return c.WithComments && c.included(n)
+	case ProcessingInstructionNode:
+		return n.nodeName != "xml" && c.included(n)
+	}
+	return false
+}
+
+func (c *canonicalizer) node(n *Node, inScope, rendered namespaces) {
+	switch n.nodeType {
+	case DocumentNode:
+		c.document(n)
+	case ElementNode:
+		c.element(n, inScope, rendered)
+	case DocumentFragmentNode, EntityReferenceNode:
+		for _, child := range n.childNodes {
+			c.node(child, inScope, rendered)
+		}
+	case TextNode, CDATASectionNode:
+		if c.included(n) {
+			c.text(n.nodeValue)
+		}
+	case ProcessingInstructionNode:
+		if c.rendered(n) {
+			c.write("<?" + n.nodeName)
+			if n.nodeValue != "" {
+				c.write(" " + n.nodeValue)
+			}
+			c.write("?>")
+		}
+	case CommentNode:
+		if c.rendered(n) {
+			c.write("<!--" + n.nodeValue + "-->")
+		}
+	}
+}
+
+// element writes an element of the subset with the namespace declarations
+// that differ from the ones rendered by its output ancestors, or only its
+// content if it is not in the subset.
+func (c *canonicalizer) element(e *Node, inScope, rendered namespaces) {
+	inScope = inScope.declare(e)
+	if c.included(e) {
+		attrs := c.attributes(e, inScope)
+		var prefixes []string
+		rendered, prefixes = c.namespaceDeclarations(e, attrs, inScope, rendered)
+		c.write("<" + e.nodeName)
+		for _, prefix := range prefixes {
+			if prefix == "" {
+				c.write(" xmlns=\"")
+			} else {
+				c.write(" xmlns:" + prefix + "=\"")
+			}
+			c.attributeValue(rendered[prefix])
+			c.write("\"")
+		}
+		for _, a := range attrs {
+			c.write(" " + a.name + "=\"")
+			c.attributeValue(a.value)
+			c.write("\"")
+		}
+		c.write(">")
+	}
+	for _, child := range e.childNodes {
+		c.node(child, inScope, rendered)
+	}
+	if c.included(e) {
+		c.write("</" + e.nodeName + ">")
+	}
+}
+
+// namespaceDeclarations returns the prefixes of the namespaces to declare on
+// an element, sorted, and the namespaces rendered for its descendants.
+func (c *canonicalizer) namespaceDeclarations(e *Node, attrs []canonicalAttr, inScope, rendered namespaces) (namespaces, []string) {
+	var candidates []string
+	if c.Method == ExclusiveC14N {
+		prefix, _ := splitQName(e.nodeName)
+		candidates = append(candidates, prefix)
+		for _, a := range attrs {
+			if prefix, _ := splitQName(a.name); prefix != "" {
+				candidates = append(candidates, prefix)
+			}
+		}
+		for prefix := range c.inclusive {
+			candidates = append(candidates, prefix)
+		}
+	} else {
+		candidates = append(candidates, "")
+		for prefix := range inScope {
+			candidates = append(candidates, prefix)
+		}
+	}
+	var res []string
+	declared := map[string]bool{}
+	for _, prefix := range candidates {
+		uri := inScope[prefix]
+		if prefix == "xml" || declared[prefix] || rendered[prefix] == uri || (uri == "" && prefix != "") {
+			continue
+		}
+		declared[prefix] = true
+		res = append(res, prefix)
+	}
+	if len(res) == 0 {
+		return rendered, nil
+	}
+	sort.Strings(res)
+	next := namespaces{}
+	for prefix, uri := range rendered {
+		next[prefix] = uri
+	}
+	for _, prefix := range res {
+		next[prefix] = inScope[prefix]
+	}
+	return next, res
+}
+
+// canonicalAttr is an attribute as written, sorted by namespace URI and local
+// name.
+type canonicalAttr struct {
+	namespaceURI string
+	localName    string
+	name         string
+	value        string
+}
+
+// attributes returns the attributes of an element in the subset, with the
+// ones defaulted by the document type and the ones inherited from omitted
+// ancestors, sorted.
+func (c *canonicalizer) attributes(e *Node, inScope namespaces) []canonicalAttr {
+	var res []canonicalAttr
+	for i := 0; i < e.attributes.Length(); i++ {
+		a := e.attributes.Item(i)
+		if a.nodeName == "xmlns" || strings.HasPrefix(a.nodeName, "xmlns:") || !c.included(a) {
+			continue
+		}
+		res = append(res, newCanonicalAttr(inScope, a.nodeName, c.attributeText(e, a)))
+	}
+	res = append(res, c.defaultAttributes(e, inScope)...)
+	if c.Method != ExclusiveC14N {
+		res = c.inheritAttributes(e, res)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].namespaceURI != res[j].namespaceURI {
+			return res[i].namespaceURI < res[j].namespaceURI
+		}
+		return res[i].localName < res[j].localName
+	})
+	return res
+}
+
+func newCanonicalAttr(inScope namespaces, name, value string) canonicalAttr {
+	prefix, localName := splitQName(name)
+	var namespaceURI string
+	if prefix != "" {
+		namespaceURI = inScope.lookup(prefix)
+	}
+	return canonicalAttr{namespaceURI, localName, name, value}
+}
+
+// defaultAttributes returns the attributes with a default value in the
+// document type that the element does not have.
+func (c *canonicalizer) defaultAttributes(e *Node, inScope namespaces) []canonicalAttr {
+	var res []canonicalAttr
+	for name, ad := range c.attlists[e.nodeName] {
+		if ad.defaultDecl == "#REQUIRED" || ad.defaultDecl == "#IMPLIED" || e.attributes.GetNamedItem(name) != nil {
+			continue
+		}
+		if name == "xmlns" || strings.HasPrefix(name, "xmlns:") {
+			continue
+		}
+		value := normalizeAttributeValue(ad.defaultValue)
+		if ad.attType != "CDATA" {
+			value = collapseSpaces(value)
+		}
+		res = append(res, newCanonicalAttr(inScope, name, value))
+	}
+	return res
+}
+
+// attributeText returns the normalized value of an attribute. The value is
+// normalized again from the source text when there is one, as the decoder
+// does not replace the whitespace characters.
+func (c *canonicalizer) attributeText(e *Node, a *Node) string {
+	value := a.nodeValue
+	if len(a.Raw) >= 5 && !a.ValueDirty {
+		if start, _ := findEntityRef(a.Raw[3]); start < 0 {
+			value = normalizeAttributeValue(a.Raw[3])
+		}
+	}
+	if ad, ok := c.attlists[e.nodeName][a.nodeName]; ok && ad.attType != "CDATA" {
+		value = collapseSpaces(value)
+	}
+	return value
+}
+
+// normalizeAttributeValue returns the value of an attribute from its source
+// text, as XML 1.0 section 3.3.3 defines it for CDATA attributes.
+func normalizeAttributeValue(raw string) string {
+	raw = strings.Replace(raw, "\r\n", " ", -1)
+	raw = strings.NewReplacer("\r", " ", "\n", " ", "\t", " ").Replace(raw)
+	return unescapeText(raw)
+}
+
+// collapseSpaces trims the spaces of an attribute value and replaces the
+// sequences of spaces by one, as for the attributes that are not CDATA.
+func collapseSpaces(value string) string {
+	fields := strings.Split(value, " ")
+	res := fields[:0]
+	for _, f := range fields {
+		if f != "" {
+			res = append(res, f)
+		}
+	}
+	return strings.Join(res, " ")
+}
+
+// inheritAttributes adds to the attributes of an element the xml attributes
+// of its ancestors omitted from the subset, as the inclusive methods do. The
+// nearest ancestor wins and C14N11 resolves xml:base against the ancestors
+// instead, and does not inherit xml:id.
+func (c *canonicalizer) inheritAttributes(e *Node, attrs []canonicalAttr) []canonicalAttr {
+	var ancestors []*Node
+	if c.set != nil || e == c.apex {
+		for p := e.parentElement(); p != nil && (c.set == nil || !c.set[p]); p = p.parentElement() {
+			ancestors = append(ancestors, p)
+		}
+	}
+	if len(ancestors) == 0 {
+		return attrs
+	}
+	has := map[string]int{}
+	for i, a := range attrs {
+		has[a.name] = i
+	}
+	var bases []string
+	for _, p := range ancestors {
+		for _, a := range c.xmlAttributes(p) {
+			if a.name == "xml:base" && c.Method == C14N11 {
+				bases = append(bases, a.value)
+				continue
+			}
+			if a.name == "xml:id" && c.Method == C14N11 {
+				continue
+			}
+			if _, ok := has[a.name]; !ok {
+				has[a.name] = len(attrs)
+				attrs = append(attrs, a)
+			}
+		}
+	}
+	if len(bases) > 0 {
+		base := bases[len(bases)-1]
+		for i := len(bases) - 2; i >= 0; i-- {
+			base = joinURI(base, bases[i])
+		}
+		if i, ok := has["xml:base"]; ok {
+			attrs[i].value = joinURI(base, attrs[i].value)
+		} else if base != "" {
+			attrs = append(attrs, canonicalAttr{XMLNamespace, "base", "xml:base", base})
+		}
+	}
+	return attrs
+}
+
+// xmlAttributes returns the attributes of an element in the xml namespace,
+// including the defaulted ones.
+func (c *canonicalizer) xmlAttributes(e *Node) []canonicalAttr {
+	var res []canonicalAttr
+	for i := 0; i < e.attributes.Length(); i++ {
+		a := e.attributes.Item(i)
+		if strings.HasPrefix(a.nodeName, "xml:") {
+			res = append(res, newCanonicalAttr(nil, a.nodeName, c.attributeText(e, a)))
+		}
+	}
+	for _, a := range c.defaultAttributes(e, nil) {
+		if a.namespaceURI == XMLNamespace {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// joinURI resolves a reference against a base URI that may be relative, as
+// Canonical XML 1.1 does to fix up xml:base attributes.
+func joinURI(base, ref string) string {
+	b, e1 := url.Parse(base)
+	r, e2 := url.Parse(ref)
+	switch {
+	case e1 != nil || e2 != nil || r.IsAbs():
+		return ref
+	case b.IsAbs():
+		return b.ResolveReference(r).String()
+	case ref == "" || strings.HasPrefix(ref, "/"):
+		if ref == "" {
+			return base
+		}
+		return ref
+	}
+	basePath := base
+	if i := strings.IndexAny(base, "?#"); i >= 0 {
+		basePath = base[:i]
+	}
+	refPath, suffix := ref, ""
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		refPath, suffix = ref[:i], ref[i:]
+	}
+	switch {
+	case refPath == "" && strings.HasPrefix(suffix, "#"):
+		return strings.SplitN(base, "#", 2)[0] + suffix
+	case refPath == "":
+		return basePath + suffix
+	}
+	merged := basePath[:strings.LastIndexByte(basePath, '/')+1] + refPath
+	return removeDotSegments(merged) + suffix
+}
+
+// removeDotSegments removes the "." and ".." segments of a path, keeping the
+// ".." segments that go above a relative path.
+func removeDotSegments(path string) string {
+	absolute := strings.HasPrefix(path, "/")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var out []string
+	for i, s := range segments {
+		switch s {
+		case ".":
+		case "..":
+			if len(out) > 0 && out[len(out)-1] != ".." {
+				out = out[:len(out)-1]
+			} else if !absolute {
+				out = append(out, "..")
+			}
+		default:
+			out = append(out, s)
+			continue
+		}
+		if i == len(segments)-1 {
+			out = append(out, "")
+		}
+	}
+	res := strings.Join(out, "/")
+	if absolute {
+		res = "/" + res
+	}
+	return res
+}
+
+// text writes character data, escaping markup characters and carriage
+// returns.
+func (c *canonicalizer) text(data string) {
+	c.escape(data, "&<>\r")
+}
+
+// attributeValue writes an attribute value, escaping markup characters,
+// quotes and whitespace other than spaces.
+func (c *canonicalizer) attributeValue(value string) {
+	c.escape(value, "&<\"\t\n\r")
+}
+
+func (c *canonicalizer) escape(data, special string) {
+	for {
+		i := strings.IndexAny(data, special)
+		if i < 0 {
+			c.write(data)
+			return
+		}
+		c.write(data[:i])
+		switch data[i] {
+		case '&':
+			c.write("&amp;")
+		case '<':
+			c.write("&lt;")
+		case '>':
+			c.write("&gt;")
+		case '"':
+			c.write("&quot;")
+		case '\t':
+			c.write("&#x9;")
+		case '\n':
+			c.write("&#xA;")
+		case '\r':
+			c.write("&#xD;")
+		}
+		data = data[i+1:]
+	}
+}
@@ -0,0 +1,129 @@
+package xmldom
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCanonicalizeVectors checks the canonical form of the documents in
+// testdata/c14n against the expected outputs next to them, named after the
+// method. They are the examples of the Canonical XML recommendation, with the
+// outputs of libxml2 for the methods it does not give.
+func TestCanonicalizeVectors(t *testing.T) {
+	methods := map[string]Canonicalizer{
+		".c14n":              {Method: C14N10},
+		".c14n-comments":     {Method: C14N10, WithComments: true},
+		".c14n11-comments":   {Method: C14N11, WithComments: true},
+		".exc-c14n-comments": {Method: ExclusiveC14N, WithComments: true},
+	}
+	inputs, _ := filepath.Glob("testdata/c14n/*.xml")
+	if len(inputs) == 0 {
+		t.Fatal("no test vectors")
+	}
+	for _, input := range inputs {
+		src, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := ParseXMLWithOptions(bytes.NewReader(src), &ParseOptions{Entities: EntityKeep})
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		for ext, c := range methods {
+			expected := strings.TrimSuffix(input, ".xml") + ext
+			want, err := ioutil.ReadFile(expected)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			if err := c.Canonicalize(&b, doc); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != string(want) {
+				t.Errorf("%s:\ngot  %q\nwant %q", expected, b.String(), want)
+			}
+		}
+	}
+}
+
+func TestCanonicalizeElement(t *testing.T) {
+	src := `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org" xml:lang="fr" xml:base="http://example.org/a/">
+  <n1:elem2 xmlns:n1="http://example.net" xml:base="b/">
+    <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n0:local>`
+	tests := []struct {
+		c    Canonicalizer
+		want string
+	}{
+		{Canonicalizer{Method: C14N10}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:base="b/" xml:lang="fr">
+    <n3:stuff></n3:stuff>
+  </n1:elem2>`},
+		{Canonicalizer{Method: C14N11}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:base="http://example.org/a/b/" xml:lang="fr">
+    <n3:stuff></n3:stuff>
+  </n1:elem2>`},
+		{Canonicalizer{Method: ExclusiveC14N}, `<n1:elem2 xmlns:n1="http://example.net" xml:base="b/">
+    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`},
+		{Canonicalizer{Method: ExclusiveC14N, InclusiveNamespaces: []string{"n0", "#default"}}, `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xml:base="b/">
+    <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`},
+	}
+	doc, err := ParseXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem2 := doc.DocumentElement().GetElementsByTagName("n1:elem2").Item(0)
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := test.c.Canonicalize(&b, elem2); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.c.Algorithm(), b.String(), test.want)
+		}
+	}
+}
+
+func TestCanonicalizeCreatedNodes(t *testing.T) {
+	doc, err := ParseXML(strings.NewReader(`<root xmlns="urn:a"><old  b = 'x'   a="&#9;y"/></root>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _ := doc.CreateElementNS("urn:b", "p:new")
+	e.SetAttributeNS("urn:c", "q:attr", "1\n2")
+	plain, _ := doc.CreateElementNS("", "plain")
+	e.AppendChild(plain)
+	doc.DocumentElement().AppendChild(e)
+	want := `<root xmlns="urn:a"><old a="&#x9;y" b="x"></old><p:new xmlns:p="urn:b" xmlns:q="urn:c" q:attr="1&#xA;2"><plain xmlns=""></plain></p:new></root>`
+	var b bytes.Buffer
+	if err := (&Canonicalizer{}).Canonicalize(&b, doc); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("got  %s\nwant %s", b.String(), want)
+	}
+}
+
+func TestJoinURI(t *testing.T) {
+	tests := []struct{ base, ref, want string }{
+		{"http://example.org/a/b", "c/../d", "http://example.org/a/d"},
+		{"a/b/", "../../../c", "../c"},
+		{"a/b", "c?q#f", "a/c?q#f"},
+		{"a/b?q", "#f", "a/b?q#f"},
+		{"a/", "/c", "/c"},
+		{"a/", "", "a/"},
+		{"", "./c/.", "c/"},
+	}
+	for _, test := range tests {
+		if got := joinURI(test.base, test.ref); got != test.want {
+			t.Errorf("joinURI(%q, %q) = %q, want %q", test.base, test.ref, got, test.want)
+		}
+	}
+}
@@ -1,17 +1,94 @@
 package xmldom
 
-type characterData struct {
-	characterData string
+import (
+	"unicode/utf16"
+)
+
+// Character data of text, comment and CDATA section nodes is addressed in
+// UTF-16 code units as in the DOM. An offset splitting a surrogate pair leaves
+// the halves replaced by U+FFFD.
+
+func (n *Node) isCharacterData() bool {
+	switch n.nodeType {
+	case TextNode, CDATASectionNode, CommentNode:
+		return true
+	default:
+		return false
+	}
+}
+
+func (n *Node) Data() string {
+	return n.nodeValue
+}
+
+func (n *Node) SetData(s string) {
+	n.SetNodeValue(s)
+}
+
+// Length returns the length of the data in UTF-16 code units.
+func (n *Node) Length() uint {
+	return utf16Length(n.nodeValue)
+}
+
+func utf16Length(s string) uint {
+	var length uint
+	for _, r := range s {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+func (n *Node) SubstringData(offset, count uint) (string, Error) {
+	if !n.isCharacterData() {
+		return "", err(NotSupportedError)
+	}
+	data := utf16.Encode([]rune(n.nodeValue))
+	if offset > uint(len(data)) {
+		return "", err(IndexSizeError)
+	}
+	end := uint(len(data))
+	if count < end-offset {
+		end = offset + count
+	}
+	return string(utf16.Decode(data[offset:end])), nil
+}
+
+func (n *Node) AppendData(arg string) Error {
+	return n.ReplaceData(n.Length(), 0, arg)
 }
 
-func (c *characterData) Data() string {
-	return c.characterData
+func (n *Node) InsertData(offset uint, arg string) Error {
+	return n.ReplaceData(offset, 0, arg)
 }
 
-func (c *characterData) SetData(s string) {
-	c.characterData = s
+func (n *Node) DeleteData(offset, count uint) Error {
+	return n.ReplaceData(offset, count, "")
 }
 
-func (c *characterData) Length() uint {
-	return uint(len(c.characterData))
+// ReplaceData replaces count code units from offset with arg. If there are
+// less than count code units after offset, the data is replaced up to its end.
+func (n *Node) ReplaceData(offset, count uint, arg string) Error {
+	if !n.isCharacterData() {
+		return err(NotSupportedError)
+	}
+	data := utf16.Encode([]rune(n.nodeValue))
+	if offset > uint(len(data)) {
+		return err(IndexSizeError)
+	}
+	end := uint(len(data))
+	if count < end-offset {
+		end = offset + count
+	}
+	inserted := utf16.Encode([]rune(arg))
+	res := make([]uint16, 0, len(data)-int(end-offset)+len(inserted))
+	res = append(res, data[:offset]...)
+	res = append(res, inserted...)
+	res = append(res, data[end:]...)
+	n.ownerDocument.replacingData(n, offset, end-offset, uint(len(inserted)))
+	n.setNodeValue(string(utf16.Decode(res)))
+	return nil
 }
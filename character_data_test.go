@@ -0,0 +1,76 @@
+package xmldom
+
+import "testing"
+
+func TestCharacterData(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		edit func(n *Node) Error
+		want string
+		code ErrorCode
+	}{
+		{"append", "ab", func(n *Node) Error { return n.AppendData("c") }, "abc", 0},
+		{"insert", "ac", func(n *Node) Error { return n.InsertData(1, "b") }, "abc", 0},
+		{"insert at end", "ab", func(n *Node) Error { return n.InsertData(2, "c") }, "abc", 0},
+		{"insert out of range", "ab", func(n *Node) Error { return n.InsertData(3, "c") }, "ab", IndexSizeError},
+		{"delete", "abc", func(n *Node) Error { return n.DeleteData(1, 1) }, "ac", 0},
+		{"delete past the end", "abc", func(n *Node) Error { return n.DeleteData(1, 10) }, "a", 0},
+		{"replace", "abc", func(n *Node) Error { return n.ReplaceData(1, 1, "xyz") }, "axyzc", 0},
+		{"replace out of range", "abc", func(n *Node) Error { return n.ReplaceData(4, 0, "x") }, "abc", IndexSizeError},
+		{"after a supplementary character", "𝄞ab", func(n *Node) Error { return n.DeleteData(2, 1) }, "𝄞b", 0},
+		{"supplementary character", "a𝄞b", func(n *Node) Error { return n.DeleteData(1, 2) }, "ab", 0},
+		{"inside a surrogate pair", "a𝄞b", func(n *Node) Error { return n.InsertData(2, "x") }, "a�x�b", 0},
+		{"multibyte", "éàü", func(n *Node) Error { return n.ReplaceData(1, 1, "ö") }, "éöü", 0},
+		{"set data", "abc", func(n *Node) Error { n.SetData("é𝄞"); return nil }, "é𝄞", 0},
+	}
+	for _, test := range tests {
+		doc := NewDocument()
+		for _, n := range []*Node{doc.CreateTextNode(test.data), doc.CreateComment(test.data)} {
+			e := test.edit(n)
+			if (test.code == 0 && e != nil) || (test.code != 0 && (e == nil || e.Code() != test.code)) {
+				t.Errorf("%s: %v, want code %d", test.name, e, test.code)
+			}
+			if n.Data() != test.want {
+				t.Errorf("%s: data %q, want %q", test.name, n.Data(), test.want)
+			}
+		}
+	}
+}
+
+func TestSubstringData(t *testing.T) {
+	tests := []struct {
+		data          string
+		offset, count uint
+		want          string
+		length        uint
+		code          ErrorCode
+	}{
+		{"abc", 1, 1, "b", 3, 0},
+		{"abc", 1, 10, "bc", 3, 0},
+		{"abc", 3, 1, "", 3, 0},
+		{"abc", 4, 1, "", 3, IndexSizeError},
+		{"é𝄞b", 1, 2, "𝄞", 4, 0},
+		{"é𝄞b", 3, 1, "b", 4, 0},
+		{"é𝄞b", 1, 1, "�", 4, 0},
+		{"", 0, 1, "", 0, 0},
+	}
+	doc := NewDocument()
+	for _, test := range tests {
+		n := doc.CreateTextNode(test.data)
+		s, e := n.SubstringData(test.offset, test.count)
+		if s != test.want || (test.code == 0 && e != nil) || (test.code != 0 && (e == nil || e.Code() != test.code)) {
+			t.Errorf("SubstringData(%q, %d, %d) = %q, %v, want %q", test.data, test.offset, test.count, s, e, test.want)
+		}
+		if n.Length() != test.length {
+			t.Errorf("Length(%q) = %d, want %d", test.data, n.Length(), test.length)
+		}
+	}
+	e, _ := doc.CreateElement("e")
+	if _, err := e.SubstringData(0, 1); err == nil || err.Code() != NotSupportedError {
+		t.Errorf("SubstringData of an element: %v", err)
+	}
+	if err := e.AppendData("x"); err == nil || err.Code() != NotSupportedError {
+		t.Errorf("AppendData to an element: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package xmldom
+
+import (
+	"reflect"
+)
+
+// DocumentPosition is the bitmask returned by CompareDocumentPosition, as in
+// DOM Level 3 Core. The bits describe the other node relative to the node
+// the method is called on.
+type DocumentPosition uint16
+
+const (
+	DocumentPositionDisconnected           DocumentPosition = 0x01
+	DocumentPositionPreceding              DocumentPosition = 0x02
+	DocumentPositionFollowing              DocumentPosition = 0x04
+	DocumentPositionContains               DocumentPosition = 0x08
+	DocumentPositionContainedBy            DocumentPosition = 0x10
+	DocumentPositionImplementationSpecific DocumentPosition = 0x20
+)
+
+// CompareDocumentPosition returns the position of other relative to the node
+// in document order. Attributes follow their element and precede its
+// children, in the order of the attribute list. Nodes in different trees are
+// disconnected, ordered consistently by their roots. It returns 0 if other is
+// the node itself.
+func (n *Node) CompareDocumentPosition(other *Node) DocumentPosition {
+	if n == other {
+		return 0
+	}
+	node1, node2 := other, n
+	var attr1, attr2 *Node
+	if node1.nodeType == AttributeNode {
+		attr1, node1 = node1, node1.ownerElement
+	}
+	if node2.nodeType == AttributeNode {
+		attr2, node2 = node2, node2.ownerElement
+		if attr1 != nil && node1 != nil && node1 == node2 {
+			for i := 0; i < node2.attributes.Length(); i++ {
+				switch node2.attributes.Item(i) {
+				case attr1:
+					return DocumentPositionImplementationSpecific | DocumentPositionPreceding
+				case attr2:
+					return DocumentPositionImplementationSpecific | DocumentPositionFollowing
+				}
+			}
+		}
+	}
+	if node1 == nil || node2 == nil || rootOf(node1) != rootOf(node2) {
+		root1, root2 := other, n
+		if node1 != nil {
+			root1 = rootOf(node1)
+		}
+		if node2 != nil {
+			root2 = rootOf(node2)
+		}
+		order := DocumentPositionFollowing
+		if reflect.ValueOf(root1).Pointer() < reflect.ValueOf(root2).Pointer() {
+			order = DocumentPositionPreceding
+		}
+		return DocumentPositionDisconnected | DocumentPositionImplementationSpecific | order
+	}
+	switch {
+	case (attr1 == nil && node2.IsAncestor(node1)) || (node1 == node2 && attr2 != nil):
+		return DocumentPositionContains | DocumentPositionPreceding
+	case (attr2 == nil && node1.IsAncestor(node2)) || (node1 == node2 && attr1 != nil):
+		return DocumentPositionContainedBy | DocumentPositionFollowing
+	case treeOrder(node1, node2) < 0:
+		return DocumentPositionPreceding
+	}
+	return DocumentPositionFollowing
+}
+
+// Contains tells if other is the node or one of its descendants.
+func (n *Node) Contains(other *Node) bool {
+	return other != nil && isInclusiveAncestor(n, other)
+}
+
+// IsSameNode tells if other is the node itself.
+func (n *Node) IsSameNode(other *Node) bool {
+	return n == other
+}
+
+// IsEqualNode tells if the nodes have the same type, names, namespace and
+// value, equal attributes in any order, and equal children in the same
+// order. Document types compare their identifiers and internal subset too.
+// The source text of the nodes is ignored, see IsEqualNodeStrict.
+func (n *Node) IsEqualNode(other *Node) bool {
+	if other == nil {
+		return false
+	}
+	if n == other {
+		return true
+	}
+	if n.nodeType != other.nodeType || n.nodeName != other.nodeName || n.localName != other.localName ||
+		n.namespaceURI != other.namespaceURI || n.prefix != other.prefix || n.nodeValue != other.nodeValue {
+		return false
+	}
+	if n.nodeType == DocumentTypeNode && (n.PublicId() != other.PublicId() ||
+		n.SystemId() != other.SystemId() || n.InternalSubset() != other.InternalSubset()) {
+		return false
+	}
+	if (n.attributes == nil) != (other.attributes == nil) {
+		return false
+	}
+	if n.attributes != nil {
+		if n.attributes.Length() != other.attributes.Length() {
+			return false
+		}
+		for i := 0; i < n.attributes.Length(); i++ {
+			a := n.attributes.Item(i)
+			found := false
+			for j := 0; j < other.attributes.Length() && !found; j++ {
+				found = a.IsEqualNode(other.attributes.Item(j))
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	if len(n.childNodes) != len(other.childNodes) {
+		return false
+	}
+	for i, c := range n.childNodes {
+		if !c.IsEqualNode(other.childNodes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEqualNodeStrict tells if the nodes are equal and serialize to the same
+// text, including the formatting kept from their source: whitespace inside
+// tags, quotes, character references and the order of attributes.
+func (n *Node) IsEqualNodeStrict(other *Node) bool {
+	return n.IsEqualNode(other) && (n == other || n.XML() == other.XML())
+}
@@ -0,0 +1,108 @@
+package xmldom
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCompareDocumentPosition(t *testing.T) {
+	doc := parseTraversal(t, `<a x="1" y="2"><b><c/></b><d/></a>`)
+	a, b, c, d := doc.DocumentElement(), element(doc, "b"), element(doc, "c"), element(doc, "d")
+	x, y := a.GetAttributeNode("x"), a.GetAttributeNode("y")
+	other := parseTraversal(t, `<a/>`)
+	detached, _ := doc.CreateElement("e")
+	tests := []struct {
+		n, other *Node
+		want     DocumentPosition
+	}{
+		{a, a, 0},
+		{b, a, DocumentPositionContains | DocumentPositionPreceding},
+		{a, c, DocumentPositionContainedBy | DocumentPositionFollowing},
+		{c, d, DocumentPositionFollowing},
+		{d, c, DocumentPositionPreceding},
+		{doc, d, DocumentPositionContainedBy | DocumentPositionFollowing},
+		{x, a, DocumentPositionContains | DocumentPositionPreceding},
+		{a, x, DocumentPositionContainedBy | DocumentPositionFollowing},
+		{x, y, DocumentPositionImplementationSpecific | DocumentPositionFollowing},
+		{y, x, DocumentPositionImplementationSpecific | DocumentPositionPreceding},
+		{x, b, DocumentPositionFollowing},
+		{c, y, DocumentPositionPreceding},
+		{doc, x, DocumentPositionContainedBy | DocumentPositionFollowing},
+	}
+	for _, test := range tests {
+		if got := test.n.CompareDocumentPosition(test.other); got != test.want {
+			t.Errorf("%s.CompareDocumentPosition(%s) = %#x, want %#x", test.n.nodeName, test.other.nodeName, got, test.want)
+		}
+	}
+	for _, n := range []*Node{other, other.DocumentElement(), detached, doc.CreateTextNode("t")} {
+		for _, m := range []*Node{b, x} {
+			p, q := m.CompareDocumentPosition(n), n.CompareDocumentPosition(m)
+			mask := DocumentPositionDisconnected | DocumentPositionImplementationSpecific
+			if p&mask != mask || q&mask != mask || p^q != DocumentPositionPreceding|DocumentPositionFollowing {
+				t.Errorf("disconnected %s and %s: %#x and %#x", m.nodeName, n.nodeName, p, q)
+			}
+		}
+	}
+
+	// Nodes sort in document order.
+	nodes := NodeList{d, y, c, doc, b, x, a}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].CompareDocumentPosition(nodes[j])&DocumentPositionFollowing != 0
+	})
+	if names(nodes) != "#document a x y b c d" {
+		t.Errorf("sorted %s", names(nodes))
+	}
+}
+
+func TestContains(t *testing.T) {
+	doc := parseTraversal(t, `<a x="1"><b/></a>`)
+	a, b := doc.DocumentElement(), element(doc, "b")
+	if !a.Contains(a) || !a.Contains(b) || !doc.Contains(b) || b.Contains(a) || a.Contains(nil) {
+		t.Error("Contains of elements")
+	}
+	if a.Contains(a.GetAttributeNode("x")) {
+		t.Error("an element contains its attributes")
+	}
+	if !a.IsSameNode(a) || a.IsSameNode(b) || a.IsSameNode(a.CloneNode(true)) {
+		t.Error("IsSameNode")
+	}
+}
+
+func TestIsEqualNode(t *testing.T) {
+	tests := []struct {
+		a, b          string
+		equal, strict bool
+	}{
+		{`<a x="1" y="2">text<b/></a>`, `<a x="1" y="2">text<b/></a>`, true, true},
+		{`<a x="1" y="2">text<b/></a>`, `<a  y='2' x="1" >text<b></b></a>`, true, false},
+		{`<a>&amp;</a>`, `<a>&#38;</a>`, true, false},
+		{`<a>&amp;</a>`, `<a><![CDATA[&]]></a>`, true, false},
+		{`<a x="1"/>`, `<a x="2"/>`, false, false},
+		{`<a x="1"/>`, `<a x="1" y="2"/>`, false, false},
+		{`<a><b/><c/></a>`, `<a><c/><b/></a>`, false, false},
+		{`<a xmlns="urn:a"/>`, `<a xmlns="urn:b"/>`, false, false},
+		{`<p:a xmlns:p="urn:a"/>`, `<q:a xmlns:q="urn:a"/>`, false, false},
+		{`<!DOCTYPE a SYSTEM "a.dtd"><a/>`, `<!DOCTYPE a SYSTEM "b.dtd"><a/>`, false, false},
+		{`<?pi data?><a/>`, `<?pi other?><a/>`, false, false},
+	}
+	for _, test := range tests {
+		a, b := parseTraversal(t, test.a), parseTraversal(t, test.b)
+		if a.IsEqualNode(b) != test.equal || b.IsEqualNode(a) != test.equal {
+			t.Errorf("%s and %s: IsEqualNode = %v", test.a, test.b, !test.equal)
+		}
+		if a.IsEqualNodeStrict(b) != test.strict {
+			t.Errorf("%s and %s: IsEqualNodeStrict = %v", test.a, test.b, !test.strict)
+		}
+	}
+
+	doc := parseTraversal(t, `<a x = "1">text</a>`)
+	a := doc.DocumentElement()
+	clone := a.CloneNode(true)
+	if !a.IsEqualNode(clone) || a.IsEqualNode(nil) {
+		t.Error("IsEqualNode of a clone")
+	}
+	text(clone).SetNodeValue("text")
+	if !a.IsEqualNode(clone) || !a.IsEqualNodeStrict(a) {
+		t.Error("IsEqualNode after setting the same value")
+	}
+}
@@ -0,0 +1,282 @@
+package xmldom
+
+import (
+	"strings"
+)
+
+// declaration holds the data specific to document type, entity and notation
+// nodes.
+type declaration struct {
+	publicId       string
+	systemId       string
+	notationName   string       // unparsed entities
+	value          string       // replacement text of internal entities
+	internalSubset string       // document types
+	entities       NamedNodeMap // document types
+	notations      NamedNodeMap // document types
+}
+
+func (decl *declaration) clone(deep bool) *declaration {
+	if decl == nil {
+		return nil
+	}
+	res := *decl
+	if decl.entities != nil {
+		res.entities = decl.entities.Clone(deep)
+	}
+	if decl.notations != nil {
+		res.notations = decl.notations.Clone(deep)
+	}
+	return &res
+}
+
+// Doctype returns the document type declaration of the document, or nil.
+func (d *Node) Doctype() *Node {
+	for _, n := range d.childNodes {
+		if n.nodeType == DocumentTypeNode && n.decl != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// Name returns the name of an attribute or a document type.
+func (n *Node) Name() string {
+	return n.nodeName
+}
+
+// PublicId returns the public identifier of a document type, entity or
+// notation.
+func (n *Node) PublicId() string {
+	if n.decl == nil {
+		return ""
+	}
+	return n.decl.publicId
+}
+
+// SystemId returns the system identifier of a document type, entity or
+// notation.
+func (n *Node) SystemId() string {
+	if n.decl == nil {
+		return ""
+	}
+	return n.decl.systemId
+}
+
+// InternalSubset returns the internal subset of a document type, without the
+// enclosing brackets.
+func (n *Node) InternalSubset() string {
+	if n.decl == nil {
+		return ""
+	}
+	return n.decl.internalSubset
+}
+
+// NotationName returns the notation of an unparsed entity.
+func (n *Node) NotationName() string {
+	if n.decl == nil {
+		return ""
+	}
+	return n.decl.notationName
+}
+
+// Entities returns the general entities declared in the internal subset of a
+// document type.
+func (n *Node) Entities() NamedNodeMap {
+	if n.decl == nil {
+		return nil
+	}
+	return n.decl.entities
+}
+
+// Notations returns the notations declared in the internal subset of a
+// document type.
+func (n *Node) Notations() NamedNodeMap {
+	if n.decl == nil {
+		return nil
+	}
+	return n.decl.notations
+}
+
+func (d *Node) newDocumentType(dt *doctypeDecl) *Node {
+	n := &Node{
+		nodeType:      DocumentTypeNode,
+		pos:           -1,
+		nodeName:      dt.name,
+		nodeValue:     "",
+		ValueDirty:    false,
+		parentNode:    nil,
+		childNodes:    nil,
+		ownerDocument: d.ownerDocument,
+		attributes:    nil,
+		decl: &declaration{
+			publicId:       dt.publicId,
+			systemId:       dt.systemId,
+			internalSubset: dt.internalSubset,
+			entities:       NewEmptyNamedNodeMap(d.ownerDocument),
+			notations:      NewEmptyNamedNodeMap(d.ownerDocument),
+		},
+	}
+	for _, md := range parseMarkupDecls(dt.internalSubset) {
+		switch md.kind {
+		case "ENTITY":
+			if e := d.newEntity(md.tokens); e != nil && n.decl.entities.GetNamedItem(e.nodeName) == nil {
+				n.decl.entities.SetNamedItem(e)
+			}
+		case "NOTATION":
+			if nt := d.newNotation(md.tokens); nt != nil && n.decl.notations.GetNamedItem(nt.nodeName) == nil {
+				n.decl.notations.SetNamedItem(nt)
+			}
+		}
+	}
+	return n
+}
+
+// parseExternalID parses an external identifier from declaration tokens and
+// returns the remaining tokens.
+func parseExternalID(toks []string, decl *declaration) []string {
+	if len(toks) == 0 {
+		return toks
+	}
+	switch toks[0] {
+	case "SYSTEM":
+		if len(toks) >= 2 {
+			decl.systemId, _ = unquote(toks[1])
+			return toks[2:]
+		}
+	case "PUBLIC":
+		if len(toks) >= 2 {
+			decl.publicId, _ = unquote(toks[1])
+			toks = toks[2:]
+			if len(toks) > 0 {
+				if s, ok := unquote(toks[0]); ok {
+					decl.systemId = s
+					toks = toks[1:]
+				}
+			}
+			return toks
+		}
+	}
+	return toks[1:]
+}
+
+// newEntity creates an entity node from the tokens of an ENTITY declaration.
+// Parameter entities are not represented in the DOM and nil is returned.
+func (d *Node) newEntity(toks []string) *Node {
+	if len(toks) < 2 || toks[0] == "%" {
+		return nil
+	}
+	decl := &declaration{}
+	if value, ok := unquote(toks[1]); ok {
+		decl.value = expandCharRefs(value)
+	} else {
+		toks := parseExternalID(toks[1:], decl)
+		if len(toks) >= 2 && toks[0] == "NDATA" {
+			decl.notationName = toks[1]
+		}
+	}
+	return &Node{
+		nodeType:      EntityNode,
+		pos:           -1,
+		nodeName:      toks[0],
+		nodeValue:     "",
+		ValueDirty:    false,
+		parentNode:    nil,
+		childNodes:    NodeList{},
+		ownerDocument: d.ownerDocument,
+		attributes:    nil,
+		decl:          decl,
+	}
+}
+
+// newNotation creates a notation node from the tokens of a NOTATION
+// declaration.
+func (d *Node) newNotation(toks []string) *Node {
+	if len(toks) < 2 {
+		return nil
+	}
+	decl := &declaration{}
+	parseExternalID(toks[1:], decl)
+	return &Node{
+		nodeType:      NotationNode,
+		pos:           -1,
+		nodeName:      toks[0],
+		nodeValue:     "",
+		ValueDirty:    false,
+		parentNode:    nil,
+		childNodes:    nil,
+		ownerDocument: d.ownerDocument,
+		attributes:    nil,
+		decl:          decl,
+	}
+}
+
+// expandCharRefs replaces the character references in an entity value.
+func expandCharRefs(value string) string {
+	var res string
+	for {
+		i := strings.Index(value, "&#")
+		if i < 0 {
+			return res + value
+		}
+		end := strings.IndexByte(value[i:], ';')
+		if end < 0 {
+			return res + value
+		}
+		if r, ok := parseCharRef(value[i+1 : i+end]); ok {
+			res += value[:i] + string(r)
+		} else {
+			res += value[:i+end+1]
+		}
+		value = value[i+end+1:]
+	}
+}
+
+// externalIDString formats an external identifier for serialization.
+func (decl *declaration) externalIDString() string {
+	switch {
+	case decl.publicId != "" && decl.systemId != "":
+		return " PUBLIC " + quoteLiteral(decl.publicId) + " " + quoteLiteral(decl.systemId)
+	case decl.publicId != "":
+		return " PUBLIC " + quoteLiteral(decl.publicId)
+	case decl.systemId != "":
+		return " SYSTEM " + quoteLiteral(decl.systemId)
+	default:
+		return ""
+	}
+}
+
+func quoteLiteral(s string) string {
+	if strings.ContainsRune(s, '"') {
+		return "'" + s + "'"
+	}
+	return "\"" + s + "\""
+}
+
+// declarationXML serializes document type, entity and notation nodes that do
+// not have their source text.
+func (n *Node) declarationXML() string {
+	switch n.nodeType {
+	case DocumentTypeNode:
+		res := "<!DOCTYPE " + n.nodeName + n.decl.externalIDString()
+		if n.decl.internalSubset != "" {
+			res += " [" + n.decl.internalSubset + "]"
+		}
+		return res + ">"
+	case EntityNode:
+		res := "<!ENTITY " + n.nodeName
+		if n.decl.publicId == "" && n.decl.systemId == "" {
+			value := strings.Replace(n.decl.value, "%", "&#37;", -1)
+			res += " \"" + strings.Replace(value, "\"", "&#34;", -1) + "\""
+		} else {
+			res += n.decl.externalIDString()
+			if n.decl.notationName != "" {
+				res += " NDATA " + n.decl.notationName
+			}
+		}
+		return res + ">"
+	case NotationNode:
+		return "<!NOTATION " + n.nodeName + n.decl.externalIDString() + ">"
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package xmldom
+
+import "testing"
+
+func TestDoctype(t *testing.T) {
+	tests := []struct {
+		src                      string
+		name, publicId, systemId string
+		internalSubset           string
+	}{
+		{`<!DOCTYPE a><a/>`, "a", "", "", ""},
+		{`<!DOCTYPE a SYSTEM "a.dtd"><a/>`, "a", "", "a.dtd", ""},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" 'x.dtd'><html/>`, "html", "-//W3C//DTD XHTML 1.0 Strict//EN", "x.dtd", ""},
+		{"<!DOCTYPE a [\n<!ELEMENT a ANY>\n]><a/>", "a", "", "", "\n<!ELEMENT a ANY>\n"},
+		{`<!DOCTYPE a SYSTEM "a.dtd" [<!ENTITY e "x">]><a/>`, "a", "", "a.dtd", `<!ENTITY e "x">`},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, test.src)
+		dt := doc.Doctype()
+		if dt == nil || dt.NodeType() != DocumentTypeNode {
+			t.Errorf("%s: Doctype() = %v", test.src, dt)
+			continue
+		}
+		if dt.Name() != test.name || dt.PublicId() != test.publicId || dt.SystemId() != test.systemId || dt.InternalSubset() != test.internalSubset {
+			t.Errorf("%s: %q, %q, %q, %q", test.src, dt.Name(), dt.PublicId(), dt.SystemId(), dt.InternalSubset())
+		}
+		if got := doc.XML(); got != test.src {
+			t.Errorf("%s: XML() = %s", test.src, got)
+		}
+	}
+	if doc := parseTraversal(t, `<a/>`); doc.Doctype() != nil {
+		t.Errorf("Doctype() of a document without one = %v", doc.Doctype())
+	}
+}
+
+func TestDoctypeEntities(t *testing.T) {
+	doc := parseTraversal(t, `<!DOCTYPE a [
+  <!ENTITY int "a &#x41; b">
+  <!ENTITY ext SYSTEM "ext.xml">
+  <!ENTITY pub PUBLIC "-//P//EN" "pub.xml">
+  <!ENTITY img SYSTEM "img.png" NDATA png>
+  <!ENTITY % param "ignored">
+  <!NOTATION png SYSTEM "image/png">
+  <!NOTATION gif PUBLIC "-//G//EN">
+  <!-- comment -->
+]><a/>`)
+	dt := doc.Doctype()
+	entities := []struct {
+		name, value, publicId, systemId, notation string
+	}{
+		{"int", "a A b", "", "", ""},
+		{"ext", "", "", "ext.xml", ""},
+		{"pub", "", "-//P//EN", "pub.xml", ""},
+		{"img", "", "", "img.png", "png"},
+	}
+	if dt.Entities().Length() != len(entities) {
+		t.Errorf("%d entities, want %d", dt.Entities().Length(), len(entities))
+	}
+	for _, test := range entities {
+		e := dt.Entities().GetNamedItem(test.name)
+		if e == nil || e.NodeType() != EntityNode {
+			t.Errorf("entity %s: %v", test.name, e)
+			continue
+		}
+		if e.decl.value != test.value || e.PublicId() != test.publicId || e.SystemId() != test.systemId || e.NotationName() != test.notation {
+			t.Errorf("entity %s: %q, %q, %q, %q", test.name, e.decl.value, e.PublicId(), e.SystemId(), e.NotationName())
+		}
+	}
+	notations := []struct {
+		name, publicId, systemId string
+	}{
+		{"png", "", "image/png"},
+		{"gif", "-//G//EN", ""},
+	}
+	if dt.Notations().Length() != len(notations) {
+		t.Errorf("%d notations, want %d", dt.Notations().Length(), len(notations))
+	}
+	for _, test := range notations {
+		n := dt.Notations().GetNamedItem(test.name)
+		if n == nil || n.NodeType() != NotationNode {
+			t.Errorf("notation %s: %v", test.name, n)
+		} else if n.PublicId() != test.publicId || n.SystemId() != test.systemId {
+			t.Errorf("notation %s: %q, %q", test.name, n.PublicId(), n.SystemId())
+		}
+	}
+}
@@ -2,7 +2,7 @@ package xmldom
 
 func (d *Node) DocumentElement() *Node {
 	if d.nodeType != DocumentNode {
-		panic("only on a document")
+		return nil
 	}
 	for _, n := range d.childNodes {
 		if n.NodeType() == ElementNode {
@@ -12,6 +12,85 @@ func (d *Node) DocumentElement() *Node {
 	return nil
 }
 
+// documentState holds the data shared by the nodes of a document.
+type documentState struct {
+	version      uint64                    // incremented on every change to the trees of the document
+	ids          map[string]NodeList       // elements by ID
+	idAttributes map[string]string         // ID attribute declared for element names
+	encoding     string                    // encoding of the parsed document
+	bom          bool                      // the parsed document started with a byte order mark
+	iterators    []*NodeIterator           // iterators not detached, updated on removals
+	ranges       []*Range                  // ranges not detached, updated on changes
+	observers    map[*Node][]*registration // mutation observers registered on nodes
+	pending      []*MutationObserver       // observers with records to deliver
+	history      *History                  // history recording the changes, or nil
+}
+
+func (d *Node) treeChanged() {
+	if d != nil && d.state != nil {
+		d.state.version++
+	}
+}
+
+// removingNode updates the iterators, ranges and mutation observers of the
+// document before n is removed from its parent.
+func (d *Node) removingNode(n *Node) {
+	if d == nil || d.state == nil {
+		return
+	}
+	d.addTransientObservers(n)
+	for _, it := range d.state.iterators {
+		it.removing(n)
+	}
+	for _, r := range d.state.ranges {
+		r.start.removing(n)
+		r.end.removing(n)
+	}
+}
+
+// insertedNodes updates the ranges of the document after count children
+// were inserted in parent at index.
+func (d *Node) insertedNodes(parent *Node, index, count int) {
+	if d == nil || d.state == nil {
+		return
+	}
+	for _, r := range d.state.ranges {
+		r.start.inserted(parent, uint(index), uint(count))
+		r.end.inserted(parent, uint(index), uint(count))
+	}
+}
+
+// replacingData updates the ranges of the document before count code units
+// of the data of n are replaced by length others from offset.
+func (d *Node) replacingData(n *Node, offset, count, length uint) {
+	if d == nil || d.state == nil {
+		return
+	}
+	for _, r := range d.state.ranges {
+		r.start.replacingData(n, offset, count, length)
+		r.end.replacingData(n, offset, count, length)
+	}
+}
+
+// splittingText updates the ranges of the document after the data of n from
+// offset was copied to newNode, inserted after n.
+func (d *Node) splittingText(n, newNode *Node, offset uint) {
+	if d == nil || d.state == nil {
+		return
+	}
+	for _, r := range d.state.ranges {
+		r.start.splittingText(n, newNode, offset)
+		r.end.splittingText(n, newNode, offset)
+	}
+}
+
+func (d *Node) treeVersion() uint64 {
+	if d != nil && d.state != nil {
+		return d.state.version
+	}
+	return 0
+}
+
 func NewDocument() *Node {
 	n := &Node{
 		nodeType:      DocumentNode,
@@ -23,6 +102,7 @@ func NewDocument() *Node {
 		childNodes:    NodeList{},
 		ownerDocument: nil,
 		attributes:    nil,
+		state:         &documentState{},
 	}
 	n.ownerDocument = n
 	return n
@@ -51,7 +131,7 @@ func importNode(doc *Node, n *Node) {
 }
 
 func (d *Node) CreateElement(tagName string) (*Node, Error) {
-	return &Node{
+	n := &Node{
 		nodeType:      ElementNode,
 		pos:           -1,
 		nodeName:      tagName,
@@ -60,8 +140,28 @@ func (d *Node) CreateElement(tagName string) (*Node, Error) {
 		parentNode:    nil,
 		childNodes:    NodeList{},
 		ownerDocument: d.ownerDocument,
-		attributes:    NewEmptyNamedNodeMap(d.ownerDocument),
-	}, nil
+		attributes:    nil,
+	}
+	attributes := NewEmptyNamedNodeMap(d.ownerDocument)
+	attributes.setOwner(n)
+	n.attributes = attributes
+	return n, nil
+}
+
+func (d *Node) CreateElementNS(namespaceURI, qualifiedName string) (*Node, Error) {
+	prefix, localName, e := checkQName(namespaceURI, qualifiedName)
+	if e != nil {
+		return nil, e
+	}
+	n, e := d.CreateElement(qualifiedName)
+	if e != nil {
+		return nil, e
+	}
+	n.namespaceURI = namespaceURI
+	n.prefix = prefix
+	n.localName = localName
+	n.nsDirty = true
+	return n, nil
 }
 
 func (d *Node) CreateDocumentFragment() *Node {
@@ -106,7 +206,13 @@ func (d *Node) CreateComment(data string) *Node {
 	}
 }
 
+// CreateDocumentType creates a document type node from the content of a
+// <!DOCTYPE> directive, without the enclosing "<!" and ">". Other directives
+// are kept as document type nodes without a name.
 func (d *Node) CreateDocumentType(data string) *Node {
+	if dt, ok := parseDoctype(data); ok {
+		return d.newDocumentType(dt)
+	}
 	return &Node{
 		nodeType:      DocumentTypeNode,
 		pos:           -1,
@@ -162,16 +268,32 @@ func (d *Node) CreateAttribute(name string) (*Node, Error) {
 	}, nil
 }
 
+func (d *Node) CreateAttributeNS(namespaceURI, qualifiedName string) (*Node, Error) {
+	prefix, localName, e := checkQName(namespaceURI, qualifiedName)
+	if e != nil {
+		return nil, e
+	}
+	n, e := d.CreateAttribute(qualifiedName)
+	if e != nil {
+		return nil, e
+	}
+	n.namespaceURI = namespaceURI
+	n.prefix = prefix
+	n.localName = localName
+	n.nsDirty = true
+	return n, nil
+}
+
+// CreateEntityReference creates a reference to an entity. If the entity is
+// declared in the internal subset of the document type, its children are
+// copied to the reference, parsing its replacement text first if no
+// reference to it was parsed.
 func (d *Node) CreateEntityReference(name string) (*Node, Error) {
-	return &Node{
-		nodeType:      EntityReferenceNode,
-		pos:           -1,
-		nodeName:      name,
-		nodeValue:     "",
-		ValueDirty:    false,
-		parentNode:    nil,
-		childNodes:    nil,
-		ownerDocument: d.ownerDocument,
-		attributes:    nil,
-	}, nil
+	n := d.newEntityReference(name)
+	if d.ownerDocument.Doctype() != nil {
+		p := newParser(&ParseOptions{Entities: EntityKeep})
+		p.doc = d.ownerDocument
+		p.expandReference(n)
+	}
+	return n, nil
 }
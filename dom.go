@@ -14,6 +14,16 @@ const (
 	NotFoundError
 	NotSupportedError
 	InuseAttributeError
+	InvalidStateError
+	SyntaxError
+	InvalidModificationError
+	NamespaceError
+	InvalidAccessError
+)
+
+// Error codes defined after DOM Level 2 keep their DOM value.
+const (
+	InvalidNodeTypeError ErrorCode = 24
 )
 
 type Error interface {
@@ -43,8 +53,13 @@ type Implementation interface {
 }
 
 type NodeInterface interface {
-	Pos() uint // extension
+	Pos() uint                        // extension
+	SourceRange() (SourceRange, bool) // extension
 	NodeName() string
+	NamespaceURI() string
+	Prefix() string
+	SetPrefix(prefix string) Error
+	LocalName() string
 	NodeValue() string
 	SetNodeName(string)
 	SetNodeValue(string)
@@ -64,6 +79,16 @@ type NodeInterface interface {
 	AppendChild(newChild *Node) (*Node, Error)
 	HasChildNodes() bool
 	CloneNode(deep bool) *Node
+
+	LookupPrefix(namespaceURI string) string
+	LookupNamespaceURI(prefix string) string
+	IsDefaultNamespace(namespaceURI string) bool
+
+	CompareDocumentPosition(other *Node) DocumentPosition
+	Contains(other *Node) bool
+	IsSameNode(other *Node) bool
+	IsEqualNode(other *Node) bool
+	IsEqualNodeStrict(other *Node) bool // extension
 }
 
 type NodeList []*Node
@@ -72,6 +97,9 @@ type NamedNodeMap interface {
 	GetNamedItem(name string) *Node
 	SetNamedItem(node *Node) (*Node, Error)
 	RemoveNamedItem(name string) Error
+	GetNamedItemNS(namespaceURI, localName string) *Node
+	SetNamedItemNS(node *Node) (*Node, Error)
+	RemoveNamedItemNS(namespaceURI, localName string) Error
 	Item(index int) *Node
 	Length() int
 	Clone(deep bool) NamedNodeMap
@@ -83,19 +111,28 @@ type DocumentFragment interface {
 
 type Document interface {
 	NodeInterface
-	//Doctype() DocumentType
+	Doctype() DocumentType
 	//Implementation() Implementation
 	DocumentElement() Element
-	//GetElementsByTagName(tagName string) NodeList
+	GetElementById(elementId string) Element
+	GetElementsByTagName(tagName string) *LiveNodeList
+	GetElementsByTagNameNS(namespaceURI, localName string) *LiveNodeList
 
 	CreateElement(tagName string) (Element, Error)
+	CreateElementNS(namespaceURI, qualifiedName string) (Element, Error)
 	CreateDocumentFragment() DocumentFragment
 	CreateTextNode(data string) Text
 	CreateComment(data string) Comment
 	CreateCDATASection(data string) (CDATASection, Error)
 	CreateProcessingInstruction(target, data string) (ProcessingInstruction, Error)
 	CreateAttribute(name string) (Attr, Error)
-	CreateEntityReference(name string) (Entity, Error)
+	CreateAttributeNS(namespaceURI, qualifiedName string) (Attr, Error)
+	CreateEntityReference(name string) (EntityReference, Error)
+
+	CreateNodeIterator(root *Node, whatToShow uint32, filter NodeFilter, entityReferenceExpansion bool) (*NodeIterator, Error)
+	CreateTreeWalker(root *Node, whatToShow uint32, filter NodeFilter, entityReferenceExpansion bool) (*TreeWalker, Error)
+
+	CreateRange() *Range
 }
 
 type CharacterData interface {
@@ -104,11 +141,11 @@ type CharacterData interface {
 	SetData(s string)
 	Length() uint
 
-	//SubstringData(offset, count uint) (string, Error)
-	//AppendData(arg string) Error
-	//InsertData(offset uint, arg string) Error
-	//DeteleData(offset, count uint) Error
-	//ReplaceData(offset, count long, arg string) Error
+	SubstringData(offset, count uint) (string, Error)
+	AppendData(arg string) Error
+	InsertData(offset uint, arg string) Error
+	DeleteData(offset, count uint) Error
+	ReplaceData(offset, count uint, arg string) Error
 }
 
 type Attr interface {
@@ -117,6 +154,8 @@ type Attr interface {
 	Specified() bool
 	Value() string
 	SetValue(s string)
+	OwnerElement() Element
+	IsId() bool
 }
 
 type Element interface {
@@ -128,13 +167,23 @@ type Element interface {
 	GetAttributeNode(name string) Attr
 	SetAttributeNode(newAttr Attr) (Attr, Error)
 	RemoveAttributeNode(oldAttr Attr) (Attr, Error)
-	//GetElementsByTagName(name string) NodeList
+	GetElementsByTagName(name string) *LiveNodeList
+	GetAttributeNS(namespaceURI, localName string) string
+	SetAttributeNS(namespaceURI, qualifiedName, value string) Error
+	RemoveAttributeNS(namespaceURI, localName string) Error
+	GetAttributeNodeNS(namespaceURI, localName string) Attr
+	SetAttributeNodeNS(newAttr Attr) (Attr, Error)
+	GetElementsByTagNameNS(namespaceURI, localName string) *LiveNodeList
+	HasAttribute(name string) bool
+	HasAttributeNS(namespaceURI, localName string) bool
 	Normalize()
 }
 
 type Text interface {
 	CharacterData
-	//SplitText(offset uint) (Text, Error)
+	SplitText(offset uint) (Text, Error)
+	WholeText() string
+	ReplaceWholeText(content string) (Text, Error)
 }
 
 type Comment interface {
@@ -150,6 +199,9 @@ type DocumentType interface {
 	Name() string
 	Entities() NamedNodeMap
 	Notations() NamedNodeMap
+	PublicId() string
+	SystemId() string
+	InternalSubset() string
 }
 
 type Notation interface {
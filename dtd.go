@@ -0,0 +1,192 @@
+package xmldom
+
+import (
+	"strings"
+)
+
+// doctypeDecl is the content of a <!DOCTYPE> directive.
+type doctypeDecl struct {
+	name           string
+	publicId       string
+	systemId       string
+	internalSubset string
+}
+
+// parseDoctype parses the text of a directive, without the leading "<!" and
+// the trailing ">". It returns false if it is not a document type declaration.
+func parseDoctype(directive string) (*doctypeDecl, bool) {
+	var dt doctypeDecl
+	code := strings.TrimLeft(directive, xmlWhitespace)
+	if !strings.HasPrefix(code, "DOCTYPE") {
+		return nil, false
+	}
+	code = code[len("DOCTYPE"):]
+	_, code = parseWhile(code, xmlWhitespace)
+	dt.name, code = parseUntil(code, "["+xmlWhitespace)
+	if dt.name == "" {
+		return nil, false
+	}
+	_, code = parseWhile(code, xmlWhitespace)
+	var keyword string
+	keyword, code = parseUntil(code, "\"'["+xmlWhitespace)
+	switch keyword {
+	case "PUBLIC":
+		_, code = parseWhile(code, xmlWhitespace)
+		dt.publicId, code = parseQuoted(code)
+		_, code = parseWhile(code, xmlWhitespace)
+		dt.systemId, code = parseQuoted(code)
+	case "SYSTEM":
+		_, code = parseWhile(code, xmlWhitespace)
+		dt.systemId, code = parseQuoted(code)
+	}
+	_, code = parseWhile(code, xmlWhitespace)
+	if strings.HasPrefix(code, "[") {
+		if end := strings.LastIndexByte(code, ']'); end > 0 {
+			dt.internalSubset = code[1:end]
+		} else {
+			dt.internalSubset = code[1:]
+		}
+	}
+	return &dt, true
+}
+
+// parseQuoted parses a literal delimited by single or double quotes and
+// returns its content.
+func parseQuoted(code string) (string, string) {
+	if code == "" || (code[0] != '"' && code[0] != '\'') {
+		return "", code
+	}
+	quote := code[0:1]
+	value, rest := parseUntil(code[1:], quote)
+	if rest != "" {
+		rest = rest[1:]
+	}
+	return value, rest
+}
+
+// markupDecl is a markup declaration of a DTD, split into tokens. Tokens are
+// names, quoted literals including their quotes and parenthesized groups.
+type markupDecl struct {
+	kind   string // ELEMENT, ATTLIST, ENTITY or NOTATION
+	tokens []string
+}
+
+// parseMarkupDecls returns the markup declarations of an internal subset.
+// Comments, processing instructions and parameter entity references are
+// skipped.
+func parseMarkupDecls(subset string) []markupDecl {
+	var decls []markupDecl
+	code := subset
+	for {
+		_, code = parseWhile(code, xmlWhitespace)
+		switch {
+		case code == "":
+			return decls
+		case strings.HasPrefix(code, "<!--"):
+			code = skipPast(code, "-->")
+		case strings.HasPrefix(code, "<?"):
+			code = skipPast(code, "?>")
+		case strings.HasPrefix(code, "<!"):
+			var decl markupDecl
+			decl.kind, code = parseUntil(code[2:], ">\"'("+xmlWhitespace)
+			decl.tokens, code = parseDeclTokens(code)
+			decls = append(decls, decl)
+		default:
+			// parameter entity reference or garbage
+			_, code = parseUntil(code[1:], "<")
+		}
+	}
+}
+
+func skipPast(code, end string) string {
+	if i := strings.Index(code, end); i >= 0 {
+		return code[i+len(end):]
+	}
+	return ""
+}
+
+func parseDeclTokens(code string) ([]string, string) {
+	var tokens []string
+	for {
+		_, code = parseWhile(code, xmlWhitespace)
+		if code == "" {
+			return tokens, code
+		}
+		var tok string
+		switch code[0] {
+		case '>':
+			return tokens, code[1:]
+		case '"', '\'':
+			end := strings.IndexByte(code[1:], code[0])
+			if end < 0 {
+				return append(tokens, code), ""
+			}
+			tok, code = code[:end+2], code[end+2:]
+		case '(':
+			depth := 0
+			end := len(code)
+			for i, c := range code {
+				if c == '(' {
+					depth++
+				} else if c == ')' {
+					depth--
+					if depth == 0 {
+						end = i + 1
+						break
+					}
+				}
+			}
+			tok, code = code[:end], code[end:]
+			// occurrence indicator
+			if code != "" && strings.IndexByte("?*+", code[0]) >= 0 {
+				tok, code = tok+code[0:1], code[1:]
+			}
+		default:
+			tok, code = parseUntil(code, ">\"'("+xmlWhitespace)
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// unquote returns the content of a quoted literal token.
+func unquote(tok string) (string, bool) {
+	if len(tok) >= 2 && (tok[0] == '"' || tok[0] == '\'') && tok[len(tok)-1] == tok[0] {
+		return tok[1 : len(tok)-1], true
+	}
+	return tok, false
+}
+
+// attributeDecl is an attribute definition from an ATTLIST declaration.
+type attributeDecl struct {
+	element      string
+	name         string
+	attType      string // CDATA, ID, IDREF, ..., NOTATION or an enumeration
+	defaultDecl  string // #REQUIRED, #IMPLIED, #FIXED or empty
+	defaultValue string
+}
+
+// attributeDecls returns the attribute definitions of an ATTLIST declaration.
+func (decl *markupDecl) attributeDecls() []attributeDecl {
+	if decl.kind != "ATTLIST" || len(decl.tokens) == 0 {
+		return nil
+	}
+	var res []attributeDecl
+	toks := decl.tokens[1:]
+	for len(toks) >= 3 {
+		ad := attributeDecl{element: decl.tokens[0], name: toks[0], attType: toks[1]}
+		toks = toks[2:]
+		if ad.attType == "NOTATION" && len(toks) > 0 {
+			toks = toks[1:]
+		}
+		if len(toks) > 0 && strings.HasPrefix(toks[0], "#") {
+			ad.defaultDecl, toks = toks[0], toks[1:]
+		}
+		if len(toks) > 0 && ad.defaultDecl != "#REQUIRED" && ad.defaultDecl != "#IMPLIED" {
+			if value, ok := unquote(toks[0]); ok {
+				ad.defaultValue, toks = value, toks[1:]
+			}
+		}
+		res = append(res, ad)
+	}
+	return res
+}
@@ -1,15 +1,18 @@
 package xmldom
 
+// The element methods return zero values or InvalidNodeTypeError when called
+// on other nodes.
+
 func (n *Node) TagName() string {
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return ""
 	}
 	return n.nodeName
 }
 
 func (n *Node) GetAttribute(name string) string {
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return ""
 	}
 	attr := n.GetAttributeNode(name)
 	if attr == nil {
@@ -20,10 +23,10 @@ func (n *Node) GetAttribute(name string) string {
 }
 
 func (n *Node) SetAttribute(name string, value string) Error {
-	var err Error
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return err(InvalidNodeTypeError)
 	}
+	var err Error
 	attr := n.GetAttributeNode(name)
 	if attr == nil {
 		attr, err = n.OwnerDocument().CreateAttribute(name)
@@ -41,21 +44,21 @@ func (n *Node) SetAttribute(name string, value string) Error {
 
 func (n *Node) RemoveAttribute(name string) Error {
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return err(InvalidNodeTypeError)
 	}
 	return n.attributes.RemoveNamedItem(name)
 }
 
 func (n *Node) GetAttributeNode(name string) *Node {
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return nil
 	}
 	return n.attributes.GetNamedItem(name)
 }
 
 func (n *Node) SetAttributeNode(newAttr *Node) (*Node, Error) {
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return nil, err(InvalidNodeTypeError)
 	}
 	a := n.attributes.GetNamedItem(newAttr.NodeName())
 	if a != nil && newAttr != a {
@@ -68,7 +71,7 @@ func (n *Node) SetAttributeNode(newAttr *Node) (*Node, Error) {
 
 func (n *Node) RemoveAttributeNode(oldAttr *Node) (*Node, Error) {
 	if n.nodeType != ElementNode {
-		panic("only on an element")
+		return nil, err(InvalidNodeTypeError)
 	}
 	a := n.attributes.GetNamedItem(oldAttr.NodeName())
 	if a != oldAttr {
@@ -77,3 +80,99 @@ func (n *Node) RemoveAttributeNode(oldAttr *Node) (*Node, Error) {
 	n.attributes.RemoveNamedItem(oldAttr.NodeName())
 	return oldAttr, nil
 }
+
+func (n *Node) HasAttribute(name string) bool {
+	return n.GetAttributeNode(name) != nil
+}
+
+func (n *Node) GetAttributeNS(namespaceURI, localName string) string {
+	attr := n.GetAttributeNodeNS(namespaceURI, localName)
+	if attr == nil {
+		return ""
+	} else {
+		return attr.NodeValue()
+	}
+}
+
+func (n *Node) SetAttributeNS(namespaceURI, qualifiedName, value string) Error {
+	if n.nodeType != ElementNode {
+		return err(InvalidNodeTypeError)
+	}
+	prefix, localName, err := checkQName(namespaceURI, qualifiedName)
+	if err != nil {
+		return err
+	}
+	attr := n.GetAttributeNodeNS(namespaceURI, localName)
+	if attr == nil {
+		attr, err = n.OwnerDocument().CreateAttributeNS(namespaceURI, qualifiedName)
+		if err != nil {
+			return err
+		}
+		attr.nodeValue = value
+		_, err = n.SetAttributeNodeNS(attr)
+		return err
+	} else {
+		if attr.prefix != prefix {
+			if err := attr.SetPrefix(prefix); err != nil {
+				return err
+			}
+			// declare the new prefix so that the attribute stays in its
+			// namespace when serialized
+			if prefix != "" && n.LookupNamespaceURI(prefix) != namespaceURI {
+				n.declareNamespace(prefix, namespaceURI)
+			}
+		}
+		attr.SetNodeValue(value)
+		return nil
+	}
+}
+
+func (n *Node) RemoveAttributeNS(namespaceURI, localName string) Error {
+	if n.nodeType != ElementNode {
+		return err(InvalidNodeTypeError)
+	}
+	return n.attributes.RemoveNamedItemNS(namespaceURI, localName)
+}
+
+func (n *Node) GetAttributeNodeNS(namespaceURI, localName string) *Node {
+	if n.nodeType != ElementNode {
+		return nil
+	}
+	return n.attributes.GetNamedItemNS(namespaceURI, localName)
+}
+
+func (n *Node) SetAttributeNodeNS(newAttr *Node) (*Node, Error) {
+	if n.nodeType != ElementNode {
+		return nil, err(InvalidNodeTypeError)
+	}
+	if a := n.attributes.GetNamedItemNS(newAttr.namespaceURI, newAttr.localName); a == newAttr {
+		return a, nil
+	}
+	return n.attributes.SetNamedItemNS(newAttr)
+}
+
+func (n *Node) HasAttributeNS(namespaceURI, localName string) bool {
+	return n.GetAttributeNodeNS(namespaceURI, localName) != nil
+}
+
+// OwnerElement returns the element an attribute is attached to, or nil.
+func (n *Node) OwnerElement() *Node {
+	return n.ownerElement
+}
+
+// GetElementsByTagName returns the live list of descendant elements with the
+// given tag name, in document order. The name "*" matches all elements.
+func (n *Node) GetElementsByTagName(name string) *LiveNodeList {
+	return newLiveNodeList(n, func(e *Node) bool {
+		return name == "*" || e.nodeName == name
+	})
+}
+
+// GetElementsByTagNameNS returns the live list of descendant elements matching
+// the namespace URI and local name, in document order. Both can be "*" to
+// match any value.
+func (n *Node) GetElementsByTagNameNS(namespaceURI, localName string) *LiveNodeList {
+	return newLiveNodeList(n, func(e *Node) bool {
+		return (namespaceURI == "*" || e.namespaceURI == namespaceURI) && (localName == "*" || e.localName == localName)
+	})
+}
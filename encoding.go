@@ -0,0 +1,334 @@
+package xmldom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// charset is an encoding that the parser decodes and the serializer encodes
+// without a CharsetReader.
+type charset struct {
+	name string
+	// decode reads one character.
+	decode func(r *bufio.Reader) (rune, error)
+	// encode appends the encoded character to b, or returns false if the
+	// encoding cannot represent it.
+	encode func(b []byte, c rune) ([]byte, bool)
+}
+
+var (
+	latin1      = &charset{"ISO-8859-1", decodeLatin1, encodeBelow(0x100)}
+	ascii       = &charset{"US-ASCII", decodeASCII, encodeBelow(0x80)}
+	windows1252 = &charset{"windows-1252", decodeWindows1252, encodeWindows1252}
+	utf16LE     = &charset{"UTF-16LE", decodeUTF16(false), encodeUTF16(false)}
+	utf16BE     = &charset{"UTF-16BE", decodeUTF16(true), encodeUTF16(true)}
+)
+
+// lookupCharset returns the charset of an encoding name, or nil for UTF-8 and
+// the encodings that need a CharsetReader.
+func lookupCharset(name string) *charset {
+	switch strings.ToLower(name) {
+	case "iso-8859-1", "iso_8859-1", "iso8859-1", "latin1", "l1":
+		return latin1
+	case "us-ascii", "ascii":
+		return ascii
+	case "windows-1252", "cp1252":
+		return windows1252
+	case "utf-16le":
+		return utf16LE
+	case "utf-16be", "utf-16":
+		return utf16BE
+	}
+	return nil
+}
+
+func decodeLatin1(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	return rune(b), err
+}
+
+var errASCII = errors.New("invalid US-ASCII text")
+
+func decodeASCII(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	if b >= 0x80 {
+		return 0, errASCII
+	}
+	return rune(b), err
+}
+
+// encodeBelow returns the encoding function of the charsets made of the
+// characters below limit, encoded as one byte.
+func encodeBelow(limit rune) func(b []byte, c rune) ([]byte, bool) {
+	return func(b []byte, c rune) ([]byte, bool) {
+		if c >= limit {
+			return b, false
+		}
+		return append(b, byte(c)), true
+	}
+}
+
+// windows1252High maps the bytes from 0x80 to 0x9F to the characters they
+// stand for in windows-1252. Undefined bytes are mapped to the control
+// characters with the same code.
+var windows1252High = [32]rune{
+	0x20AC, 0x81, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x8D, 0x017D, 0x8F,
+	0x90, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x9D, 0x017E, 0x0178,
+}
+
+func decodeWindows1252(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	if b >= 0x80 && b < 0xA0 {
+		return windows1252High[b-0x80], err
+	}
+	return rune(b), err
+}
+
+func encodeWindows1252(b []byte, c rune) ([]byte, bool) {
+	if c < 0x80 || (c >= 0xA0 && c < 0x100) {
+		return append(b, byte(c)), true
+	}
+	for i, high := range windows1252High {
+		if high == c {
+			return append(b, byte(0x80+i)), true
+		}
+	}
+	return b, false
+}
+
+var errUTF16 = errors.New("invalid UTF-16 text")
+
+func decodeUTF16(bigEndian bool) func(r *bufio.Reader) (rune, error) {
+	unit := func(r *bufio.Reader) (rune, error) {
+		var b [2]byte
+		n, err := io.ReadFull(r, b[:])
+		if n == 1 {
+			return 0, errUTF16
+		} else if err != nil {
+			return 0, err
+		}
+		if bigEndian {
+			return rune(b[0])<<8 | rune(b[1]), nil
+		}
+		return rune(b[1])<<8 | rune(b[0]), nil
+	}
+	return func(r *bufio.Reader) (rune, error) {
+		c, err := unit(r)
+		if err != nil || !utf16.IsSurrogate(c) {
+			return c, err
+		}
+		low, err := unit(r)
+		if err == io.EOF {
+			err = errUTF16
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c = utf16.DecodeRune(c, low); c == utf8.RuneError {
+			return 0, errUTF16
+		}
+		return c, nil
+	}
+}
+
+func encodeUTF16(bigEndian bool) func(b []byte, c rune) ([]byte, bool) {
+	return func(b []byte, c rune) ([]byte, bool) {
+		units := []rune{c}
+		if c >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(c)
+			units = []rune{r1, r2}
+		}
+		for _, u := range units {
+			if bigEndian {
+				b = append(b, byte(u>>8), byte(u))
+			} else {
+				b = append(b, byte(u), byte(u>>8))
+			}
+		}
+		return b, true
+	}
+}
+
+// charsetReader converts text in a charset to UTF-8.
+type charsetReader struct {
+	r       *bufio.Reader
+	input   *countingReader // reader of r
+	source  *sourceMap
+	charset *charset
+	pending []byte
+	buf     [utf8.UTFMax]byte
+}
+
+func (cr *charsetReader) ReadByte() (byte, error) {
+	if len(cr.pending) == 0 {
+		start := cr.consumed()
+		c, err := cr.charset.decode(cr.r)
+		if err != nil {
+			return 0, err
+		}
+		n := utf8.EncodeRune(cr.buf[:], c)
+		cr.pending = cr.buf[:n]
+		cr.source.add(n, int(cr.consumed()-start))
+	}
+	b := cr.pending[0]
+	cr.pending = cr.pending[1:]
+	return b, nil
+}
+
+// consumed returns the number of source bytes decoded so far.
+func (cr *charsetReader) consumed() int64 {
+	return cr.input.n - int64(cr.r.Buffered())
+}
+
+func (cr *charsetReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := cr.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		p[n] = b
+		n++
+		if len(cr.pending) == 0 && cr.r.Buffered() == 0 {
+			break
+		}
+	}
+	return n, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// Byte order marks of the Unicode encodings.
+const (
+	bomUTF8    = "\xEF\xBB\xBF"
+	bomUTF16BE = "\xFE\xFF"
+	bomUTF16LE = "\xFF\xFE"
+)
+
+// sniffBOM reads the byte order mark at the start of br, if any, and returns
+// the encoding it or the first characters of the document tell.
+func sniffBOM(br *bufio.Reader) (encoding string, bom bool) {
+	b, _ := br.Peek(4)
+	switch {
+	case strings.HasPrefix(string(b), bomUTF8):
+		br.Discard(len(bomUTF8))
+		return "UTF-8", true
+	case strings.HasPrefix(string(b), bomUTF16BE):
+		br.Discard(len(bomUTF16BE))
+		return utf16BE.name, true
+	case strings.HasPrefix(string(b), bomUTF16LE):
+		br.Discard(len(bomUTF16LE))
+		return utf16LE.name, true
+	case string(b) == "<\x00?\x00":
+		return utf16LE.name, false
+	case string(b) == "\x00<\x00?":
+		return utf16BE.name, false
+	}
+	return "", false
+}
+
+// InputEncoding returns the encoding the document was parsed from, which the
+// Serializer writes it in by default. It is empty for documents that were not
+// parsed.
+func (d *Node) InputEncoding() string {
+	if d.state == nil {
+		return ""
+	}
+	return d.state.encoding
+}
+
+// HasByteOrderMark tells if the parsed document started with a byte order
+// mark, which the Serializer writes back.
+func (d *Node) HasByteOrderMark() bool {
+	return d.state != nil && d.state.bom
+}
+
+// encoder converts the output of the Serializer from UTF-8 to a charset.
+type encoder struct {
+	charset *charset
+	buf     []byte
+}
+
+// newEncoder returns the encoder to an encoding, or nil for UTF-8 and the
+// encodings that cannot be written.
+func newEncoder(encoding string) *encoder {
+	if cs := lookupCharset(encoding); cs != nil {
+		return &encoder{charset: cs}
+	}
+	return nil
+}
+
+// EncodingError is returned by Serializer.Serialize for a character that the
+// output encoding cannot represent outside text and attribute values, where
+// character references are not allowed: in names, comments, processing
+// instructions and declarations.
+type EncodingError struct {
+	Encoding string
+	Char     rune
+}
+
+func (e *EncodingError) Error() string {
+	return fmt.Sprintf("xmldom: %U cannot be written in %s outside text and attribute values", e.Char, e.Encoding)
+}
+
+// encode converts markup, or returns an *EncodingError for the first
+// character the charset cannot represent.
+func (e *encoder) encode(s string) ([]byte, error) {
+	e.buf = e.buf[:0]
+	for _, c := range s {
+		var ok bool
+		if e.buf, ok = e.charset.encode(e.buf, c); !ok {
+			return nil, &EncodingError{e.charset.name, c}
+		}
+	}
+	return e.buf, nil
+}
+
+// encodeText converts character data, writing the characters the charset
+// cannot represent as character references.
+func (e *encoder) encodeText(s string) []byte {
+	e.buf = e.buf[:0]
+	for _, c := range s {
+		var ok bool
+		if e.buf, ok = e.charset.encode(e.buf, c); !ok {
+			for _, b := range []byte(fmt.Sprintf("&#x%X;", c)) {
+				e.buf, _ = e.charset.encode(e.buf, rune(b))
+			}
+		}
+	}
+	return e.buf
+}
+
+// cdata returns the content of a CDATA section with the characters the
+// charset cannot represent moved out of the section as character references.
+func (e *encoder) cdata(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if _, ok := e.charset.encode(nil, c); ok {
+			b.WriteRune(c)
+		} else {
+			fmt.Fprintf(&b, "]]>&#x%X;<![CDATA[", c)
+		}
+	}
+	return b.String()
+}
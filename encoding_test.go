@@ -0,0 +1,220 @@
+package xmldom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes encodes s in UTF-16 with the byte order.
+func utf16Bytes(s string, bigEndian bool) string {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			b = append(b, byte(u>>8), byte(u))
+		} else {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return string(b)
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		src      string
+		encoding string
+		bom      bool
+		text     string
+		xml      string // the UTF-8 text of XML
+	}{
+		{"<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<a t='caf\xe9'>\xe0 \xff</a>", "ISO-8859-1", false, "à ÿ", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<a t='café'>à ÿ</a>"},
+		{"<?xml version='1.0' encoding='latin1'?><a>\xe9</a>", "ISO-8859-1", false, "é", "<?xml version='1.0' encoding='UTF-8'?><a>é</a>"},
+		{"<?xml version=\"1.0\" encoding=\"windows-1252\"?><a>\x80 \x93q\x94 \x81</a>", "windows-1252", false, "€ “q” \u0081", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>€ “q” \u0081</a>"},
+		{"<?xml version=\"1.0\" encoding=\"US-ASCII\"?><a>text</a>", "US-ASCII", false, "text", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>text</a>"},
+		{"\xEF\xBB\xBF<a>é</a>", "UTF-8", true, "é", "<a>é</a>"},
+		{"<a>é</a>", "UTF-8", false, "é", "<a>é</a>"},
+		{bomUTF16LE + utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16\"?><a>é 𝄞</a>", false), "UTF-16LE", true, "é 𝄞", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>é 𝄞</a>"},
+		{bomUTF16BE + utf16Bytes("<a>é 𝄞</a>\n", true), "UTF-16BE", true, "é 𝄞", "<a>é 𝄞</a>\n"},
+		{utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16\"?><a>€</a>", false), "UTF-16LE", false, "€", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>€</a>"},
+		{utf16Bytes("<?xml version=\"1.0\" encoding=\"UTF-16\"?><a>€</a>", true), "UTF-16BE", false, "€", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>€</a>"},
+	}
+	for _, test := range tests {
+		doc, err := ParseXML(strings.NewReader(test.src))
+		if err != nil {
+			t.Errorf("ParseXML(%q): %v", test.src, err)
+			continue
+		}
+		if doc.InputEncoding() != test.encoding || doc.HasByteOrderMark() != test.bom {
+			t.Errorf("ParseXML(%q): encoding %q, BOM %v, want %q, %v", test.src, doc.InputEncoding(), doc.HasByteOrderMark(), test.encoding, test.bom)
+		}
+		if text := doc.DocumentElement().AsText(); text != test.text {
+			t.Errorf("ParseXML(%q): text %q, want %q", test.src, text, test.text)
+		}
+		if out := doc.XML(); out != test.xml {
+			t.Errorf("ParseXML(%q).XML() = %q, want %q", test.src, out, test.xml)
+		}
+		want := test.src
+		switch {
+		case test.bom:
+		case test.encoding == "UTF-16LE":
+			want = bomUTF16LE + want
+		case test.encoding == "UTF-16BE":
+			want = bomUTF16BE + want
+		}
+		var b bytes.Buffer
+		if _, err := doc.WriteTo(&b); err != nil || b.String() != want {
+			t.Errorf("ParseXML(%q).WriteTo() = %q, %v", test.src, b.String(), err)
+		}
+	}
+}
+
+func TestEncodingUnrepresentable(t *testing.T) {
+	doc, err := ParseXMLWithOptions(strings.NewReader("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a b='\xe9'>\xe9<![CDATA[x]]></a>"), &ParseOptions{CDATASections: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := doc.DocumentElement()
+	a.SetAttribute("b", "é€")
+	a.FirstChild().SetNodeValue("€ & é")
+	a.LastChild().SetNodeValue("<€>")
+	a.AppendChild(doc.CreateTextNode("😀"))
+	want := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a b=\"\xe9&#x20AC;\">&#x20AC; &amp; \xe9<![CDATA[<]]>&#x20AC;<![CDATA[>]]>&#x1F600;</a>"
+	var out bytes.Buffer
+	if _, err := doc.WriteTo(&out); err != nil || out.String() != want {
+		t.Errorf("WriteTo() = %q, %v, want %q", out.String(), err, want)
+	}
+
+	reparsed, err := ParseXML(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := reparsed.DocumentElement().AsText(); text != "€ & é<€>😀" {
+		t.Errorf("reparsed text %q", text)
+	}
+
+	var b bytes.Buffer
+	s := NewSerializer(&b)
+	s.Encoding = "UTF-8"
+	if err := s.Serialize(a); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<a b=\"é€\">€ &amp; é<![CDATA[<€>]]>😀</a>"; b.String() != want {
+		t.Errorf("Serialize in UTF-8 = %q, want %q", b.String(), want)
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	for _, src := range []string{
+		"<?xml version=\"1.0\" encoding=\"US-ASCII\"?><a>\xe9</a>",
+		bomUTF16LE + utf16Bytes("<a>x</a>", false) + "\x00",
+		bomUTF16BE + utf16Bytes("<a>", true) + "\xD8\x00" + utf16Bytes("</a>", true),
+		"<?xml version=\"1.0\" encoding=\"EBCDIC\"?><a/>",
+	} {
+		if _, err := ParseXML(strings.NewReader(src)); err == nil {
+			t.Errorf("ParseXML(%q) succeeded", src)
+		} else if _, ok := err.(*ParseError); !ok {
+			t.Errorf("ParseXML(%q) returned %T, want *ParseError", src, err)
+		}
+	}
+}
+
+// TestEncodingMarkup checks that character references are only written in
+// text and attribute values, and that the other characters that the encoding
+// cannot represent are errors.
+func TestEncodingMarkup(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(doc, a *Node)
+		want string
+		char rune
+	}{
+		{"text", func(doc, a *Node) {
+			a.AppendChild(doc.CreateTextNode("xĉy"))
+		}, "<a b='\xe9'>x&#x109;y</a>", 0},
+		{"attribute", func(doc, a *Node) {
+			a.SetAttribute("b", "xĉy")
+		}, "<a b=\"x&#x109;y\"/>", 0},
+		{"CDATA section", func(doc, a *Node) {
+			c, _ := doc.CreateCDATASection("xĉy")
+			a.AppendChild(c)
+		}, "<a b='\xe9'><![CDATA[x]]>&#x109;<![CDATA[y]]></a>", 0},
+		{"comment", func(doc, a *Node) {
+			a.AppendChild(doc.CreateComment("xĉy"))
+		}, "", 'ĉ'},
+		{"processing instruction", func(doc, a *Node) {
+			pi, _ := doc.CreateProcessingInstruction("pi", "xĉy")
+			a.AppendChild(pi)
+		}, "", 'ĉ'},
+		{"element name", func(doc, a *Node) {
+			e, _ := doc.CreateElement("bĉ")
+			a.AppendChild(e)
+		}, "", 'ĉ'},
+		{"attribute name", func(doc, a *Node) {
+			a.SetAttribute("cĉ", "x")
+		}, "", 'ĉ'},
+	}
+	for _, test := range tests {
+		doc, err := ParseXML(strings.NewReader("<a b='é'/>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := doc.DocumentElement()
+		test.edit(doc, a)
+		var b bytes.Buffer
+		s := NewSerializer(&b)
+		s.Encoding = "ISO-8859-1"
+		err = s.Serialize(a)
+		if test.char != 0 {
+			if e, ok := err.(*EncodingError); !ok || e.Char != test.char || e.Encoding != "ISO-8859-1" {
+				t.Errorf("%s: Serialize returned %v, want an *EncodingError for %q", test.name, err, test.char)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if b.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, b.String(), test.want)
+		}
+	}
+}
+
+func TestEncodingDeclaration(t *testing.T) {
+	tests := []struct {
+		src      string
+		encoding string
+		want     string
+	}{
+		{"<?xml version='1.0' encoding='ISO-8859-1'?><a/>", "ISO-8859-1", "<?xml version='1.0' encoding='ISO-8859-1'?><a/>"},
+		{"<?xml version='1.0' encoding='latin1'?><a/>", "ISO-8859-1", "<?xml version='1.0' encoding='latin1'?><a/>"},
+		{"<?xml version='1.0' encoding='ISO-8859-1'?><a/>", "windows-1252", "<?xml version='1.0' encoding='windows-1252'?><a/>"},
+		{"<?xml version='1.0' encoding='ISO-8859-1'?><a/>", "UTF-8", "<?xml version='1.0' encoding='UTF-8'?><a/>"},
+		{"<?xml version=\"1.0\" standalone=\"yes\"?><a/>", "ISO-8859-1", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\" standalone=\"yes\"?><a/>"},
+		{"<?xml version=\"1.0\"?><a/>", "UTF-8", "<?xml version=\"1.0\"?><a/>"},
+		{"<a/>", "US-ASCII", "<?xml version=\"1.0\" encoding=\"US-ASCII\"?>\n<a/>"},
+		{"<a/>", "UTF-8", "<a/>"},
+		{"<?xml version='1.0' encoding='UTF-8'?><a/>", "UTF-16LE", bomUTF16LE + utf16Bytes("<?xml version='1.0' encoding='UTF-16'?><a/>", false)},
+		{"<a/>", "UTF-16BE", bomUTF16BE + utf16Bytes("<a/>", true)},
+	}
+	for _, test := range tests {
+		doc, err := ParseXML(strings.NewReader(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		s := NewSerializer(&b)
+		s.Encoding = test.encoding
+		if err := s.Serialize(doc); err != nil {
+			t.Errorf("%s in %s: %v", test.src, test.encoding, err)
+		} else if b.String() != test.want {
+			t.Errorf("%s in %s: got %q, want %q", test.src, test.encoding, b.String(), test.want)
+		}
+		if b.Len() > 0 {
+			if doc, err := ParseXML(&b); err != nil {
+				t.Errorf("%s in %s: %v", test.src, test.encoding, err)
+			} else if doc.InputEncoding() != test.encoding {
+				t.Errorf("%s in %s: parsed back in %s", test.src, test.encoding, doc.InputEncoding())
+			}
+		}
+	}
+}
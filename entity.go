@@ -0,0 +1,319 @@
+package xmldom
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EntityMode selects how the parser handles references to entities other
+// than the predefined ones.
+type EntityMode uint
+
+const (
+	// EntityText leaves references to entities missing from
+	// ParseOptions.Entity as text, "&name;" being part of the text node.
+	EntityText EntityMode = iota
+	// EntityExpand replaces references to the entities declared in the
+	// internal subset with their replacement text, in text and attribute
+	// values. In text, references to entities whose replacement text holds
+	// markup are replaced with the nodes parsed from it.
+	EntityExpand
+	// EntityKeep keeps references as EntityReferenceNode nodes in the tree.
+	// Their children are the parsed replacement text of the entities
+	// declared in the internal subset, or a text node for entities from
+	// ParseOptions.Entity. References in attribute values are expanded.
+	EntityKeep
+)
+
+// maxEntityExpansion limits the size of the text produced by the expansion of
+// entities, as entities referencing each other can expand exponentially.
+const maxEntityExpansion = 1 << 22
+
+var predefinedEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": "\"",
+}
+
+// declareEntities makes the decoder expand the internal entities of the
+// document type when required by the entity mode. In strict mode, the other
+// entities are declared to the decoder as their reference, to keep it as
+// text. It returns false if an entity expands beyond maxEntityExpansion.
+func (p *parser) declareEntities(doctype *Node) bool {
+	if doctype.decl.entities == nil {
+		return true
+	}
+	entities := doctype.decl.entities
+	for i := 0; i < entities.Length(); i++ {
+		e := entities.Item(i)
+		if _, ok := p.entities[e.nodeName]; ok {
+			continue
+		}
+		if p.opts.Entities == EntityText || e.decl.systemId != "" {
+			if p.opts.Strict {
+				p.entities[e.nodeName] = "&" + e.nodeName + ";"
+			}
+			continue
+		}
+		value := p.expandEntityValue(entities, e.decl.value, map[string]bool{e.nodeName: true})
+		if len(value) > maxEntityExpansion {
+			return false
+		}
+		p.entities[e.nodeName] = value
+	}
+	return true
+}
+
+// expandEntityValue replaces the references to internal entities in the
+// replacement text of an entity.
+func (p *parser) expandEntityValue(entities NamedNodeMap, value string, expanding map[string]bool) string {
+	var b strings.Builder
+	p.writeEntityValue(&b, entities, value, expanding)
+	return b.String()
+}
+
+// writeEntityValue writes the expansion of value to b. It stops once b holds
+// more than maxEntityExpansion bytes.
+func (p *parser) writeEntityValue(b *strings.Builder, entities NamedNodeMap, value string, expanding map[string]bool) {
+	for b.Len() <= maxEntityExpansion {
+		i := strings.IndexByte(value, '&')
+		if i < 0 {
+			b.WriteString(value)
+			return
+		}
+		end := strings.IndexByte(value[i:], ';')
+		if end < 0 {
+			b.WriteString(value)
+			return
+		}
+		name := value[i+1 : i+end]
+		b.WriteString(value[:i])
+		value = value[i+end+1:]
+		if v, ok := predefinedEntities[name]; ok {
+			b.WriteString(v)
+		} else if v, ok := p.opts.Entity[name]; ok {
+			b.WriteString(v)
+		} else if e := entities.GetNamedItem(name); e != nil && e.decl.systemId == "" && !expanding[name] {
+			expanding[name] = true
+			p.writeEntityValue(b, entities, e.decl.value, expanding)
+			delete(expanding, name)
+		} else {
+			b.WriteString("&" + name + ";")
+		}
+	}
+}
+
+// appendText appends the text in source, found at pos, to parent. In
+// EntityKeep mode, it creates entity reference nodes for the references to
+// entities that are not predefined. In EntityExpand mode, it replaces the
+// references to entities whose replacement text holds markup with the nodes
+// parsed from it.
+func (p *parser) appendText(parent *Node, source string, pos Position) {
+	raw := source
+	for raw != "" {
+		start, end := p.findReference(raw)
+		if start < 0 {
+			p.appendTextNode(parent, raw, pos)
+			return
+		}
+		if start > 0 {
+			p.appendTextNode(parent, raw[:start], pos)
+			pos = pos.advance(raw[:start])
+		}
+		if p.opts.Entities == EntityExpand {
+			p.appendExpansion(parent, raw[start+1:end-1])
+			pos = pos.advance(raw[start:end])
+			raw = raw[end:]
+			continue
+		}
+		ref := p.doc.newEntityReference(raw[start+1 : end-1])
+		ref.Raw = []string{raw[start:end]}
+		ref.ValueDirty = false
+		p.discardRaw(ref)
+		p.setSource(ref, pos, pos.advance(raw[start:end]))
+		parent.AppendChild(ref)
+		p.expandReference(ref)
+		pos = pos.advance(raw[start:end])
+		raw = raw[end:]
+	}
+}
+
+// appendExpansion appends to parent the nodes parsed from the replacement
+// text of the entity name.
+func (p *parser) appendExpansion(parent *Node, name string) {
+	ref := p.doc.newEntityReference(name)
+	p.expandReference(ref)
+	for len(ref.childNodes) > 0 {
+		parent.AppendChild(ref.childNodes[0])
+	}
+}
+
+// findReference returns the bounds of the first reference in s that
+// appendText handles, or -1.
+func (p *parser) findReference(s string) (start, end int) {
+	for offset := 0; ; {
+		start, end := findEntityRef(s[offset:])
+		if start < 0 {
+			return -1, -1
+		}
+		if p.opts.Entities != EntityExpand || p.expandsToMarkup(s[offset+start+1:offset+end-1]) {
+			return offset + start, offset + end
+		}
+		offset += end
+	}
+}
+
+// expandsToMarkup tells whether the replacement text of the internal entity
+// name holds markup.
+func (p *parser) expandsToMarkup(name string) bool {
+	if _, ok := p.opts.Entity[name]; ok {
+		return false
+	}
+	return strings.IndexByte(p.entities[name], '<') >= 0
+}
+
+// hasMarkupReference tells whether the text s references an entity whose
+// replacement text holds markup.
+func (p *parser) hasMarkupReference(s string) bool {
+	start, _ := p.findReference(s)
+	return start >= 0
+}
+
+// findEntityRef returns the bounds of the first reference to an entity that
+// is not predefined in s, or -1.
+func findEntityRef(s string) (start, end int) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '&' {
+			continue
+		}
+		j := strings.IndexByte(s[i:], ';')
+		if j < 0 {
+			break
+		}
+		name := s[i+1 : i+j]
+		if _, ok := predefinedEntities[name]; ok || strings.HasPrefix(name, "#") {
+			i += j
+			continue
+		}
+		return i, i + j + 1
+	}
+	return -1, -1
+}
+
+func (p *parser) appendTextNode(parent *Node, raw string, pos Position) {
+	n := p.doc.CreateTextNode(unescapeEntities(raw, p.entities))
+	n.Raw = append(n.Raw, raw)
+	n.ValueDirty = false
+	p.discardRaw(n)
+	p.setSource(n, pos, pos.advance(raw))
+	parent.AppendChild(n)
+}
+
+// expandReference creates the children of a parsed entity reference.
+func (p *parser) expandReference(ref *Node) {
+	name := ref.nodeName
+	if value, ok := p.opts.Entity[name]; ok {
+		ref.AppendChild(p.doc.CreateTextNode(value))
+		return
+	}
+	doctype := p.doc.Doctype()
+	if doctype == nil || p.expanding[name] || p.expansion > maxEntityExpansion {
+		return
+	}
+	e := doctype.decl.entities.GetNamedItem(name)
+	if e == nil || e.decl.systemId != "" {
+		return
+	}
+	if len(e.childNodes) == 0 && e.decl.value != "" {
+		p.expanding[name] = true
+		frag := p.doc.CreateDocumentFragment()
+		err := p.parse(strings.NewReader("<entity>"+e.decl.value+"</entity>"), frag)
+		delete(p.expanding, name)
+		if err != nil || len(frag.childNodes) == 0 {
+			return
+		}
+		for _, c := range frag.childNodes[0].childNodes {
+			e.AppendChild(c)
+		}
+	}
+	p.expansion += len(e.AsText())
+	if p.expansion > maxEntityExpansion {
+		return
+	}
+	for _, c := range e.childNodes {
+		ref.AppendChild(c.CloneNode(true))
+	}
+}
+
+func (d *Node) newEntityReference(name string) *Node {
+	return &Node{
+		nodeType:      EntityReferenceNode,
+		pos:           -1,
+		nodeName:      name,
+		nodeValue:     "",
+		ValueDirty:    false,
+		parentNode:    nil,
+		childNodes:    NodeList{},
+		ownerDocument: d.ownerDocument,
+		attributes:    nil,
+	}
+}
+
+// unescapeText returns the text value of XML source text without markup, as
+// the decoder would.
+func unescapeText(raw string) string {
+	return unescapeEntities(raw, nil)
+}
+
+// unescapeEntities returns the text value of XML source text without markup,
+// replacing the references to entities with their value in entities.
+func unescapeEntities(raw string, entities map[string]string) string {
+	raw = strings.Replace(raw, "\r\n", "\n", -1)
+	raw = strings.Replace(raw, "\r", "\n", -1)
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(raw, '&')
+		if i < 0 {
+			b.WriteString(raw)
+			return b.String()
+		}
+		end := strings.IndexByte(raw[i:], ';')
+		if end < 0 {
+			b.WriteString(raw)
+			return b.String()
+		}
+		b.WriteString(raw[:i])
+		name := raw[i+1 : i+end]
+		if v, ok := predefinedEntities[name]; ok {
+			b.WriteString(v)
+		} else if r, ok := parseCharRef(name); ok {
+			b.WriteRune(r)
+		} else if v, ok := entities[name]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(raw[i : i+end+1])
+		}
+		raw = raw[i+end+1:]
+	}
+}
+
+// parseCharRef parses the name part of a character reference, "#" followed
+// by a decimal or "x" and an hexadecimal code point.
+func parseCharRef(name string) (rune, bool) {
+	if !strings.HasPrefix(name, "#") {
+		return 0, false
+	}
+	var code uint64
+	var e error
+	if strings.HasPrefix(name, "#x") {
+		code, e = strconv.ParseUint(name[2:], 16, 32)
+	} else {
+		code, e = strconv.ParseUint(name[1:], 10, 32)
+	}
+	if e != nil {
+		return 0, false
+	}
+	return rune(code), true
+}
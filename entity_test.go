@@ -0,0 +1,164 @@
+package xmldom
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEntityModes(t *testing.T) {
+	src := `<!DOCTYPE a [
+<!ENTITY e "e&#x41;">
+<!ENTITY m "<b>&e;</b>">
+<!ENTITY ext SYSTEM "ext.xml">
+]><a x="&e;">&e; &m; &ext; &custom; &amp;</a>`
+	// the reference to m is replaced with the nodes parsed from its value
+	expanded := strings.Replace(src, "&m;", "<b>eA</b>", 1)
+	tests := []struct {
+		mode   EntityMode
+		entity map[string]string
+		text   string
+		attr   string
+		types  []NodeType
+		xml    string // empty if it is src
+	}{
+		{EntityText, nil, "&e; &m; &ext; &custom; &", "&e;", []NodeType{TextNode}, ""},
+		{EntityText, map[string]string{"custom": "C", "e": "E"}, "E &m; &ext; C &", "E", []NodeType{TextNode}, ""},
+		{EntityExpand, nil, "eA eA &ext; &custom; &", "eA", []NodeType{TextNode, ElementNode, TextNode}, expanded},
+		{EntityExpand, map[string]string{"custom": "C"}, "eA eA &ext; C &", "eA", []NodeType{TextNode, ElementNode, TextNode}, expanded},
+		{EntityKeep, nil, "eA eA   &", "eA", []NodeType{
+			EntityReferenceNode, TextNode, EntityReferenceNode, TextNode, EntityReferenceNode, TextNode, EntityReferenceNode, TextNode,
+		}, ""},
+		{EntityKeep, map[string]string{"custom": "<C>"}, "eA eA  <C> &", "eA", []NodeType{
+			EntityReferenceNode, TextNode, EntityReferenceNode, TextNode, EntityReferenceNode, TextNode, EntityReferenceNode, TextNode,
+		}, ""},
+	}
+	for _, test := range tests {
+		doc, err := ParseXMLWithEntities(strings.NewReader(src), test.mode, test.entity)
+		if err != nil {
+			t.Errorf("mode %d, %v: %v", test.mode, test.entity, err)
+			continue
+		}
+		a := doc.DocumentElement()
+		if text := a.AsText(); text != test.text {
+			t.Errorf("mode %d, %v: text %q, want %q", test.mode, test.entity, text, test.text)
+		}
+		if attr := a.GetAttribute("x"); attr != test.attr {
+			t.Errorf("mode %d, %v: attribute %q, want %q", test.mode, test.entity, attr, test.attr)
+		}
+		var types []NodeType
+		for c := a.FirstChild(); c != nil; c = c.NextSibling() {
+			types = append(types, c.NodeType())
+		}
+		if len(types) != len(test.types) {
+			t.Errorf("mode %d, %v: children %v, want %v", test.mode, test.entity, types, test.types)
+		} else {
+			for i := range types {
+				if types[i] != test.types[i] {
+					t.Errorf("mode %d, %v: children %v, want %v", test.mode, test.entity, types, test.types)
+					break
+				}
+			}
+		}
+		want := test.xml
+		if want == "" {
+			want = src
+		}
+		if got := doc.XML(); got != want {
+			t.Errorf("mode %d, %v: XML() = %s", test.mode, test.entity, got)
+		}
+	}
+}
+
+func TestEntityReferenceChildren(t *testing.T) {
+	doc, err := ParseXMLWithEntities(strings.NewReader(`<!DOCTYPE a [<!ENTITY m "x<b>y</b>">]><a>&m;&m;</a>`), EntityKeep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := doc.DocumentElement()
+	first, second := a.FirstChild(), a.LastChild()
+	if first.NodeName() != "m" || len(first.ChildNodes()) != 2 || first.LastChild().NodeName() != "b" {
+		t.Fatalf("reference %s with children %s", first.NodeName(), first.ChildNodes())
+	}
+	if first.FirstChild() == second.FirstChild() {
+		t.Error("the references share their children")
+	}
+	if entity := doc.Doctype().Entities().GetNamedItem("m"); len(entity.ChildNodes()) != 2 {
+		t.Errorf("entity children %s", entity.ChildNodes())
+	}
+
+	ref, e := doc.CreateEntityReference("m")
+	if e != nil {
+		t.Fatal(e)
+	}
+	a.AppendChild(ref)
+	if ref.AsText() != "xy" || ref.FirstChild() == first.FirstChild() {
+		t.Errorf("created reference with children %s", ref.ChildNodes())
+	}
+	if got := a.XML(); got != "<a>&m;&m;&m;</a>" {
+		t.Errorf("XML() = %s", got)
+	}
+}
+
+func TestCreateEntityReferenceUnreferenced(t *testing.T) {
+	src := `<!DOCTYPE a [<!ENTITY t "T"><!ENTITY e "v<b/>&t;">]><a/>`
+	for _, mode := range []EntityMode{EntityText, EntityExpand, EntityKeep} {
+		doc, err := ParseXMLWithEntities(strings.NewReader(src), mode, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, e := doc.CreateEntityReference("e")
+		if e != nil {
+			t.Fatal(e)
+		}
+		var children []string
+		for _, c := range ref.ChildNodes() {
+			children = append(children, c.NodeName())
+		}
+		if got := strings.Join(children, " "); got != "#text b t" || ref.AsText() != "vT" {
+			t.Errorf("mode %d: children %s, text %q", mode, got, ref.AsText())
+		}
+		if entity := doc.Doctype().Entities().GetNamedItem("e"); len(entity.ChildNodes()) != 3 {
+			t.Errorf("mode %d: entity children %s", mode, entity.ChildNodes())
+		}
+	}
+}
+
+func TestEntityExpandMarkup(t *testing.T) {
+	src := `<!DOCTYPE a [<!ENTITY t "T"><!ENTITY m "<b>x</b>&t;">]><a>&t; &m;&amp;</a>`
+	doc, err := ParseXMLWithEntities(strings.NewReader(src), EntityExpand, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := doc.DocumentElement()
+	var children []string
+	for _, c := range a.ChildNodes() {
+		children = append(children, c.NodeName()+"="+c.AsText())
+	}
+	if got := strings.Join(children, " "); got != "#text=T  b=x #text=T #text=&" {
+		t.Errorf("children %s", got)
+	}
+	a.FirstChild().AppendData("!")
+	if got := a.XML(); got != "<a>T !<b>x</b>T&amp;</a>" {
+		t.Errorf("XML() after an edit = %s", got)
+	}
+}
+
+func TestEntityExpansionLimit(t *testing.T) {
+	// each entity expands to 4 times the previous one
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE a [<!ENTITY e0 "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx">`)
+	for i := 1; i < 20; i++ {
+		fmt.Fprintf(&b, `<!ENTITY e%d "%s">`, i, strings.Repeat(fmt.Sprintf("&e%d;", i-1), 4))
+	}
+	b.WriteString(`]><a>&e19;</a>`)
+	for _, mode := range []EntityMode{EntityExpand, EntityKeep} {
+		_, err := ParseXMLWithEntities(strings.NewReader(b.String()), mode, nil)
+		if err == nil || !strings.Contains(err.Error(), "entity expansion limit") {
+			t.Errorf("mode %d: %v", mode, err)
+		}
+	}
+	if _, err := ParseXMLWithEntities(strings.NewReader(b.String()), EntityText, nil); err != nil {
+		t.Errorf("mode %d: %v", EntityText, err)
+	}
+}
@@ -30,6 +30,18 @@ func (e *DOMError) Error() string {
 		return fmt.Sprintf("Error, not supported")
 	case InuseAttributeError:
 		return fmt.Sprintf("Error, node already in use")
+	case InvalidStateError:
+		return fmt.Sprintf("Error, invalid state")
+	case SyntaxError:
+		return fmt.Sprintf("Error, syntax")
+	case InvalidModificationError:
+		return fmt.Sprintf("Error, invalid modification")
+	case NamespaceError:
+		return fmt.Sprintf("Error, namespace")
+	case InvalidAccessError:
+		return fmt.Sprintf("Error, invalid access")
+	case InvalidNodeTypeError:
+		return fmt.Sprintf("Error, invalid node type")
 	default:
 		return fmt.Sprintf("Error code %d", e.code)
 	}
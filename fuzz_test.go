@@ -0,0 +1,45 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+var fuzzOptions = []*ParseOptions{
+	nil,
+	{Strict: true},
+	{Entities: EntityExpand, CDATASections: true},
+	{Entities: EntityKeep, CoalesceCDATA: true},
+	{StripWhitespace: true, DiscardComments: true, DiscardProcInsts: true, DiscardRaw: true},
+}
+
+// FuzzParseXML checks that the parser returns an error instead of panicking
+// on malformed documents, and that the documents it accepts can be
+// serialized. Well-formed documents must be serialized as they were parsed,
+// without diagnostics. The seed corpus is in testdata/fuzz/FuzzParseXML.
+func FuzzParseXML(f *testing.F) {
+	f.Add(`<?xml version="1.0"?><a x="1"><b>text</b><!-- c --></a>`)
+	f.Fuzz(func(t *testing.T, src string) {
+		for _, opts := range fuzzOptions {
+			doc, err := ParseXMLWithOptions(strings.NewReader(src), opts)
+			if err != nil {
+				if _, ok := err.(*ParseError); !ok {
+					t.Errorf("ParseXMLWithOptions(%q, %+v) returned %T, want *ParseError", src, opts, err)
+				}
+				continue
+			}
+			doc.XML()
+		}
+		_, strictErr := ParseXMLWithOptions(strings.NewReader(src), &ParseOptions{Strict: true})
+		doc, diagnostics, err := ParseXMLRecover(strings.NewReader(src), nil)
+		if strictErr != nil || err != nil {
+			return
+		}
+		if len(diagnostics) > 0 {
+			t.Errorf("ParseXMLRecover(%q) reported %v on a well-formed document", src, diagnostics)
+		}
+		if out := doc.XML(); out != src {
+			t.Errorf("ParseXMLRecover(%q).XML() = %q, want the source text", src, out)
+		}
+	})
+}
@@ -0,0 +1,297 @@
+package xmldom
+
+// History records the changes made to the trees of a document to undo and
+// redo them. The changes are grouped in transactions: a transaction is
+// opened by Begin, or by the first change made while none is open, and closed
+// by Commit, Undo or Redo.
+//
+// Undo restores the nodes exactly as they were before the transaction,
+// including their Raw source text and ValueDirty, so that the document
+// serializes to the same bytes. The changes are reverted with the tree
+// operations, so iterators, ranges, live node lists and mutation observers
+// follow them.
+type History struct {
+	doc       *Node
+	undo      []transaction
+	redo      []transaction
+	open      transaction // changes of the open transaction
+	replaying bool        // reverting a transaction, the changes are not new edits
+	detached  bool
+}
+
+// transaction is a list of changes in the order they were made.
+type transaction []edit
+
+// edit is a change recorded in a history. revert undoes it with changes that
+// are recorded in turn, to redo it.
+type edit interface {
+	revert() Error
+}
+
+// CreateHistory returns a history recording the changes made to the trees of
+// the document from now on, until Detach is called. A document records one
+// history at a time: the previous one is detached.
+func (d *Node) CreateHistory() *History {
+	h := &History{doc: d.ownerDocument}
+	if state := d.ownerDocument.state; state != nil {
+		if state.history != nil {
+			state.history.detached = true
+		}
+		state.history = h
+	}
+	return h
+}
+
+// Begin commits the open transaction, so that the following changes are
+// grouped in a new one.
+func (h *History) Begin() {
+	h.Commit()
+}
+
+// Commit closes the open transaction, which can then be undone.
+func (h *History) Commit() {
+	if len(h.open) > 0 {
+		h.undo = append(h.undo, h.open)
+	}
+	h.open = nil
+}
+
+// CanUndo tells if there is a transaction to undo, open or not.
+func (h *History) CanUndo() bool {
+	return len(h.undo) > 0 || len(h.open) > 0
+}
+
+// CanRedo tells if there is an undone transaction to redo.
+func (h *History) CanRedo() bool {
+	return len(h.redo) > 0
+}
+
+// Undo commits the open transaction and reverts the last transaction. It
+// returns InvalidStateError if there is none or if the history is detached.
+func (h *History) Undo() Error {
+	h.Commit()
+	if h.detached || len(h.undo) == 0 {
+		return err(InvalidStateError)
+	}
+	t := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	reverted, e := h.replay(t)
+	if e != nil {
+		return e
+	}
+	h.redo = append(h.redo, reverted)
+	return nil
+}
+
+// Redo commits the open transaction and applies again the last transaction
+// undone. It returns InvalidStateError if there is none or if the history is
+// detached. New changes drop the transactions to redo.
+func (h *History) Redo() Error {
+	h.Commit()
+	if h.detached || len(h.redo) == 0 {
+		return err(InvalidStateError)
+	}
+	t := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	reverted, e := h.replay(t)
+	if e != nil {
+		return e
+	}
+	h.undo = append(h.undo, reverted)
+	return nil
+}
+
+// replay reverts the changes of t and returns the transaction reverting them
+// back. The history is cleared if a change cannot be reverted, as the
+// document no longer matches it.
+func (h *History) replay(t transaction) (transaction, Error) {
+	h.replaying = true
+	defer func() {
+		h.replaying = false
+		h.open = nil
+	}()
+	for i := len(t) - 1; i >= 0; i-- {
+		if e := t[i].revert(); e != nil {
+			h.Clear()
+			return nil, e
+		}
+	}
+	return h.open, nil
+}
+
+// Clear drops the transactions to undo and redo, and the open one.
+func (h *History) Clear() {
+	h.undo = nil
+	h.redo = nil
+	h.open = nil
+}
+
+// Detach stops recording the changes and clears the history.
+func (h *History) Detach() {
+	h.Clear()
+	h.detached = true
+	if state := h.doc.state; state != nil && state.history == h {
+		state.history = nil
+	}
+}
+
+// history returns the history recording the changes of the document, or nil.
+func (d *Node) history() *History {
+	if d == nil || d.state == nil {
+		return nil
+	}
+	return d.state.history
+}
+
+// record adds a change to the open transaction.
+func (h *History) record(e edit) {
+	if !h.replaying {
+		h.redo = nil
+	}
+	h.open = append(h.open, e)
+}
+
+// changing records the fields of n before they are changed by an edit other
+// than a tree operation.
+func (n *Node) changing() {
+	if h := n.ownerDocument.history(); h != nil {
+		h.record(n.fields())
+	}
+}
+
+// nodeFields are the fields of a node changed by edits other than the tree
+// operations.
+type nodeFields struct {
+	node                                   *Node
+	nodeName, prefix, localName, nodeValue string
+	valueDirty, nsDirty                    bool
+	raw                                    []string
+}
+
+func (n *Node) fields() nodeFields {
+	return nodeFields{
+		node:       n,
+		nodeName:   n.nodeName,
+		prefix:     n.prefix,
+		localName:  n.localName,
+		nodeValue:  n.nodeValue,
+		valueDirty: n.ValueDirty,
+		nsDirty:    n.nsDirty,
+		raw:        n.Raw,
+	}
+}
+
+func (f nodeFields) revert() Error {
+	n := f.node
+	d := n.ownerDocument
+	n.changing()
+	if f.nodeValue != n.nodeValue {
+		if n.isCharacterData() {
+			d.replacingData(n, 0, n.Length(), utf16Length(f.nodeValue))
+		}
+		n.queueValue()
+	}
+	n.ownerElement.attributeRemoved(n)
+	n.nodeName, n.prefix, n.localName = f.nodeName, f.prefix, f.localName
+	n.nodeValue, n.ValueDirty, n.nsDirty = f.nodeValue, f.valueDirty, f.nsDirty
+	n.Raw = f.raw
+	n.ownerElement.attributeAdded(n)
+	d.treeChanged()
+	return nil
+}
+
+// insertion records a node inserted in the children of parent.
+type insertion struct {
+	parent, node *Node
+}
+
+func (e insertion) revert() Error {
+	n := e.parent
+	if e.node.parentNode != n {
+		return err(NotFoundError)
+	}
+	prev, next := e.node.PreviousSibling(), e.node.NextSibling()
+	n.remove(e.node)
+	n.ownerDocument.queueChildList(n, nil, NodeList{e.node}, prev, next)
+	return nil
+}
+
+// removal records a node removed from the children of parent at index.
+type removal struct {
+	parent, node *Node
+	index        int
+	nsDirty      bool
+}
+
+func (e removal) revert() Error {
+	n := e.parent
+	if e.index > len(n.childNodes) {
+		return err(IndexSizeError)
+	}
+	var refChild *Node
+	if e.index < len(n.childNodes) {
+		refChild = n.childNodes[e.index]
+	}
+	if _, err := n.insertNodes(NodeList{e.node}, refChild); err != nil {
+		return err
+	}
+	// attaching the node marked it for namespace fix up
+	e.node.nsDirty = e.nsDirty
+	n.ownerDocument.queueChildList(n, NodeList{e.node}, nil, e.node.PreviousSibling(), refChild)
+	return nil
+}
+
+// attributeList records the attributes of a named node map before a change.
+type attributeList struct {
+	nm    *namedNodeMap
+	nodes NodeList
+	index map[string]int
+}
+
+func (nm *namedNodeMap) changing() {
+	if h := nm.document.history(); h != nil {
+		h.record(nm.list())
+	}
+}
+
+func (nm *namedNodeMap) list() attributeList {
+	index := make(map[string]int, len(nm.index))
+	for k, v := range nm.index {
+		index[k] = v
+	}
+	return attributeList{nm, append(NodeList{}, nm.nodes...), index}
+}
+
+func (l attributeList) revert() Error {
+	nm := l.nm
+	nm.changing()
+	for _, a := range nm.nodes {
+		if !hasNode(l.nodes, a) {
+			nm.document.queueAttribute(nm.owner, a, a.nodeValue)
+			nm.owner.attributeRemoved(a)
+			a.ownerElement = nil
+		}
+	}
+	var added NodeList
+	for _, a := range l.nodes {
+		if !hasNode(nm.nodes, a) {
+			nm.document.queueAttribute(nm.owner, a, "")
+			added = append(added, a)
+		}
+	}
+	nm.nodes, nm.index = l.nodes, l.index
+	for _, a := range added {
+		a.ownerElement = nm.owner
+		nm.owner.attributeAdded(a)
+	}
+	return nil
+}
+
+func hasNode(list NodeList, n *Node) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
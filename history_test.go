@@ -0,0 +1,126 @@
+package xmldom
+
+import (
+	"testing"
+)
+
+const historyDocument = `<?xml version="1.0"?>
+<root xmlns:p="urn:p"  a = 'x&amp;y' >
+  <p:item xml:id="i1">one &amp; <b>two</b></p:item>
+  <item xml:id = "i2" ><![CDATA[three]]></item>
+  <!-- comment -->
+  <empty  />
+</root>`
+
+func TestHistoryUndoRedo(t *testing.T) {
+	doc := parseTraversal(t, historyDocument)
+	root := doc.DocumentElement()
+	pItem, b := element(doc, "p:item"), element(doc, "b")
+	h := doc.CreateHistory()
+	edits := []func(){
+		func() { root.SetAttribute("a", "changed") },
+		func() {
+			root.SetAttribute("new", "1")
+			root.RemoveAttribute("a")
+		},
+		func() { text(root).SetNodeValue("1 ") },
+		func() { text(root).AppendData("more") },
+		func() {
+			item := element(doc, "item")
+			root.InsertBefore(item, root.FirstChild())
+			item.SetAttribute("xml:id", "i3")
+		},
+		func() {
+			fragment := doc.CreateDocumentFragment()
+			e, _ := doc.CreateElementNS("urn:q", "q:e")
+			fragment.AppendChild(e)
+			fragment.AppendChild(doc.CreateTextNode("tail"))
+			root.InsertBefore(fragment, element(doc, "empty"))
+		},
+		func() { doc.NormalizeDocument() },
+		func() { text(b).SplitText(1) },
+		func() { b.Normalize() },
+		func() { pItem.SetPrefix("") },
+		func() { root.ReplaceChild(doc.CreateComment("replaced"), element(doc, "empty")) },
+		func() {
+			r := doc.CreateRange()
+			r.SetStart(text(pItem), 2)
+			r.SetEnd(text(b), 1)
+			r.DeleteContents()
+			r.Detach()
+		},
+		func() { doc.RemoveChild(root) },
+	}
+	states := []string{doc.XML()}
+	for _, edit := range edits {
+		h.Begin()
+		edit()
+		h.Commit()
+		states = append(states, doc.XML())
+	}
+	for i := len(edits) - 1; i >= 0; i-- {
+		if e := h.Undo(); e != nil {
+			t.Fatalf("undo %d: %v", i, e)
+		}
+		if doc.XML() != states[i] {
+			t.Errorf("undo %d: document\n%s\nwant\n%s", i, doc.XML(), states[i])
+		}
+	}
+	if h.CanUndo() || h.Undo() == nil {
+		t.Error("undo with no transaction")
+	}
+	if doc.GetElementById("i2") == nil || doc.GetElementById("i3") != nil {
+		t.Error("IDs not restored")
+	}
+	for i := 1; i <= len(edits); i++ {
+		if e := h.Redo(); e != nil {
+			t.Fatalf("redo %d: %v", i, e)
+		}
+		if doc.XML() != states[i] {
+			t.Errorf("redo %d: document\n%s\nwant\n%s", i, doc.XML(), states[i])
+		}
+	}
+	if h.CanRedo() || h.Redo() == nil {
+		t.Error("redo with no transaction")
+	}
+}
+
+func TestHistoryTransactions(t *testing.T) {
+	doc := parseTraversal(t, `<a x="1"><b>text</b></a>`)
+	a := doc.DocumentElement()
+	h := doc.CreateHistory()
+	src := doc.XML()
+
+	// Changes outside Begin are grouped until the next Commit.
+	a.SetAttribute("x", "2")
+	text(a).SetNodeValue("changed")
+	if !h.CanUndo() {
+		t.Fatal("nothing to undo")
+	}
+	o := NewMutationObserver(nil)
+	o.Observe(a, MutationObserverInit{AttributeOldValue: true, CharacterDataOldValue: true, Subtree: true})
+	h.Undo()
+	if doc.XML() != src {
+		t.Errorf("document %s after undo, want %s", doc.XML(), src)
+	}
+	if got, want := describe(o.TakeRecords()), `characterData "text" "changed"`+"\n"+`attributes a x "2"`; got != want {
+		t.Errorf("records of the undo:\n%s\nwant:\n%s", got, want)
+	}
+	o.Disconnect()
+
+	// A new change drops the transactions to redo.
+	a.SetAttribute("y", "3")
+	if h.CanRedo() || h.Redo() == nil {
+		t.Error("redo after a new change")
+	}
+	h.Undo()
+
+	h.Detach()
+	a.SetAttribute("z", "4")
+	if h.CanUndo() || h.Undo() == nil {
+		t.Error("undo after Detach")
+	}
+	if doc.state.history != nil {
+		t.Error("history recording after Detach")
+	}
+}
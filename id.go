@@ -0,0 +1,133 @@
+package xmldom
+
+// GetElementById returns the element with the given ID, or nil. Attributes
+// named xml:id and attributes declared with the ID type in the internal subset
+// of the document type declaration are IDs. If several elements share the
+// same ID, the first one indexed is returned.
+func (d *Node) GetElementById(id string) *Node {
+	if d.state == nil {
+		return nil
+	}
+	if elements := d.state.ids[id]; len(elements) > 0 {
+		return elements[0]
+	}
+	return nil
+}
+
+// IsId tells if the attribute is an ID of its element.
+func (a *Node) IsId() bool {
+	if a.nodeType != AttributeNode {
+		return false
+	}
+	if a.nodeName == "xml:id" || (a.namespaceURI == XMLNamespace && a.localName == "id") {
+		return true
+	}
+	e := a.ownerElement
+	if e == nil || e.ownerDocument == nil || e.ownerDocument.state == nil {
+		return false
+	}
+	return e.ownerDocument.state.idAttributes[e.nodeName] == a.nodeName
+}
+
+// declareIdAttributes registers the attributes declared with the ID type in
+// the internal subset of a document type declaration.
+func (d *Node) declareIdAttributes(internalSubset string) {
+	for _, decl := range parseMarkupDecls(internalSubset) {
+		for _, ad := range decl.attributeDecls() {
+			if ad.attType != "ID" {
+				continue
+			}
+			if d.state.idAttributes == nil {
+				d.state.idAttributes = map[string]string{}
+			}
+			if _, ok := d.state.idAttributes[ad.element]; !ok {
+				d.state.idAttributes[ad.element] = ad.name
+			}
+		}
+	}
+}
+
+// isConnected tells if the node is in the tree of its document.
+func (n *Node) isConnected() bool {
+	root := n
+	if root.nodeType == AttributeNode && root.ownerElement != nil {
+		root = root.ownerElement
+	}
+	for root.parentNode != nil {
+		root = root.parentNode
+	}
+	return root == n.ownerDocument
+}
+
+// indexIds adds the IDs of the element and its descendants to the index of
+// the document.
+func (n *Node) indexIds() {
+	if n.nodeType == ElementNode {
+		for i := 0; i < n.attributes.Length(); i++ {
+			n.indexId(n.attributes.Item(i))
+		}
+	}
+	for _, c := range n.childNodes {
+		c.indexIds()
+	}
+}
+
+// unindexIds removes the IDs of the element and its descendants from the
+// index of the document.
+func (n *Node) unindexIds() {
+	if n.nodeType == ElementNode {
+		for i := 0; i < n.attributes.Length(); i++ {
+			a := n.attributes.Item(i)
+			n.unindexId(a, a.nodeValue)
+		}
+	}
+	for _, c := range n.childNodes {
+		c.unindexIds()
+	}
+}
+
+func (e *Node) indexId(a *Node) {
+	state := e.ownerDocument.state
+	if state == nil || !a.IsId() {
+		return
+	}
+	if state.ids == nil {
+		state.ids = map[string]NodeList{}
+	}
+	state.ids[a.nodeValue] = append(state.ids[a.nodeValue], e)
+}
+
+func (e *Node) unindexId(a *Node, value string) {
+	state := e.ownerDocument.state
+	if state == nil || !a.IsId() {
+		return
+	}
+	elements := state.ids[value]
+	for i, el := range elements {
+		if el == e {
+			elements = append(elements[:i:i], elements[i+1:]...)
+			break
+		}
+	}
+	if len(elements) == 0 {
+		delete(state.ids, value)
+	} else {
+		state.ids[value] = elements
+	}
+}
+
+// attributeAdded updates the ID index when an attribute is set on an element.
+func (e *Node) attributeAdded(a *Node) {
+	if e != nil && a.IsId() && e.isConnected() {
+		e.indexId(a)
+	}
+}
+
+// attributeRemoved updates the ID index when an attribute is removed from an
+// element. It must be called while the attribute is still owned by the
+// element.
+func (e *Node) attributeRemoved(a *Node) {
+	if e != nil && a.IsId() && e.isConnected() {
+		e.unindexId(a, a.nodeValue)
+	}
+}
@@ -0,0 +1,71 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+const idDocument = `<!DOCTYPE r [<!ATTLIST e id ID #IMPLIED>]>
+<r><e id="a"><e id="b"/></e><f xml:id="c"/><f id="d"/></r>`
+
+func TestGetElementById(t *testing.T) {
+	tests := []struct {
+		what string
+		edit func(doc *Node)
+		want map[string]string // name and id attribute of the element found by ID
+	}{
+		{"parsed", func(doc *Node) {}, map[string]string{"a": "e a", "b": "e b", "c": "f", "d": ""}},
+		{"SetAttribute", func(doc *Node) {
+			doc.GetElementById("a").SetAttribute("id", "x")
+		}, map[string]string{"a": "", "x": "e x", "b": "e b"}},
+		{"SetAttribute undeclared", func(doc *Node) {
+			element(doc, "f").SetAttribute("id", "y")
+		}, map[string]string{"y": "", "c": "f y"}},
+		{"SetAttribute xml:id", func(doc *Node) {
+			doc.GetElementById("c").SetAttributeNS(XMLNamespace, "xml:id", "z")
+		}, map[string]string{"c": "", "z": "f"}},
+		{"RemoveAttribute", func(doc *Node) {
+			doc.GetElementById("b").RemoveAttribute("id")
+		}, map[string]string{"a": "e a", "b": ""}},
+		{"RemoveChild", func(doc *Node) {
+			a := doc.GetElementById("a")
+			a.ParentNode().RemoveChild(a)
+		}, map[string]string{"a": "", "b": "", "c": "f"}},
+		{"ReplaceChild", func(doc *Node) {
+			a := doc.GetElementById("a")
+			e, _ := doc.CreateElement("e")
+			e.SetAttribute("id", "n")
+			a.ParentNode().ReplaceChild(e, a)
+		}, map[string]string{"a": "", "b": "", "n": "e n"}},
+		{"AppendChild", func(doc *Node) {
+			e, _ := doc.CreateElement("e")
+			e.SetAttribute("id", "n")
+			doc.GetElementById("c").AppendChild(e)
+		}, map[string]string{"n": "e n"}},
+		{"detached", func(doc *Node) {
+			e, _ := doc.CreateElement("e")
+			e.SetAttribute("id", "n")
+		}, map[string]string{"n": ""}},
+		{"duplicate", func(doc *Node) {
+			doc.GetElementById("b").SetAttribute("id", "a")
+		}, map[string]string{"a": "e a", "b": ""}},
+		{"duplicate removed", func(doc *Node) {
+			b := doc.GetElementById("b")
+			b.SetAttribute("id", "a")
+			doc.DocumentElement().RemoveChild(b.ParentNode())
+		}, map[string]string{"a": ""}},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, idDocument)
+		test.edit(doc)
+		for id, want := range test.want {
+			got := ""
+			if e := doc.GetElementById(id); e != nil {
+				got = strings.TrimSpace(e.nodeName + " " + e.GetAttribute("id"))
+			}
+			if got != want {
+				t.Errorf("%s: GetElementById(%q) = %q, want %q", test.what, id, got, want)
+			}
+		}
+	}
+}
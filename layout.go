@@ -0,0 +1,245 @@
+package xmldom
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+func (s *Serializer) indentUnit() string {
+	switch {
+	case s.Indent != "":
+		return s.Indent
+	case s.unit != "":
+		return s.unit
+	default:
+		return "  "
+	}
+}
+
+// inferIndentUnit finds the indentation of one level in the children of an
+// element whose line is indented with indent, for ReformatDirty.
+func (s *Serializer) inferIndentUnit(n *Node, indent string) {
+	if childIndent, ok := siblingIndentation(n); ok && len(childIndent) > len(indent) && strings.HasPrefix(childIndent, indent) {
+		s.unit = childIndent[len(indent):]
+	}
+}
+
+// siblingIndentation returns the indentation of the parsed children of an
+// element on their own line.
+func siblingIndentation(n *Node) (string, bool) {
+	for _, c := range n.childNodes {
+		if isWhitespaceText(c) && !isDirty(c) {
+			if next := c.NextSibling(); next != nil && !isDirty(next) {
+				space := c.XML()
+				if i := strings.LastIndexByte(space, '\n'); i >= 0 {
+					return space[i+1:], true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// newline starts a new line at indent, unless whitespace is not added.
+func (s *Serializer) newline(indent string) {
+	if s.Mode != Minify && s.inline == 0 {
+		s.write("\n" + indent)
+	}
+}
+
+// layout writes a node laid out for the Pretty or Minify modes, or a node
+// created or modified after parsing in ReformatDirty mode. indent is the
+// indentation of the line of the node.
+func (s *Serializer) layout(n *Node, indent string) {
+	switch n.nodeType {
+	case DocumentNode, DocumentFragmentNode:
+		first := true
+		for _, c := range n.childNodes {
+			if isWhitespaceText(c) {
+				continue
+			}
+			if !first {
+				s.newline(indent)
+			}
+			s.layout(c, indent)
+			first = false
+		}
+	case ElementNode:
+		s.layoutElement(n, indent)
+	default:
+		s.node(n)
+	}
+}
+
+func (s *Serializer) layoutElement(n *Node, indent string) {
+	s.write("<" + n.nodeName)
+	s.layoutAttributes(n, indent)
+	if preserveSpace(n) {
+		if len(n.childNodes) == 0 {
+			s.write("/>")
+			return
+		}
+		s.write(">")
+		for _, c := range n.childNodes {
+			s.node(c)
+		}
+		s.write("</" + n.nodeName + ">")
+		return
+	}
+	mixed := hasMixedContent(n)
+	strip := !mixed && (s.Mode == Minify || s.inline == 0)
+	var children NodeList
+	for _, c := range n.childNodes {
+		if !strip || !isWhitespaceText(c) {
+			children = append(children, c)
+		}
+	}
+	if len(children) == 0 {
+		s.write("/>")
+		return
+	}
+	s.write(">")
+	if mixed {
+		s.inline++
+		for _, c := range children {
+			s.layout(c, "")
+		}
+		s.inline--
+	} else {
+		childIndent := indent + s.indentUnit()
+		for _, c := range children {
+			s.newline(childIndent)
+			s.layout(c, childIndent)
+		}
+		s.newline(indent)
+	}
+	s.write("</" + n.nodeName + ">")
+}
+
+func (s *Serializer) layoutAttributes(n *Node, indent string) {
+	var values []string
+	length := len(indent) + len(n.nodeName) + 2
+	for i := 0; i < n.attributes.Length(); i++ {
+		a := n.attributes.Item(i)
+		v := attributeValue(a)
+		values = append(values, v)
+		length += len(a.nodeName) + len(v) + 2
+	}
+	wrap := s.WrapAttributes && s.Mode != Minify && s.inline == 0 && len(values) > 1 &&
+		(s.LineWidth == 0 || length > s.LineWidth)
+	for i, v := range values {
+		if wrap {
+			s.write("\n" + indent + s.indentUnit())
+		} else {
+			s.write(" ")
+		}
+		s.write(n.attributes.Item(i).nodeName + "=")
+		s.writeText(v)
+	}
+}
+
+// attributeValue returns the quoted value of an attribute as written in a
+// start tag, with its source text if it was not modified.
+func attributeValue(a *Node) string {
+	if len(a.Raw) >= 5 && !a.ValueDirty {
+		quote := a.Raw[4]
+		if (quote == "\"" || quote == "'") && strings.HasSuffix(a.Raw[2], quote) {
+			return quote + a.Raw[3] + quote
+		}
+	}
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(a.nodeValue))
+	return "\"" + b.String() + "\""
+}
+
+// reformatChildren writes the children of an element with element content,
+// laying out those created or modified after parsing like their siblings. indent is the
+// indentation of the line of the element.
+func (s *Serializer) reformatChildren(n *Node, indent string) {
+	childIndent, ok := siblingIndentation(n)
+	if !ok {
+		childIndent = indent + s.indentUnit()
+	}
+	for _, c := range n.childNodes {
+		if isWhitespaceText(c) {
+			if next := c.NextSibling(); next != nil && isDirty(next) {
+				// keep the line breaks and indent the next node
+				space := c.XML()
+				if i := strings.LastIndexByte(space, '\n'); i >= 0 {
+					s.write(space[:i+1] + childIndent)
+				} else {
+					s.write("\n" + childIndent)
+				}
+			} else {
+				s.node(c)
+			}
+			continue
+		}
+		if !isDirty(c) {
+			s.node(c)
+			continue
+		}
+		if prev := c.PreviousSibling(); prev == nil || !isWhitespaceText(prev) {
+			s.write("\n" + childIndent)
+		}
+		s.layout(c, childIndent)
+		if next := c.NextSibling(); next == nil {
+			s.write("\n" + indent)
+		} else if !isWhitespaceText(next) {
+			s.write("\n" + childIndent)
+		}
+	}
+}
+
+// isDirty tells whether a node was created or modified after parsing, so that
+// it is not written as its source text.
+func isDirty(n *Node) bool {
+	switch {
+	case len(n.Raw) == 0 || n.ValueDirty:
+		return true
+	case n.nodeType == ElementNode:
+		// renamed
+		return len(n.Raw) < 2 || n.Raw[1] != n.nodeName
+	}
+	return false
+}
+
+func hasDirtyChild(n *Node) bool {
+	for _, c := range n.childNodes {
+		if isDirty(c) && !isWhitespaceText(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWhitespaceText(n *Node) bool {
+	return n.nodeType == TextNode && isWhitespace(n.nodeValue)
+}
+
+// hasMixedContent tells whether the children of an element include text that
+// is not only whitespace.
+func hasMixedContent(n *Node) bool {
+	for _, c := range n.childNodes {
+		switch c.nodeType {
+		case TextNode:
+			if !isWhitespace(c.nodeValue) {
+				return true
+			}
+		case CDATASectionNode, EntityReferenceNode:
+			return true
+		}
+	}
+	return false
+}
+
+// preserveSpace tells whether xml:space="preserve" applies to an element.
+func preserveSpace(n *Node) bool {
+	for e := n; e != nil && e.nodeType == ElementNode; e = e.parentNode {
+		if a := e.GetAttributeNodeNS(XMLNamespace, "space"); a != nil {
+			return a.nodeValue == "preserve"
+		}
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package xmldom
+
+// MutationType is the kind of change a MutationRecord describes.
+type MutationType uint
+
+const (
+	// ChildListMutation records children added to or removed from a node.
+	ChildListMutation MutationType = iota + 1
+	// AttributesMutation records an attribute set, changed or removed.
+	AttributesMutation
+	// CharacterDataMutation records a change to the data of a text, CDATA
+	// section, comment or processing instruction node.
+	CharacterDataMutation
+)
+
+// MutationRecord describes a change to a tree.
+type MutationRecord struct {
+	Type MutationType
+	// Target is the node whose children changed, the element of the
+	// attribute or the node whose data changed.
+	Target *Node
+	// AddedNodes, RemovedNodes and their siblings are set for
+	// ChildListMutation.
+	AddedNodes      NodeList
+	RemovedNodes    NodeList
+	PreviousSibling *Node
+	NextSibling     *Node
+	// AttributeName is the local name of the attribute, or its name for
+	// attributes created without namespace.
+	AttributeName      string
+	AttributeNamespace string
+	// OldValue is the value of the attribute or the data before the change,
+	// if the observer asked for it. It is empty for added attributes.
+	OldValue string
+}
+
+// MutationObserverInit selects the changes a MutationObserver records.
+type MutationObserverInit struct {
+	ChildList     bool
+	Attributes    bool
+	CharacterData bool
+	// Subtree records the changes to the descendants of the target too.
+	Subtree bool
+	// AttributeOldValue and CharacterDataOldValue record the values before
+	// the changes, and imply Attributes and CharacterData.
+	AttributeOldValue     bool
+	CharacterDataOldValue bool
+	// AttributeFilter restricts the attributes recorded to these local
+	// names, without namespace. It implies Attributes.
+	AttributeFilter []string
+}
+
+// MutationObserver records the changes made to the trees it observes. The
+// records are delivered in batches to its callback when
+// DeliverMutationRecords is called on the document, or taken with
+// TakeRecords.
+type MutationObserver struct {
+	callback func(records []*MutationRecord, observer *MutationObserver)
+	records  []*MutationRecord
+	nodes    []*Node // nodes the observer is registered on, transiently or not
+}
+
+// registration is the registration of an observer on a node. Transient
+// registrations are added to the nodes removed from an observed subtree, so
+// that the changes made to them are recorded until the next delivery.
+type registration struct {
+	observer  *MutationObserver
+	options   MutationObserverInit
+	transient bool
+}
+
+// NewMutationObserver returns an observer delivering its records to
+// callback.
+func NewMutationObserver(callback func(records []*MutationRecord, observer *MutationObserver)) *MutationObserver {
+	return &MutationObserver{callback: callback}
+}
+
+// Observe registers the observer on target, or changes its options if it is
+// already registered there. The document of target keeps the observer until
+// Disconnect is called.
+func (o *MutationObserver) Observe(target *Node, options MutationObserverInit) Error {
+	if options.AttributeOldValue || options.AttributeFilter != nil {
+		options.Attributes = true
+	}
+	if options.CharacterDataOldValue {
+		options.CharacterData = true
+	}
+	if !options.ChildList && !options.Attributes && !options.CharacterData {
+		return err(NotSupportedError)
+	}
+	state := target.ownerDocument.state
+	if state == nil {
+		return err(NotSupportedError)
+	}
+	if state.observers == nil {
+		state.observers = map[*Node][]*registration{}
+	}
+	for _, r := range state.observers[target] {
+		if r.observer == o && !r.transient {
+			r.options = options
+			return nil
+		}
+	}
+	state.observers[target] = append(state.observers[target], &registration{observer: o, options: options})
+	o.nodes = append(o.nodes, target)
+	return nil
+}
+
+// Disconnect unregisters the observer from all the nodes and drops its
+// records.
+func (o *MutationObserver) Disconnect() {
+	o.unregister(false)
+	o.nodes = nil
+	o.records = nil
+}
+
+// unregister removes the registrations of the observer, or only its transient
+// ones.
+func (o *MutationObserver) unregister(transientOnly bool) {
+	var nodes []*Node
+	seen := map[*Node]bool{}
+	for _, n := range o.nodes {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		state := n.ownerDocument.state
+		var kept []*registration
+		for _, r := range state.observers[n] {
+			if r.observer == o && (r.transient || !transientOnly) {
+				continue
+			}
+			kept = append(kept, r)
+			if r.observer == o {
+				nodes = append(nodes, n)
+			}
+		}
+		if len(kept) == 0 {
+			delete(state.observers, n)
+		} else {
+			state.observers[n] = kept
+		}
+	}
+	o.nodes = nodes
+}
+
+// TakeRecords returns the records not delivered yet and removes them from
+// the observer.
+func (o *MutationObserver) TakeRecords() []*MutationRecord {
+	records := o.records
+	o.records = nil
+	return records
+}
+
+// DeliverMutationRecords calls the callbacks of the observers that recorded
+// changes to the document since the previous delivery, with their records,
+// in the order they were first queued. Changes made by the callbacks are
+// delivered before it returns.
+func (d *Node) DeliverMutationRecords() {
+	state := d.state
+	if state == nil {
+		return
+	}
+	for len(state.pending) > 0 {
+		pending := state.pending
+		state.pending = nil
+		for _, o := range pending {
+			o.unregister(true)
+			if records := o.TakeRecords(); len(records) > 0 {
+				o.callback(records, o)
+			}
+		}
+	}
+}
+
+// queueMutation queues a copy of the record for the observers interested in
+// it, registered on the target or its ancestors. oldValue is set on the
+// records of the observers that asked for it.
+func (d *Node) queueMutation(record MutationRecord, oldValue string) {
+	var observers []*MutationObserver
+	var oldValues []bool
+	for n := record.Target; n != nil; n = n.parentNode {
+		for _, r := range d.state.observers[n] {
+			options := &r.options
+			switch {
+			case n != record.Target && !options.Subtree:
+			case record.Type == ChildListMutation && !options.ChildList:
+			case record.Type == CharacterDataMutation && !options.CharacterData:
+			case record.Type == AttributesMutation && !options.Attributes:
+			case record.Type == AttributesMutation && options.AttributeFilter != nil &&
+				(record.AttributeNamespace != "" || !hasString(options.AttributeFilter, record.AttributeName)):
+			default:
+				withOldValue := (record.Type == AttributesMutation && options.AttributeOldValue) ||
+					(record.Type == CharacterDataMutation && options.CharacterDataOldValue)
+				found := false
+				for i, o := range observers {
+					if o == r.observer {
+						oldValues[i] = oldValues[i] || withOldValue
+						found = true
+					}
+				}
+				if !found {
+					observers = append(observers, r.observer)
+					oldValues = append(oldValues, withOldValue)
+				}
+			}
+		}
+	}
+	for i, o := range observers {
+		r := record
+		if oldValues[i] {
+			r.OldValue = oldValue
+		}
+		o.records = append(o.records, &r)
+		queued := false
+		for _, p := range d.state.pending {
+			queued = queued || p == o
+		}
+		if !queued {
+			d.state.pending = append(d.state.pending, o)
+		}
+	}
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// observed tells if mutation observers are registered on the nodes of the
+// document.
+func (d *Node) observed() bool {
+	return d != nil && d.state != nil && len(d.state.observers) > 0
+}
+
+// queueChildList records the children added to or removed from target.
+func (d *Node) queueChildList(target *Node, added, removed NodeList, prev, next *Node) {
+	if d.observed() {
+		d.queueMutation(MutationRecord{
+			Type:            ChildListMutation,
+			Target:          target,
+			AddedNodes:      added,
+			RemovedNodes:    removed,
+			PreviousSibling: prev,
+			NextSibling:     next,
+		}, "")
+	}
+}
+
+// queueAttribute records a change to the attribute a of target.
+func (d *Node) queueAttribute(target, a *Node, oldValue string) {
+	if d.observed() && target != nil {
+		name := a.localName
+		if name == "" {
+			name = a.nodeName
+		}
+		d.queueMutation(MutationRecord{
+			Type:               AttributesMutation,
+			Target:             target,
+			AttributeName:      name,
+			AttributeNamespace: a.namespaceURI,
+		}, oldValue)
+	}
+}
+
+// queueValue records a change to the value of an attribute or to the data of
+// n, before it is made.
+func (n *Node) queueValue() {
+	if n.ownerElement != nil {
+		n.ownerDocument.queueAttribute(n.ownerElement, n, n.nodeValue)
+	} else if n.isCharacterData() || n.nodeType == ProcessingInstructionNode {
+		n.ownerDocument.queueCharacterData(n, n.nodeValue)
+	}
+}
+
+// queueCharacterData records a change to the data of target.
+func (d *Node) queueCharacterData(target *Node, oldValue string) {
+	if d.observed() {
+		d.queueMutation(MutationRecord{Type: CharacterDataMutation, Target: target}, oldValue)
+	}
+}
+
+// addTransientObservers registers the observers of the subtrees n is part of
+// on n before it is removed from its parent.
+func (d *Node) addTransientObservers(n *Node) {
+	if !d.observed() {
+		return
+	}
+	for a := n.parentNode; a != nil; a = a.parentNode {
+		for _, r := range d.state.observers[a] {
+			if r.options.Subtree {
+				d.state.observers[n] = append(d.state.observers[n], &registration{r.observer, r.options, true})
+				r.observer.nodes = append(r.observer.nodes, n)
+			}
+		}
+	}
+}
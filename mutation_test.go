@@ -0,0 +1,157 @@
+package xmldom
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describe returns a short description of the records.
+func describe(records []*MutationRecord) string {
+	var res []string
+	for _, r := range records {
+		switch r.Type {
+		case ChildListMutation:
+			res = append(res, fmt.Sprintf("childList %s +[%s] -[%s] after %s before %s", r.Target.nodeName,
+				names(r.AddedNodes), names(r.RemovedNodes), nodeName(r.PreviousSibling), nodeName(r.NextSibling)))
+		case AttributesMutation:
+			res = append(res, fmt.Sprintf("attributes %s %s %q", r.Target.nodeName, r.AttributeName, r.OldValue))
+		case CharacterDataMutation:
+			res = append(res, fmt.Sprintf("characterData %q %q", r.Target.nodeValue, r.OldValue))
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+func nodeName(n *Node) string {
+	if n == nil {
+		return "nil"
+	}
+	return names([]*Node{n})
+}
+
+func TestMutationObserver(t *testing.T) {
+	doc := parseTraversal(t, `<a x="1"><b>text</b><c/></a>`)
+	a := doc.DocumentElement()
+	b := element(doc, "b")
+	c := element(doc, "c")
+	var delivered [][]*MutationRecord
+	o := NewMutationObserver(func(records []*MutationRecord, o *MutationObserver) {
+		delivered = append(delivered, records)
+	})
+	if e := o.Observe(a, MutationObserverInit{ChildList: true, AttributeOldValue: true, CharacterDataOldValue: true, Subtree: true}); e != nil {
+		t.Fatal(e)
+	}
+
+	d, _ := doc.CreateElement("d")
+	a.AppendChild(d)
+	a.InsertBefore(c, b)
+	a.ReplaceChild(doc.CreateTextNode("new"), d)
+	a.RemoveChild(b)
+	a.SetAttribute("x", "2")
+	a.SetAttribute("y", "3")
+	a.RemoveAttribute("x")
+	c.SetAttributeNS("urn:ns", "ns:z", "4")
+	b.FirstChild().SetNodeValue("changed")
+	b.FirstChild().AppendData("!")
+	want := strings.Join([]string{
+		"childList a +[d] -[] after c before nil",
+		"childList a +[] -[c] after b before d",
+		"childList a +[c] -[] after nil before b",
+		"childList a +[new] -[d] after b before nil",
+		"childList a +[] -[b] after c before new",
+		`attributes a x "1"`,
+		`attributes a y ""`,
+		`attributes a x "2"`,
+		`attributes c z ""`,
+		// b was removed, but its changes are recorded until the delivery.
+		`characterData "changed!" "text"`,
+		`characterData "changed!" "changed"`,
+	}, "\n")
+	if len(delivered) != 0 {
+		t.Fatalf("records delivered before DeliverMutationRecords")
+	}
+	doc.DeliverMutationRecords()
+	if len(delivered) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(delivered))
+	}
+	if got := describe(delivered[0]); got != want {
+		t.Errorf("records:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The transient registration on b is removed by the delivery.
+	b.FirstChild().SetNodeValue("again")
+	if records := o.TakeRecords(); len(records) != 0 {
+		t.Errorf("records of a removed node after delivery:\n%s", describe(records))
+	}
+
+	o.Disconnect()
+	a.SetAttribute("x", "3")
+	doc.DeliverMutationRecords()
+	if len(delivered) != 1 || len(doc.state.observers) != 0 {
+		t.Errorf("records delivered after Disconnect")
+	}
+}
+
+func TestMutationObserverOptions(t *testing.T) {
+	doc := parseTraversal(t, `<a><b x="1">text</b></a>`)
+	a := doc.DocumentElement()
+	b := element(doc, "b")
+	tests := []struct {
+		target  *Node
+		options MutationObserverInit
+		want    string
+	}{
+		{a, MutationObserverInit{ChildList: true}, "childList a +[c] -[] after b before nil"},
+		{a, MutationObserverInit{ChildList: true, Attributes: true, CharacterData: true}, "childList a +[c] -[] after b before nil"},
+		{a, MutationObserverInit{Attributes: true, Subtree: true}, `attributes b x ""` + "\n" + `attributes b y ""`},
+		{a, MutationObserverInit{AttributeFilter: []string{"y"}, Subtree: true}, `attributes b y ""`},
+		{b, MutationObserverInit{AttributeOldValue: true}, `attributes b x "1"` + "\n" + `attributes b y ""`},
+		{b, MutationObserverInit{CharacterData: true, Subtree: true}, `characterData "new" ""`},
+		{b, MutationObserverInit{CharacterDataOldValue: true, Subtree: true}, `characterData "new" "text"`},
+	}
+	for _, test := range tests {
+		o := NewMutationObserver(nil)
+		if e := o.Observe(test.target, test.options); e != nil {
+			t.Fatal(e)
+		}
+		b.SetAttribute("x", "2")
+		b.SetAttribute("y", "3")
+		b.FirstChild().SetNodeValue("new")
+		c, _ := doc.CreateElement("c")
+		a.AppendChild(c)
+		if got := describe(o.TakeRecords()); got != test.want {
+			t.Errorf("%+v: got\n%s\nwant\n%s", test.options, got, test.want)
+		}
+		o.Disconnect()
+		a.RemoveChild(c)
+		b.RemoveAttribute("y")
+		b.SetAttribute("x", "1")
+		b.FirstChild().SetNodeValue("text")
+	}
+	if e := NewMutationObserver(nil).Observe(a, MutationObserverInit{Subtree: true}); e == nil {
+		t.Error("observed no mutation")
+	}
+}
+
+func TestMutationObserverMove(t *testing.T) {
+	doc := parseTraversal(t, `<a><b/><c/></a>`)
+	a := doc.DocumentElement()
+	o := NewMutationObserver(nil)
+	o.Observe(a, MutationObserverInit{ChildList: true})
+	fragment := doc.CreateDocumentFragment()
+	for _, name := range []string{"x", "y"} {
+		e, _ := doc.CreateElement(name)
+		fragment.AppendChild(e)
+	}
+	a.InsertBefore(fragment, a.LastChild())
+	a.InsertBefore(a.FirstChild(), a.LastChild())
+	want := strings.Join([]string{
+		"childList a +[x y] -[] after b before c",
+		"childList a +[] -[b] after nil before x",
+		"childList a +[b] -[] after y before c",
+	}, "\n")
+	if got := describe(o.TakeRecords()); got != want {
+		t.Errorf("records:\n%s\nwant:\n%s", got, want)
+	}
+}
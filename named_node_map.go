@@ -2,12 +2,20 @@ package xmldom
 
 type namedNodeMap struct {
 	document *Node
+	owner    *Node // element the attributes belong to
 	nodes    NodeList
 	index    map[string]int
 }
 
 func NewEmptyNamedNodeMap(document *Node) *namedNodeMap {
-	return &namedNodeMap{document, nil, map[string]int{}}
+	return &namedNodeMap{document, nil, nil, map[string]int{}}
+}
+
+func (nm *namedNodeMap) setOwner(owner *Node) {
+	nm.owner = owner
+	for _, n := range nm.nodes {
+		n.ownerElement = owner
+	}
 }
 
 func (nm *namedNodeMap) Clone(deep bool) NamedNodeMap {
@@ -36,42 +44,170 @@ func (nm *namedNodeMap) GetNamedItem(name string) *Node {
 func (nm *namedNodeMap) SetNamedItem(item *Node) (*Node, Error) {
 	if item.OwnerDocument() != nm.document {
 		return nil, err(WrongDocumentError)
-	} else if item.ParentNode() != nil {
+	} else if item.ParentNode() != nil || (item.ownerElement != nil && item.ownerElement != nm.owner) {
 		return nil, err(InuseAttributeError)
 	}
 	name := item.NodeName()
+	if i, ok := nm.index[name]; ok && nm.nodes[i] == item {
+		return item, nil
+	}
+	nm.changing()
+	item.ownerElement = nm.owner
 	if i, ok := nm.index[name]; ok {
 		old := nm.nodes[i]
+		nm.document.queueAttribute(nm.owner, item, old.nodeValue)
+		nm.owner.attributeRemoved(old)
 		nm.nodes[i] = item
+		old.ownerElement = nil
+		nm.owner.attributeAdded(item)
 		return old, nil
 	} else {
+		nm.document.queueAttribute(nm.owner, item, "")
 		nm.index[name] = len(nm.nodes)
 		nm.nodes = append(nm.nodes, item)
+		nm.owner.attributeAdded(item)
+		return nil, nil
+	}
+}
+
+func (nm *namedNodeMap) GetNamedItemNS(namespaceURI, localName string) *Node {
+	if i := nm.indexNS(namespaceURI, localName); i >= 0 {
+		return nm.nodes[i]
+	} else {
+		return nil
+	}
+}
+
+func (nm *namedNodeMap) SetNamedItemNS(item *Node) (*Node, Error) {
+	if item.OwnerDocument() != nm.document {
+		return nil, err(WrongDocumentError)
+	} else if item.ParentNode() != nil || (item.ownerElement != nil && item.ownerElement != nm.owner) {
+		return nil, err(InuseAttributeError)
+	}
+	if nm.GetNamedItemNS(item.namespaceURI, item.localName) == item {
+		return item, nil
+	}
+	nm.changing()
+	item.changing()
+	item.ownerElement = nm.owner
+	item.nsDirty = true
+	if i := nm.indexNS(item.namespaceURI, item.localName); i >= 0 {
+		old := nm.nodes[i]
+		nm.document.queueAttribute(nm.owner, item, old.nodeValue)
+		nm.owner.attributeRemoved(old)
+		nm.nodes[i] = item
+		if j, ok := nm.index[old.nodeName]; ok && j == i {
+			delete(nm.index, old.nodeName)
+		}
+		if _, ok := nm.index[item.nodeName]; !ok {
+			nm.index[item.nodeName] = i
+		}
+		old.ownerElement = nil
+		nm.owner.attributeAdded(item)
+		return old, nil
+	} else {
+		nm.document.queueAttribute(nm.owner, item, "")
+		if _, ok := nm.index[item.nodeName]; !ok {
+			nm.index[item.nodeName] = len(nm.nodes)
+		}
+		nm.nodes = append(nm.nodes, item)
+		nm.owner.attributeAdded(item)
 		return nil, nil
 	}
 }
 
+func (nm *namedNodeMap) RemoveNamedItemNS(namespaceURI, localName string) Error {
+	i := nm.indexNS(namespaceURI, localName)
+	if i < 0 {
+		return err(NotFoundError)
+	}
+	return nm.removeAt(i)
+}
+
+func (nm *namedNodeMap) indexNS(namespaceURI, localName string) int {
+	for i, n := range nm.nodes {
+		if n.namespaceURI == namespaceURI && n.localName == localName {
+			return i
+		}
+	}
+	return -1
+}
+
 func (nm *namedNodeMap) RemoveNamedItem(name string) Error {
 	if i, ok := nm.index[name]; ok {
-		nm.nodes[i] = nil
-		delete(nm.index, name)
-		// reindex
-		var newNodes NodeList
-		if i > 0 {
-			newNodes = nm.nodes[0:i]
+		return nm.removeAt(i)
+	} else {
+		return err(NotFoundError)
+	}
+}
+
+func (nm *namedNodeMap) removeAt(i int) Error {
+	nm.changing()
+	nm.document.queueAttribute(nm.owner, nm.nodes[i], nm.nodes[i].nodeValue)
+	nm.owner.attributeRemoved(nm.nodes[i])
+	nm.nodes[i].ownerElement = nil
+	if j, ok := nm.index[nm.nodes[i].nodeName]; ok && j == i {
+		delete(nm.index, nm.nodes[i].nodeName)
+	}
+	nm.nodes[i] = nil
+	// reindex
+	var newNodes NodeList
+	if i > 0 {
+		newNodes = nm.nodes[0:i]
+	}
+	if i+1 < len(nm.nodes) {
+		newNodes = append(newNodes, nm.nodes[i+1:len(nm.nodes)]...)
+	}
+	nm.nodes = newNodes
+	for n, j := range nm.index {
+		if j > i {
+			nm.index[n] = j - 1
 		}
-		if i+1 < len(nm.nodes) {
-			newNodes = append(newNodes, nm.nodes[i+1:len(nm.nodes)]...)
+	}
+	// another attribute with the same qualified name may remain
+	for j, n := range nm.nodes {
+		if _, ok := nm.index[n.nodeName]; !ok {
+			nm.index[n.nodeName] = j
 		}
-		nm.nodes = newNodes
-		for n, j := range nm.index {
-			if j > i {
-				nm.index[n] = j - 1
+	}
+	return nil
+}
+
+// renamed updates the index after the name of item changed from oldName.
+func (nm *namedNodeMap) renamed(item *Node, oldName string) {
+	i := -1
+	for j, n := range nm.nodes {
+		if n == item {
+			i = j
+		}
+	}
+	if i < 0 || item.nodeName == oldName {
+		return
+	}
+	nm.changing()
+	if j, ok := nm.index[oldName]; ok && j == i {
+		delete(nm.index, oldName)
+		// another attribute with the same qualified name may remain
+		for j, n := range nm.nodes {
+			if n.nodeName == oldName {
+				nm.index[oldName] = j
+				break
 			}
 		}
-		return nil
-	} else {
-		return err(NotFoundError)
+	}
+	if _, ok := nm.index[item.nodeName]; !ok {
+		nm.index[item.nodeName] = i
+	}
+}
+
+// attributeRenamed updates the attributes of the element after the name of
+// one of them changed from oldName.
+func (e *Node) attributeRenamed(a *Node, oldName string) {
+	if e == nil {
+		return
+	}
+	if nm, ok := e.attributes.(*namedNodeMap); ok {
+		nm.renamed(a, oldName)
 	}
 }
 
@@ -0,0 +1,370 @@
+package xmldom
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	XMLNamespace   = "http://www.w3.org/XML/1998/namespace"
+	XMLNSNamespace = "http://www.w3.org/2000/xmlns/"
+)
+
+// splitQName splits a qualified name in its prefix and local part. The prefix
+// is empty for unqualified names.
+func splitQName(qname string) (prefix, localName string) {
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[:i], qname[i+1:]
+	}
+	return "", qname
+}
+
+// NamespaceURI returns the namespace URI of an element or attribute. It is
+// fixed when the node is parsed or created and does not change when the node
+// is moved, as in the DOM.
+func (n *Node) NamespaceURI() string {
+	return n.namespaceURI
+}
+
+func (n *Node) Prefix() string {
+	return n.prefix
+}
+
+// LocalName returns the local part of the name of an element or attribute.
+// As in the DOM, it is empty for nodes created with the Level 1 factories
+// CreateElement and CreateAttribute.
+func (n *Node) LocalName() string {
+	return n.localName
+}
+
+// SetPrefix changes the prefix of a namespaced element or attribute, and the
+// node name with it. The namespace URI is left unchanged.
+func (n *Node) SetPrefix(prefix string) Error {
+	if n.localName == "" {
+		return nil
+	}
+	if prefix != "" {
+		if n.namespaceURI == "" ||
+			(prefix == "xml" && n.namespaceURI != XMLNamespace) ||
+			(prefix == "xmlns" && n.namespaceURI != XMLNSNamespace) ||
+			(n.nodeType == AttributeNode && n.nodeName == "xmlns") {
+			return err(NamespaceError)
+		}
+		if strings.ContainsRune(prefix, ':') {
+			return err(NamespaceError)
+		}
+	}
+	n.changing()
+	oldName := n.nodeName
+	n.prefix = prefix
+	if prefix == "" {
+		n.nodeName = n.localName
+	} else {
+		n.nodeName = prefix + ":" + n.localName
+	}
+	n.ownerElement.attributeRenamed(n, oldName)
+	n.nsDirty = true
+	n.ownerDocument.treeChanged()
+	return nil
+}
+
+// namespaceContext returns the element from which in-scope namespace
+// declarations are looked up for the node, or nil.
+func (n *Node) namespaceContext() *Node {
+	switch n.nodeType {
+	case ElementNode:
+		return n
+	case DocumentNode:
+		return n.DocumentElement()
+	case AttributeNode:
+		return n.ownerElement
+	case EntityNode, NotationNode, DocumentTypeNode, DocumentFragmentNode:
+		return nil
+	}
+	for p := n.parentNode; p != nil; p = p.parentNode {
+		if p.nodeType == ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+// LookupNamespaceURI returns the namespace URI bound to prefix in the scope of
+// the node, or the default namespace if prefix is empty. It returns an empty
+// string if the prefix is not bound.
+func (n *Node) LookupNamespaceURI(prefix string) string {
+	switch prefix {
+	case "xml":
+		return XMLNamespace
+	case "xmlns":
+		return XMLNSNamespace
+	}
+	for e := n.namespaceContext(); e != nil; e = e.parentElement() {
+		if e.namespaceURI != "" && e.prefix == prefix {
+			return e.namespaceURI
+		}
+		if uri, ok := e.declaredNamespace(prefix); ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// LookupPrefix returns a prefix bound to the namespace URI in the scope of the
+// node, or an empty string if there is none. Default namespace declarations
+// are not considered.
+func (n *Node) LookupPrefix(namespaceURI string) string {
+	switch namespaceURI {
+	case "":
+		return ""
+	case XMLNamespace:
+		return "xml"
+	case XMLNSNamespace:
+		return "xmlns"
+	}
+	orig := n.namespaceContext()
+	for e := orig; e != nil; e = e.parentElement() {
+		if e.namespaceURI == namespaceURI && e.prefix != "" && orig.LookupNamespaceURI(e.prefix) == namespaceURI {
+			return e.prefix
+		}
+		for i := 0; i < e.attributes.Length(); i++ {
+			a := e.attributes.Item(i)
+			if a.prefix == "xmlns" && a.nodeValue == namespaceURI && orig.LookupNamespaceURI(a.localName) == namespaceURI {
+				return a.localName
+			}
+		}
+	}
+	return ""
+}
+
+// IsDefaultNamespace tells if namespaceURI is the default namespace in the
+// scope of the node.
+func (n *Node) IsDefaultNamespace(namespaceURI string) bool {
+	return n.LookupNamespaceURI("") == namespaceURI
+}
+
+// declaredNamespace returns the namespace declared for prefix by an xmlns
+// attribute of the element itself.
+func (e *Node) declaredNamespace(prefix string) (string, bool) {
+	if e.attributes == nil {
+		return "", false
+	}
+	name := "xmlns"
+	if prefix != "" {
+		name = "xmlns:" + prefix
+	}
+	if a := e.attributes.GetNamedItem(name); a != nil {
+		return a.nodeValue, true
+	}
+	return "", false
+}
+
+func (n *Node) parentElement() *Node {
+	if p := n.parentNode; p != nil && p.nodeType == ElementNode {
+		return p
+	}
+	return nil
+}
+
+// resolveNamespaces binds a parsed element and its attributes to the
+// namespaces in scope, keeping the prefixes found in the source.
+func (n *Node) resolveNamespaces() {
+	n.prefix, n.localName = splitQName(n.nodeName)
+	n.namespaceURI = ""
+	n.namespaceURI = n.LookupNamespaceURI(n.prefix)
+	n.nsDirty = false
+	for i := 0; i < n.attributes.Length(); i++ {
+		a := n.attributes.Item(i)
+		a.prefix, a.localName = splitQName(a.nodeName)
+		switch {
+		case a.nodeName == "xmlns" || a.prefix == "xmlns":
+			a.namespaceURI = XMLNSNamespace
+		case a.prefix != "":
+			a.namespaceURI = n.LookupNamespaceURI(a.prefix)
+		default:
+			a.namespaceURI = ""
+		}
+	}
+}
+
+// checkQName validates a qualified name against its namespace URI as required
+// by the namespace aware factory methods, and splits it.
+func checkQName(namespaceURI, qualifiedName string) (prefix, localName string, e Error) {
+	prefix, localName = splitQName(qualifiedName)
+	switch {
+	case localName == "" || strings.ContainsRune(localName, ':'):
+		return "", "", err(NamespaceError)
+	case prefix == "" && strings.HasPrefix(qualifiedName, ":"):
+		return "", "", err(NamespaceError)
+	case prefix != "" && namespaceURI == "":
+		return "", "", err(NamespaceError)
+	case prefix == "xml" && namespaceURI != XMLNamespace:
+		return "", "", err(NamespaceError)
+	case (prefix == "xmlns" || qualifiedName == "xmlns") != (namespaceURI == XMLNSNamespace):
+		return "", "", err(NamespaceError)
+	}
+	return prefix, localName, nil
+}
+
+// NormalizeDocument fixes up namespace declarations so that the document
+// serializes to XML with the namespaces of its nodes, in the manner of DOM
+// Level 3 namespace normalization. Missing declarations are added, prefixes
+// are invented when the one of a node is bound to another namespace, and
+// declarations made redundant by a move are dropped. Only elements created,
+// moved or renamed since parsing are considered, so the rest of the document
+// serializes as before.
+func (d *Node) NormalizeDocument() {
+	d.normalizeNamespaces(false)
+}
+
+func (n *Node) normalizeNamespaces(dirty bool) {
+	if n.nodeType == ElementNode {
+		dirty = dirty || n.nsDirty
+		n.fixNamespaces(dirty)
+	}
+	if n.nsDirty {
+		n.changing()
+		n.nsDirty = false
+	}
+	for _, c := range n.childNodes {
+		c.normalizeNamespaces(dirty)
+	}
+}
+
+// fixNamespaces adds the declarations the element and its attributes need.
+// When the element itself was modified, all its attributes are checked and
+// its redundant declarations are removed, else only modified attributes are.
+func (e *Node) fixNamespaces(dirty bool) {
+	if dirty && e.nsDirty {
+		e.removeRedundantDeclarations()
+	}
+	if dirty && e.localName != "" {
+		switch {
+		case e.namespaceURI != "" && e.inScopeNamespace(e.prefix) != e.namespaceURI:
+			if _, conflict := e.declaredNamespace(e.prefix); conflict {
+				e.renameNamespaced(e.prefixFor(e.namespaceURI))
+			}
+			e.declareNamespace(e.prefix, e.namespaceURI)
+		case e.namespaceURI == "" && e.prefix == "" && e.inScopeNamespace("") != "":
+			if _, conflict := e.declaredNamespace(""); !conflict {
+				e.declareNamespace("", "")
+			}
+		}
+	}
+	for i := 0; i < e.attributes.Length(); i++ {
+		a := e.attributes.Item(i)
+		if !dirty && !a.nsDirty {
+			continue
+		}
+		if a.nsDirty {
+			a.changing()
+			a.nsDirty = false
+		}
+		if a.namespaceURI == "" || a.namespaceURI == XMLNSNamespace {
+			continue
+		}
+		if a.prefix != "" && e.inScopeNamespace(a.prefix) == a.namespaceURI {
+			continue
+		}
+		_, conflict := e.declaredNamespace(a.prefix)
+		if a.prefix == "" || conflict || (a.prefix == e.prefix && e.namespaceURI != "") {
+			a.renameNamespaced(e.prefixFor(a.namespaceURI))
+		}
+		if e.inScopeNamespace(a.prefix) != a.namespaceURI {
+			e.declareNamespace(a.prefix, a.namespaceURI)
+		}
+	}
+}
+
+// inScopeNamespace returns the namespace bound to prefix by the xmlns
+// declarations in scope of the element, ignoring the namespace of the
+// elements themselves.
+func (e *Node) inScopeNamespace(prefix string) string {
+	switch prefix {
+	case "xml":
+		return XMLNamespace
+	case "xmlns":
+		return XMLNSNamespace
+	}
+	for ; e != nil; e = e.parentElement() {
+		if uri, ok := e.declaredNamespace(prefix); ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// prefixFor returns a non empty prefix bound to namespaceURI in scope of the
+// element, or else a new unused prefix.
+func (e *Node) prefixFor(namespaceURI string) string {
+	for p := e; p != nil; p = p.parentElement() {
+		for i := 0; i < p.attributes.Length(); i++ {
+			a := p.attributes.Item(i)
+			if a.prefix != "xmlns" || a.nodeValue != namespaceURI {
+				continue
+			}
+			if e.inScopeNamespace(a.localName) == namespaceURI && (a.localName != e.prefix || e.namespaceURI == namespaceURI) {
+				return a.localName
+			}
+		}
+	}
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("ns%d", i)
+		if _, declared := e.declaredNamespace(prefix); !declared && e.inScopeNamespace(prefix) == "" {
+			return prefix
+		}
+	}
+}
+
+func (n *Node) renameNamespaced(prefix string) {
+	n.changing()
+	oldName := n.nodeName
+	n.prefix = prefix
+	if prefix == "" {
+		n.nodeName = n.localName
+	} else {
+		n.nodeName = prefix + ":" + n.localName
+	}
+	n.ownerElement.attributeRenamed(n, oldName)
+	n.ownerDocument.treeChanged()
+}
+
+// declareNamespace adds a namespace declaration attribute to the element.
+func (e *Node) declareNamespace(prefix, namespaceURI string) {
+	if _, declared := e.declaredNamespace(prefix); declared {
+		return
+	}
+	name := "xmlns"
+	if prefix != "" {
+		name = "xmlns:" + prefix
+	}
+	a, err := e.ownerDocument.CreateAttributeNS(XMLNSNamespace, name)
+	if err != nil {
+		return
+	}
+	a.nodeValue = namespaceURI
+	a.ValueDirty = true
+	e.attributes.SetNamedItemNS(a)
+	a.changing()
+	a.nsDirty = false
+}
+
+// removeRedundantDeclarations removes the namespace declarations of the
+// element that repeat the bindings in scope of its parent.
+func (e *Node) removeRedundantDeclarations() {
+	parent := e.parentElement()
+	for i := 0; i < e.attributes.Length(); {
+		a := e.attributes.Item(i)
+		if a.namespaceURI == XMLNSNamespace {
+			prefix := a.localName
+			if a.prefix == "" {
+				prefix = ""
+			}
+			if parent.inScopeNamespace(prefix) == a.nodeValue {
+				e.attributes.RemoveNamedItemNS(a.namespaceURI, a.localName)
+				continue
+			}
+		}
+		i++
+	}
+}
@@ -0,0 +1,210 @@
+package xmldom
+
+import "testing"
+
+func TestSetAttributeNSPrefix(t *testing.T) {
+	tests := []struct {
+		src, qname, want string
+	}{
+		{`<p xmlns:a="urn:x" a:y="1"/>`, "b:y", `<p xmlns:a="urn:x" b:y="2" xmlns:b="urn:x"/>`},
+		{`<p xmlns:a="urn:x" xmlns:b="urn:x" a:y="1"/>`, "b:y", `<p xmlns:a="urn:x" xmlns:b="urn:x" b:y="2"/>`},
+		{`<p xmlns:a="urn:x" a:y="1"/>`, "a:y", `<p xmlns:a="urn:x" a:y="2"/>`},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, test.src)
+		p := doc.DocumentElement()
+		if e := p.SetAttributeNS("urn:x", test.qname, "2"); e != nil {
+			t.Errorf("%s: %v", test.src, e)
+			continue
+		}
+		if got := doc.XML(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.src, got, test.want)
+		}
+		if a := p.GetAttributeNode(test.qname); a == nil || a != p.GetAttributeNodeNS("urn:x", "y") {
+			t.Errorf("%s: GetAttributeNode(%q) = %v", test.src, test.qname, a)
+		}
+		if test.qname != "a:y" && p.GetAttributeNode("a:y") != nil {
+			t.Errorf("%s: attribute still found under its previous name", test.src)
+		}
+	}
+}
+
+func TestSetSameAttributeNode(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(p, a *Node) (*Node, Error)
+	}{
+		{"SetAttributeNode", func(p, a *Node) (*Node, Error) { return p.SetAttributeNode(a) }},
+		{"SetAttributeNodeNS", func(p, a *Node) (*Node, Error) { return p.SetAttributeNodeNS(a) }},
+		{"SetNamedItem", func(p, a *Node) (*Node, Error) { return p.Attributes().SetNamedItem(a) }},
+		{"SetNamedItemNS", func(p, a *Node) (*Node, Error) { return p.Attributes().SetNamedItemNS(a) }},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, `<p xmlns:a="urn:x" a:y="1"/>`)
+		p := doc.DocumentElement()
+		a := p.GetAttributeNodeNS("urn:x", "y")
+		o := NewMutationObserver(nil)
+		o.Observe(p, MutationObserverInit{Attributes: true})
+		if res, e := test.set(p, a); res != a || e != nil {
+			t.Errorf("%s returned %v, %v", test.name, res, e)
+		}
+		if a.OwnerElement() != p || p.Attributes().Length() != 2 {
+			t.Errorf("%s: owner %v, %d attributes", test.name, a.OwnerElement(), p.Attributes().Length())
+		}
+		if records := o.TakeRecords(); len(records) != 0 {
+			t.Errorf("%s: records %s", test.name, describe(records))
+		}
+	}
+}
+
+func TestParsedNamespaces(t *testing.T) {
+	doc := parseTraversal(t, `<r xmlns="urn:d" xmlns:p="urn:p" a="1" p:b="2" xml:lang="en"><p:c><d xmlns=""/></p:c></r>`)
+	r := doc.DocumentElement()
+	c := r.FirstChild()
+	d := c.FirstChild()
+	tests := []struct {
+		node                   *Node
+		uri, prefix, localName string
+	}{
+		{r, "urn:d", "", "r"},
+		{r.GetAttributeNode("a"), "", "", "a"},
+		{r.GetAttributeNode("p:b"), "urn:p", "p", "b"},
+		{r.GetAttributeNode("xml:lang"), XMLNamespace, "xml", "lang"},
+		{r.GetAttributeNode("xmlns"), XMLNSNamespace, "", "xmlns"},
+		{r.GetAttributeNode("xmlns:p"), XMLNSNamespace, "xmlns", "p"},
+		{c, "urn:p", "p", "c"},
+		{d, "", "", "d"},
+	}
+	for _, test := range tests {
+		if test.node == nil {
+			t.Errorf("missing node %s", test.localName)
+			continue
+		}
+		if uri, prefix, localName := test.node.NamespaceURI(), test.node.Prefix(), test.node.LocalName(); uri != test.uri || prefix != test.prefix || localName != test.localName {
+			t.Errorf("%s: %q, %q, %q, want %q, %q, %q", test.node.NodeName(), uri, prefix, localName, test.uri, test.prefix, test.localName)
+		}
+	}
+}
+
+func TestLookupNamespace(t *testing.T) {
+	doc := parseTraversal(t, `<r xmlns="urn:d" xmlns:p="urn:p"><p:c xmlns:q="urn:p"><d xmlns="" xmlns:p="urn:o">text</d></p:c></r>`)
+	r := doc.DocumentElement()
+	c := r.FirstChild()
+	d := c.FirstChild()
+	tests := []struct {
+		node      *Node
+		prefix    string
+		uri       string
+		uriPrefix string
+		isDefault bool
+	}{
+		{r, "", "urn:d", "", true},
+		{r, "p", "urn:p", "p", false},
+		{r, "xml", XMLNamespace, "xml", false},
+		{r, "q", "", "", false},
+		{c, "q", "urn:p", "p", false},
+		{c, "p", "urn:p", "p", false},
+		{d, "", "", "", true},
+		{d, "p", "urn:o", "p", false},
+		{d, "q", "urn:p", "q", false},
+		{d.FirstChild(), "p", "urn:o", "p", false},
+		{doc, "p", "urn:p", "p", false},
+	}
+	for _, test := range tests {
+		if uri := test.node.LookupNamespaceURI(test.prefix); uri != test.uri {
+			t.Errorf("%s: LookupNamespaceURI(%q) = %q, want %q", test.node.NodeName(), test.prefix, uri, test.uri)
+		}
+		if test.uri == "" {
+			continue
+		}
+		if prefix := test.node.LookupPrefix(test.uri); prefix != test.uriPrefix {
+			t.Errorf("%s: LookupPrefix(%q) = %q, want %q", test.node.NodeName(), test.uri, prefix, test.uriPrefix)
+		}
+		if test.node.IsDefaultNamespace(test.uri) != test.isDefault {
+			t.Errorf("%s: IsDefaultNamespace(%q) = %v", test.node.NodeName(), test.uri, !test.isDefault)
+		}
+	}
+}
+
+func TestSetPrefix(t *testing.T) {
+	tests := []struct {
+		name, prefix, want string
+		ok                 bool
+	}{
+		{"p:c", "q", "q:c", true},
+		{"p:c", "", "c", true},
+		{"p:c", "xml", "p:c", false},
+		{"p:c", "a:b", "p:c", false},
+		{"d", "q", "d", false},
+		{"p:b", "xml", "p:b", false},
+		{"p:b", "q", "q:b", true},
+		{"xmlns", "q", "xmlns", false},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, `<r xmlns="urn:d" xmlns:p="urn:p" p:b="1"><p:c/><d xmlns=""/></r>`)
+		r := doc.DocumentElement()
+		n := r.GetAttributeNode(test.name)
+		for c := r.FirstChild(); n == nil && c != nil; c = c.NextSibling() {
+			if c.NodeName() == test.name {
+				n = c
+			}
+		}
+		e := n.SetPrefix(test.prefix)
+		if (e == nil) != test.ok || n.NodeName() != test.want {
+			t.Errorf("%s.SetPrefix(%q) = %v, name %q, want %q", test.name, test.prefix, e, n.NodeName(), test.want)
+		}
+	}
+}
+
+func TestNormalizeDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		edit func(doc, r *Node)
+		want string
+	}{
+		{"unmodified", `<r xmlns:p="urn:p"><p:a  xmlns:p="urn:p"/></r>`, func(doc, r *Node) {},
+			`<r xmlns:p="urn:p"><p:a  xmlns:p="urn:p"/></r>`},
+		{"new element", `<r/>`, func(doc, r *Node) {
+			e, _ := doc.CreateElementNS("urn:p", "p:a")
+			r.AppendChild(e)
+		}, `<r><p:a xmlns:p="urn:p"/></r>`},
+		{"new element in scope", `<r xmlns:p="urn:p"/>`, func(doc, r *Node) {
+			e, _ := doc.CreateElementNS("urn:p", "p:a")
+			r.AppendChild(e)
+		}, `<r xmlns:p="urn:p"><p:a/></r>`},
+		{"default namespace", `<r xmlns="urn:d"/>`, func(doc, r *Node) {
+			e, _ := doc.CreateElementNS("", "a")
+			r.AppendChild(e)
+		}, `<r xmlns="urn:d"><a xmlns=""/></r>`},
+		{"prefix bound to another namespace", `<r xmlns:p="urn:p"/>`, func(doc, r *Node) {
+			e, _ := doc.CreateElementNS("urn:q", "p:a")
+			e.SetAttributeNS("urn:p", "p:b", "1")
+			r.AppendChild(e)
+		}, `<r xmlns:p="urn:p"><p:a ns1:b="1" xmlns:p="urn:q" xmlns:ns1="urn:p"/></r>`},
+		{"attribute without prefix", `<r/>`, func(doc, r *Node) {
+			a, _ := doc.CreateAttributeNS("urn:p", "b")
+			a.SetNodeValue("1")
+			r.SetAttributeNodeNS(a)
+		}, `<r ns1:b="1" xmlns:ns1="urn:p"/>`},
+		{"moved element", `<r xmlns:p="urn:p"><p:a/><s xmlns:p="urn:q"/></r>`, func(doc, r *Node) {
+			r.LastChild().AppendChild(r.FirstChild())
+		}, `<r xmlns:p="urn:p"><s xmlns:p="urn:q"><p:a xmlns:p="urn:p"/></s></r>`},
+		{"redundant declaration", `<r xmlns:p="urn:p"><s><p:a xmlns:p="urn:p"/></s></r>`, func(doc, r *Node) {
+			s := r.FirstChild()
+			r.AppendChild(s.FirstChild())
+		}, `<r xmlns:p="urn:p"><s></s><p:a/></r>`},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, test.src)
+		test.edit(doc, doc.DocumentElement())
+		doc.NormalizeDocument()
+		if got := doc.XML(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+		reparsed := parseTraversal(t, doc.XML())
+		if !doc.DocumentElement().IsEqualNode(reparsed.DocumentElement()) {
+			t.Errorf("%s: %s does not parse back to the same tree", test.name, doc.XML())
+		}
+	}
+}
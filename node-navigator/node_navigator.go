@@ -1,6 +1,7 @@
 package node_navigator
 
 import (
+	"fmt"
 	"github.com/antchfx/xpath"
 	"github.com/mildred/xml-dom"
 	"io/ioutil"
@@ -14,10 +15,35 @@ var l *log.Logger = log.New(ioutil.Discard, "", log.LstdFlags)
 type NodeNavigator struct {
 	Node *xmldom.Node
 	Attr int
+
+	// Prefixes maps namespace URIs to the prefix an XPath expression uses for
+	// them. When set, Prefix() returns the prefix bound by the expression
+	// instead of the one found in the document.
+	Prefixes map[string]string
 }
 
 func NewNodeNavigator(node *xmldom.Node) *NodeNavigator {
-	return &NodeNavigator{node, 0}
+	return &NodeNavigator{node, 0, nil}
+}
+
+// NewNodeNavigatorNS returns a navigator matching names by namespace URI
+// using the prefix to namespace URI bindings of an XPath expression. When
+// several prefixes are bound to the same URI, the expression must use the
+// one returned by NamespacePrefixes, xpath.CompileNS rewrites expressions so.
+func NewNodeNavigatorNS(node *xmldom.Node, namespaces map[string]string) *NodeNavigator {
+	return &NodeNavigator{node, 0, NamespacePrefixes(namespaces)}
+}
+
+// NamespacePrefixes returns the prefix reported by the navigators created by
+// NewNodeNavigatorNS for each namespace URI bound in namespaces.
+func NamespacePrefixes(namespaces map[string]string) map[string]string {
+	prefixes := map[string]string{}
+	for prefix, uri := range namespaces {
+		if p, ok := prefixes[uri]; !ok || prefix < p {
+			prefixes[uri] = prefix
+		}
+	}
+	return prefixes
 }
 
 // NodeType returns the XPathNodeType of the current node.
@@ -76,7 +102,44 @@ func (nn *NodeNavigator) LocalName() string {
 // Prefix returns namespace prefix associated with the current node.
 func (nn *NodeNavigator) Prefix() string {
 	l.Printf("Prefix(%v)", nn.node())
-	return nn.node().NodeNamePrefix()
+	n := nn.node()
+	if nn.Prefixes == nil {
+		return n.NodeNamePrefix()
+	}
+	uri := n.NamespaceURI()
+	if uri == "" {
+		return ""
+	}
+	if prefix, ok := nn.Prefixes[uri]; ok {
+		return prefix
+	}
+	// The namespace is not bound by the expression, return a prefix that
+	// cannot match any of its name tests.
+	prefix := n.Prefix()
+	for i := 0; prefix == "" || nn.bound(prefix); i++ {
+		prefix = fmt.Sprintf("ns%d", i)
+	}
+	return prefix
+}
+
+func (nn *NodeNavigator) bound(prefix string) bool {
+	for _, p := range nn.Prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceRange returns the location in the source text of the node or
+// attribute the navigator is on, see xmldom.Node.SourceRange.
+func (nn *NodeNavigator) SourceRange() (xmldom.SourceRange, bool) {
+	return nn.node().SourceRange()
+}
+
+// NamespaceURL returns the namespace URI of the current node.
+func (nn *NodeNavigator) NamespaceURL() string {
+	return nn.node().NamespaceURI()
 }
 
 // Value gets the value of current node.
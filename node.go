@@ -1,8 +1,6 @@
 package xmldom
 
 import (
-	"bytes"
-	"encoding/xml"
 	"fmt"
 	"strings"
 )
@@ -11,12 +9,20 @@ type Node struct {
 	nodeType      NodeType
 	pos           int
 	nodeName      string
+	namespaceURI  string
+	prefix        string
+	localName     string
 	nodeValue     string
 	ValueDirty    bool
+	nsDirty       bool // namespace declarations may need fixing up
 	parentNode    *Node
 	childNodes    NodeList
 	ownerDocument *Node
-	attributes    NamedNodeMap // not nil only for elements
+	ownerElement  *Node          // not nil only for attributes set on an element
+	attributes    NamedNodeMap   // not nil only for elements
+	state         *documentState // not nil only for documents
+	decl          *declaration   // not nil only for document types, entities and notations
+	source        *SourceRange   // not nil only for parsed nodes
 
 	// For:
 	// - start and end elements: "<", tagName, ">", "</tagName>"
@@ -29,133 +35,17 @@ func (n *Node) String() string {
 	return n.XML()
 }
 
+// XML returns the node with its descendants as XML, see Serializer. Like any
+// Go string, the text is UTF-8, without a byte order mark, and the XML
+// declaration declares UTF-8. WriteTo writes the input encoding of the
+// document instead.
 func (n *Node) XML() string {
-	switch n.nodeType {
-	case DocumentFragmentNode:
-		fallthrough
-	case DocumentNode:
-		var res string
-		for _, cn := range n.childNodes {
-			res += cn.XML()
-		}
-		return res
-	case ElementNode:
-		var res string
-		if len(n.Raw) >= 1 {
-			res += n.Raw[0]
-		} else {
-			res += "<"
-		}
-		res += n.nodeName
-		for i := 0; i < n.Attributes().Length(); i++ {
-			a := n.Attributes().Item(i)
-			res += a.XML()
-		}
-
-		var last string
-		var self_closing bool = len(n.childNodes) == 0
-		var not_self_closing bool = !self_closing
-
-		if len(n.Raw) >= 4 {
-			if n.Raw[3] == "" {
-				if self_closing {
-					res += n.Raw[2]
-					last = n.Raw[3]
-					self_closing = false
-				}
-			} else if n.Raw[1] == n.nodeName || n.Raw[3] == "" {
-				last = n.Raw[3]
-				res += n.Raw[2]
-				self_closing = false
-				not_self_closing = false
-			}
-		}
-		if self_closing {
-			res += "/>"
-			last = ""
-		} else if not_self_closing {
-			res += ">"
-			last = fmt.Sprintf("</%s>", n.nodeName)
-		}
-
-		for _, cn := range n.childNodes {
-			res += cn.XML()
-		}
-
-		res += last
-		return res
-	case AttributeNode:
-		var res string
-		if len(n.Raw) >= 1 {
-			res += n.Raw[0]
-		} else {
-			res += " "
-		}
-		res += n.nodeName
-		if len(n.Raw) >= 5 && !n.ValueDirty {
-			res += n.Raw[2]
-			res += n.Raw[3]
-			res += n.Raw[4]
-		} else {
-			var b bytes.Buffer
-			res += "=\""
-			err := xml.EscapeText(&b, []byte(n.nodeValue))
-			if err != nil {
-				panic(err)
-			}
-			res += string(b.Bytes())
-			res += "\""
-		}
-		return res
-	case TextNode:
-		if len(n.Raw) > 0 && !n.ValueDirty {
-			return strings.Join(n.Raw, "")
-		}
-		var res string
-		for _, c := range n.nodeValue {
-			if c == '<' {
-				res += "&lt;"
-			} else if c == '>' {
-				res += "&gt;"
-			} else if c == '&' {
-				res += "&amp;"
-			} else {
-				res += string(c)
-			}
-		}
-		return res
-	case CDATASectionNode:
-		if len(n.Raw) > 0 && !n.ValueDirty {
-			return strings.Join(n.Raw, "")
-		}
-		return "<![CDATA[" + n.nodeValue + "]]>"
-	case ProcessingInstructionNode:
-		if len(n.Raw) > 0 && !n.ValueDirty {
-			return strings.Join(n.Raw, "")
-		}
-		return "<?" + n.nodeName + " " + n.nodeValue + "?>"
-	case CommentNode:
-		if len(n.Raw) > 0 && !n.ValueDirty {
-			return strings.Join(n.Raw, "")
-		}
-		return "<!--" + n.nodeValue + "-->"
-	case DocumentTypeNode:
-		if len(n.Raw) > 0 && !n.ValueDirty {
-			return strings.Join(n.Raw, "")
-		}
-		return "<!" + n.nodeValue + ">"
-	case EntityReferenceNode:
-		fallthrough
-	case EntityNode:
-		fallthrough
-	case NotationNode:
-		fallthrough
-	default:
-		if len(n.Raw) > 0 && !n.ValueDirty {
-			return strings.Join(n.Raw, "")
-		}
-		panic("Unknown node type " + n.nodeName)
-	}
+	var b strings.Builder
+	s := NewSerializer(&b)
+	s.Encoding = "UTF-8"
+	s.noBOM = true
+	s.Serialize(n)
+	return b.String()
 }
 
 func (n *Node) AsText() string {
@@ -164,6 +54,8 @@ func (n *Node) AsText() string {
 		fallthrough
 	case DocumentNode:
 		fallthrough
+	case EntityReferenceNode:
+		fallthrough
 	case ElementNode:
 		var res string
 		for _, cn := range n.childNodes {
@@ -187,6 +79,9 @@ func (n *Node) CloneNode(deep bool) *Node {
 		nodeType:      n.nodeType,
 		pos:           n.pos,
 		nodeName:      n.nodeName,
+		namespaceURI:  n.namespaceURI,
+		prefix:        n.prefix,
+		localName:     n.localName,
 		nodeValue:     n.nodeValue,
 		parentNode:    nil,
 		childNodes:    NodeList{},
@@ -200,8 +95,13 @@ func (n *Node) CloneNode(deep bool) *Node {
 			res.childNodes = append(res.childNodes, c)
 		}
 	}
+	res.decl = n.decl.clone(deep)
+	res.source = n.source
 	if n.attributes != nil {
 		res.attributes = n.attributes.Clone(deep)
+		if nm, ok := res.attributes.(*namedNodeMap); ok {
+			nm.setOwner(res)
+		}
 	}
 	return res.check()
 }
@@ -237,12 +137,31 @@ func (n *Node) NodeValue() string {
 }
 
 func (n *Node) SetNodeName(s string) {
+	n.changing()
+	oldName := n.nodeName
 	n.nodeName = s
+	n.ownerElement.attributeRenamed(n, oldName)
+	if n.localName != "" {
+		n.prefix, n.localName = splitQName(s)
+		n.nsDirty = true
+	}
+	n.ownerDocument.treeChanged()
 }
 
 func (n *Node) SetNodeValue(s string) {
+	if n.isCharacterData() {
+		n.ownerDocument.replacingData(n, 0, n.Length(), utf16Length(s))
+	}
+	n.setNodeValue(s)
+}
+
+func (n *Node) setNodeValue(s string) {
+	n.changing()
+	n.queueValue()
+	n.ownerElement.attributeRemoved(n)
 	n.nodeValue = s
 	n.ValueDirty = true
+	n.ownerElement.attributeAdded(n)
 }
 
 func (n *Node) ParentNode() *Node {
@@ -300,44 +219,15 @@ func (n *Node) OwnerDocument() *Node {
 func (n *Node) InsertBefore(newChild, refChild *Node) (*Node, Error) {
 	n.check()
 	defer n.check()
-	if refChild == nil {
-		return n.AppendChild(newChild)
-	}
-
-	i := refChild.pos
-	if refChild.ParentNode() != n || n.childNodes[i] != refChild {
+	if refChild != nil && (refChild.parentNode != n || n.childNodes[refChild.pos] != refChild) {
 		return nil, err(NotFoundError)
 	}
-
-	var newChildren NodeList
-	if i > 0 {
-		newChildren = append(NodeList{}, n.childNodes[0:i]...)
-	}
-	var length int
-
-	if newChild.NodeType() == DocumentFragmentNode {
-		for j, c := range newChild.ChildNodes() {
-			err := c.attach(n, i+j)
-			if err != nil {
-				return nil, err
-			}
-		}
-		newChildren = append(newChildren, newChild.ChildNodes()...)
-		length = len(newChild.ChildNodes())
-	} else {
-		err := newChild.attach(n, i)
-		if err != nil {
-			return nil, err
-		}
-		length = 1
-		newChildren = append(newChildren, newChild)
+	if refChild == newChild {
+		refChild = newChild.NextSibling()
 	}
-
-	for _, child := range n.childNodes[i:] {
-		child.pos += length
+	if err := n.insert(newChild, refChild); err != nil {
+		return nil, err
 	}
-	newChildren = append(newChildren, n.childNodes[i:len(n.childNodes)]...)
-	n.childNodes = newChildren
 	return newChild, nil
 }
 
@@ -347,27 +237,53 @@ func (n *Node) ReplaceChild(newChild, oldChild *Node) (*Node, Error) {
 	if newChild.NodeType() == DocumentFragmentNode {
 		return nil, err(HierarchyRequestError)
 	}
-	i := oldChild.pos
-	if oldChild.ParentNode() != n || n.childNodes[i] != oldChild {
+	if oldChild.parentNode != n || n.childNodes[oldChild.pos] != oldChild {
 		return nil, err(NotFoundError)
 	}
-	err := newChild.attach(n, i)
-	if err != nil {
+	if err := newChild.checkAttach(n); err != nil {
 		return nil, err
 	}
-	n.childNodes[i] = newChild
-	oldChild.parentNode = nil
-	oldChild.pos = 0
+	if newChild == oldChild {
+		return oldChild, nil
+	}
+	next := oldChild.NextSibling()
+	if next == newChild {
+		next = newChild.NextSibling()
+	}
+	prev := oldChild.PreviousSibling()
+	if prev == newChild {
+		prev = newChild.PreviousSibling()
+	}
+	n.remove(oldChild)
+	if _, err := n.insertNodes(NodeList{newChild}, next); err != nil {
+		return nil, err
+	}
+	n.ownerDocument.queueChildList(n, NodeList{newChild}, NodeList{oldChild}, prev, next)
 	return oldChild, nil
 }
 
 func (n *Node) RemoveChild(oldChild *Node) (*Node, Error) {
 	n.check()
 	defer n.check()
-	i := oldChild.pos
-	if oldChild.parentNode != n || n.childNodes[i] != oldChild {
+	if oldChild.parentNode != n || n.childNodes[oldChild.pos] != oldChild {
 		return nil, err(NotFoundError)
 	}
+	prev, next := oldChild.PreviousSibling(), oldChild.NextSibling()
+	n.remove(oldChild)
+	n.ownerDocument.queueChildList(n, nil, NodeList{oldChild}, prev, next)
+	return oldChild, nil
+}
+
+// remove removes a child of n without queuing a mutation record.
+func (n *Node) remove(oldChild *Node) {
+	i := oldChild.pos
+	if h := n.ownerDocument.history(); h != nil {
+		h.record(removal{n, oldChild, i, oldChild.nsDirty})
+	}
+	n.ownerDocument.removingNode(oldChild)
+	if n.isConnected() {
+		oldChild.unindexIds()
+	}
 	var newChildren NodeList
 	if i > 0 {
 		newChildren = n.childNodes[0:i]
@@ -381,48 +297,94 @@ func (n *Node) RemoveChild(oldChild *Node) (*Node, Error) {
 	n.childNodes = newChildren
 	oldChild.parentNode = nil
 	oldChild.pos = 0
-	return oldChild, nil
+	n.ownerDocument.treeChanged()
 }
 
 func (n *Node) AppendChild(newChild *Node) (*Node, Error) {
 	n.check()
 	defer n.check()
-	if newChild.NodeType() == DocumentFragmentNode {
-		for _, child := range newChild.ChildNodes() {
-			_, err := n.AppendChild(child)
-			if err != nil {
-				return nil, err
-			}
+	if err := n.insert(newChild, nil); err != nil {
+		return nil, err
+	}
+	return newChild, nil
+}
+
+// insert inserts newChild, or the children of a document fragment, before
+// refChild or at the end if it is nil, and queues the mutation record.
+func (n *Node) insert(newChild, refChild *Node) Error {
+	nodes := NodeList{newChild}
+	if newChild.nodeType == DocumentFragmentNode {
+		nodes = append(NodeList{}, newChild.childNodes...)
+	}
+	inserted, err := n.insertNodes(nodes, refChild)
+	if inserted > 0 {
+		n.ownerDocument.queueChildList(n, nodes[:inserted], nil, nodes[0].PreviousSibling(), refChild)
+	}
+	return err
+}
+
+// insertNodes inserts the nodes before refChild, or at the end if it is nil,
+// and returns how many were inserted.
+func (n *Node) insertNodes(nodes NodeList, refChild *Node) (int, Error) {
+	for k, c := range nodes {
+		if err := c.attach(n); err != nil {
+			return k, err
+		}
+		if h := n.ownerDocument.history(); h != nil {
+			h.record(insertion{n, c})
 		}
-		return newChild, nil
+		if refChild == nil {
+			c.pos = len(n.childNodes)
+			n.childNodes = append(n.childNodes, c)
+			continue
+		}
+		// the position of refChild is only known once c is detached
+		i := refChild.pos
+		c.pos = i
+		children := make(NodeList, 0, len(n.childNodes)+1)
+		children = append(children, n.childNodes[:i]...)
+		children = append(children, c)
+		for _, s := range n.childNodes[i:] {
+			s.pos++
+			children = append(children, s)
+		}
+		n.childNodes = children
+		n.ownerDocument.insertedNodes(n, i, 1)
 	}
+	return len(nodes), nil
+}
 
-	err := newChild.attach(n, len(n.childNodes))
-	if err != nil {
-		return nil, err
+// checkAttach returns an error if n cannot become a child of newParent.
+func (n *Node) checkAttach(newParent *Node) Error {
+	if newParent.OwnerDocument() != n.ownerDocument {
+		return err(WrongDocumentError)
+	} else if newParent == n || newParent.IsAncestor(n) {
+		return err(HierarchyRequestError)
 	}
-	n.childNodes = append(n.childNodes, newChild)
-	return newChild, nil
+	return nil
 }
 
-func (n *Node) attach(newParent *Node, pos int) Error {
+// attach removes n from its parent and makes newParent its parent. The caller
+// adds it to the children of newParent.
+func (n *Node) attach(newParent *Node) Error {
 	newParent.check()
 	n.check()
 	defer n.check()
-	if newParent.OwnerDocument() != n.ownerDocument {
-		return err(WrongDocumentError)
-	} else if newParent.IsAncestor(n) {
-		return err(HierarchyRequestError)
+	if err := n.checkAttach(newParent); err != nil {
+		return err
 	}
 	if n.parentNode != nil {
-		_, err := n.parentNode.RemoveChild(n)
-		if err != nil {
-			panic(err)
+		if _, err := n.parentNode.RemoveChild(n); err != nil {
+			return err
 		}
 	}
+	n.changing()
 	n.parentNode = newParent
-	n.pos = pos
-	newParent.check()
+	n.nsDirty = true
+	n.ownerDocument.treeChanged()
+	if newParent.isConnected() {
+		n.indexIds()
+	}
 	return nil
 }
 
@@ -441,7 +403,15 @@ func (n *Node) HasChildNodes() bool {
 	return len(n.childNodes) > 0
 }
 
+// checkTree enables the verification of the children of the nodes changed by
+// tree operations. It is linear in the number of children and makes building
+// large documents quadratic, so it is only enabled by tests.
+var checkTree = false
+
 func (n *Node) check() *Node {
+	if !checkTree {
+		return n
+	}
 	var prev *Node
 	for i, cn := range n.childNodes {
 		if cn.ParentNode() != n {
@@ -0,0 +1,60 @@
+package xmldom
+
+// LiveNodeList is a list of the descendant elements of a node matching some
+// criteria. As in the DOM it is live: it reflects the changes made to the tree
+// after it was created. The list is computed again on first access after a
+// change to the document.
+type LiveNodeList struct {
+	root    *Node
+	match   func(*Node) bool
+	version uint64
+	valid   bool
+	nodes   NodeList
+}
+
+func newLiveNodeList(root *Node, match func(*Node) bool) *LiveNodeList {
+	return &LiveNodeList{root: root, match: match}
+}
+
+func (l *LiveNodeList) update() {
+	version := l.root.ownerDocument.treeVersion()
+	if l.valid && l.version == version {
+		return
+	}
+	l.nodes = l.nodes[:0]
+	l.collect(l.root)
+	l.version = version
+	l.valid = true
+}
+
+func (l *LiveNodeList) collect(n *Node) {
+	for _, c := range n.childNodes {
+		if c.nodeType != ElementNode {
+			continue
+		}
+		if l.match(c) {
+			l.nodes = append(l.nodes, c)
+		}
+		l.collect(c)
+	}
+}
+
+func (l *LiveNodeList) Item(index int) *Node {
+	l.update()
+	if index < len(l.nodes) && index >= 0 {
+		return l.nodes[index]
+	} else {
+		return nil
+	}
+}
+
+func (l *LiveNodeList) Length() int {
+	l.update()
+	return len(l.nodes)
+}
+
+// Nodes returns a snapshot of the list that does not change with the tree.
+func (l *LiveNodeList) Nodes() NodeList {
+	l.update()
+	return append(NodeList{}, l.nodes...)
+}
@@ -0,0 +1,95 @@
+package xmldom
+
+import "testing"
+
+// listNames returns the names of the elements of a list followed by their n
+// attribute.
+func listNames(l *LiveNodeList) string {
+	var s string
+	for _, n := range l.Nodes() {
+		if s != "" {
+			s += " "
+		}
+		s += n.NodeName() + n.GetAttribute("n")
+	}
+	return s
+}
+
+func TestGetElementsByTagName(t *testing.T) {
+	src := `<r xmlns:p="urn:p"><a n="1"><a n="2"/><p:a n="3"/></a><b><a n="4" xmlns="urn:p"/></b>text<!--a--></r>`
+	tests := []struct {
+		query func(r *Node) *LiveNodeList
+		want  string
+	}{
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagName("a") }, "a1 a2 a4"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagName("p:a") }, "p:a3"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagName("*") }, "a1 a2 p:a3 b a4"},
+		{func(r *Node) *LiveNodeList { return r.FirstChild().GetElementsByTagName("a") }, "a2"},
+		{func(r *Node) *LiveNodeList { return r.OwnerDocument().GetElementsByTagName("r") }, "r"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagNameNS("urn:p", "a") }, "p:a3 a4"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagNameNS("", "a") }, "a1 a2"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagNameNS("*", "a") }, "a1 a2 p:a3 a4"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagNameNS("urn:p", "*") }, "p:a3 a4"},
+		{func(r *Node) *LiveNodeList { return r.GetElementsByTagName("c") }, ""},
+	}
+	for i, test := range tests {
+		doc := parseTraversal(t, src)
+		if got := listNames(test.query(doc.DocumentElement())); got != test.want {
+			t.Errorf("%d: got %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestLiveNodeList(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(doc, r *Node)
+		want string
+	}{
+		{"append", func(doc, r *Node) {
+			e, _ := doc.CreateElement("a")
+			e.SetAttribute("n", "5")
+			r.AppendChild(e)
+		}, "a1 a2 a4 a5"},
+		{"insert subtree", func(doc, r *Node) {
+			e, _ := doc.CreateElement("c")
+			a, _ := doc.CreateElement("a")
+			e.AppendChild(a)
+			r.InsertBefore(e, r.FirstChild())
+		}, "a a1 a2 a4"},
+		{"remove", func(doc, r *Node) {
+			r.RemoveChild(r.FirstChild())
+		}, "a4"},
+		{"move", func(doc, r *Node) {
+			r.AppendChild(r.FirstChild())
+		}, "a4 a1 a2"},
+		{"rename", func(doc, r *Node) {
+			r.FirstChild().FirstChild().SetNodeName("c")
+		}, "a1 a4"},
+		{"detached subtree", func(doc, r *Node) {
+			a := r.FirstChild()
+			r.RemoveChild(a)
+			e, _ := doc.CreateElement("a")
+			a.AppendChild(e)
+		}, "a4"},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, `<r><a n="1"><a n="2"/></a><b><a n="4"/></b></r>`)
+		r := doc.DocumentElement()
+		list := r.GetElementsByTagName("a")
+		nodes := list.Nodes()
+		if list.Length() != 3 {
+			t.Fatalf("%s: %d nodes before the edit", test.name, list.Length())
+		}
+		test.edit(doc, r)
+		if got := listNames(list); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if len(nodes) != 3 {
+			t.Errorf("%s: the snapshot changed to %d nodes", test.name, len(nodes))
+		}
+		if list.Item(list.Length()) != nil || list.Item(-1) != nil {
+			t.Errorf("%s: Item out of range is not nil", test.name)
+		}
+	}
+}
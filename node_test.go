@@ -0,0 +1,70 @@
+package xmldom
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain enables the verification of the tree after each tree operation
+// for all the tests of the package.
+func TestMain(m *testing.M) {
+	checkTree = true
+	os.Exit(m.Run())
+}
+
+// checkChildren reports the children of n that do not know their parent or
+// their position.
+func checkChildren(t *testing.T, n *Node) {
+	t.Helper()
+	for i, c := range n.childNodes {
+		if c.parentNode != n || c.pos != i {
+			t.Errorf("child %d of %s has parent %p and position %d", i, n.nodeName, c.parentNode, c.pos)
+		}
+	}
+}
+
+func TestInsertFragment(t *testing.T) {
+	doc := parseTraversal(t, `<a><b/><c/></a>`)
+	a := doc.DocumentElement()
+	fragment := doc.CreateDocumentFragment()
+	for _, name := range []string{"x", "y"} {
+		e, _ := doc.CreateElement(name)
+		fragment.AppendChild(e)
+	}
+	if _, e := a.InsertBefore(fragment, a.LastChild()); e != nil {
+		t.Fatal(e)
+	}
+	if doc.XML() != `<a><b/><x/><y/><c/></a>` || len(fragment.ChildNodes()) != 0 {
+		t.Errorf("document %s, fragment %s", doc.XML(), fragment.XML())
+	}
+	checkChildren(t, a)
+}
+
+func TestMoveChild(t *testing.T) {
+	tests := []struct {
+		op   string
+		move func(a, b, c, d *Node) (*Node, Error)
+		want string
+	}{
+		{"InsertBefore(b, d)", func(a, b, c, d *Node) (*Node, Error) { return a.InsertBefore(b, d) }, `<a><c/><b/><d/></a>`},
+		{"InsertBefore(d, b)", func(a, b, c, d *Node) (*Node, Error) { return a.InsertBefore(d, b) }, `<a><d/><b/><c/></a>`},
+		{"InsertBefore(b, c)", func(a, b, c, d *Node) (*Node, Error) { return a.InsertBefore(b, c) }, `<a><b/><c/><d/></a>`},
+		{"InsertBefore(c, c)", func(a, b, c, d *Node) (*Node, Error) { return a.InsertBefore(c, c) }, `<a><b/><c/><d/></a>`},
+		{"AppendChild(b)", func(a, b, c, d *Node) (*Node, Error) { return a.AppendChild(b) }, `<a><c/><d/><b/></a>`},
+		{"ReplaceChild(d, b)", func(a, b, c, d *Node) (*Node, Error) { return a.ReplaceChild(d, b) }, `<a><d/><c/></a>`},
+		{"ReplaceChild(b, c)", func(a, b, c, d *Node) (*Node, Error) { return a.ReplaceChild(b, c) }, `<a><b/><d/></a>`},
+		{"ReplaceChild(c, c)", func(a, b, c, d *Node) (*Node, Error) { return a.ReplaceChild(c, c) }, `<a><b/><c/><d/></a>`},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, `<a><b/><c/><d/></a>`)
+		a := doc.DocumentElement()
+		if _, e := test.move(a, element(doc, "b"), element(doc, "c"), element(doc, "d")); e != nil {
+			t.Errorf("%s: %v", test.op, e)
+			continue
+		}
+		if got := doc.XML(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.op, got, test.want)
+		}
+		checkChildren(t, a)
+	}
+}
@@ -0,0 +1,44 @@
+package xmldom
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// ParseError is returned by the parser when a document is malformed.
+type ParseError struct {
+	Position
+	Msg     string
+	Snippet string   // source text of the line around the error
+	Stack   []string // names of the elements open at the error, outermost first
+	Err     error    // error from the decoder or the reader, if any
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("XML syntax error on line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError creates a parse error at pos, with the elements open from parent
+// to node.
+func (p *parser) parseError(r *xmlReader, pos Position, node, parent *Node, msg string, e error) *ParseError {
+	if se, ok := e.(*xml.SyntaxError); ok {
+		msg = se.Msg
+	} else if e != nil {
+		msg = e.Error()
+	}
+	var stack []string
+	for n := node; n != nil && n != parent; n = n.parentNode {
+		stack = append([]string{n.nodeName}, stack...)
+	}
+	return &ParseError{
+		Position: p.sourcePosition(pos),
+		Msg:      msg,
+		Snippet:  r.snippet(),
+		Stack:    stack,
+		Err:      e,
+	}
+}
@@ -0,0 +1,67 @@
+package xmldom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		src     string
+		pos     Position
+		snippet string
+		stack   []string
+	}{
+		{"<a><b></a>", Position{1, 7, 6}, "<a><b></a>", []string{"a", "b"}},
+		{"<a>\n  <b>\n    <c x='1' x='2'/>\n  </b>\n</a>", Position{3, 14, 23}, "    <c x='1' x='2'/>", []string{"a", "b", "c"}},
+		{"<a>\n</b>", Position{2, 1, 4}, "</b>", []string{"a"}},
+		{"<a>", Position{1, 4, 3}, "<a>", []string{"a"}},
+		{"<a>é</a><", Position{1, 11, 10}, "<a>é</a><", nil},
+		{"<a>&</a>", Position{1, 5, 4}, "<a>&</a>", []string{"a"}},
+	}
+	for _, test := range tests {
+		_, err := ParseXMLWithOptions(strings.NewReader(test.src), &ParseOptions{Strict: true})
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: returned %T %v, want *ParseError", test.src, err, err)
+			continue
+		}
+		if pe.Position != test.pos {
+			t.Errorf("%q: position %+v, want %+v (%s)", test.src, pe.Position, test.pos, pe.Msg)
+		}
+		if pe.Snippet != test.snippet {
+			t.Errorf("%q: snippet %q, want %q", test.src, pe.Snippet, test.snippet)
+		}
+		if strings.Join(pe.Stack, " ") != strings.Join(test.stack, " ") {
+			t.Errorf("%q: stack %q, want %q", test.src, pe.Stack, test.stack)
+		}
+		if pe.Msg == "" || !strings.Contains(pe.Error(), fmt.Sprintf("line %d, column %d", test.pos.Line, test.pos.Column)) {
+			t.Errorf("%q: message %q", test.src, pe.Error())
+		}
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestParseErrorUnwrap(t *testing.T) {
+	readErr := errors.New("read failed")
+	_, err := ParseXML(io.MultiReader(strings.NewReader("<a>"), failingReader{readErr}))
+	if _, ok := err.(*ParseError); !ok || !errors.Is(err, readErr) {
+		t.Errorf("returned %T %v, want a *ParseError wrapping the read error", err, err)
+	}
+	charsetErr := errors.New("unknown charset")
+	opts := &ParseOptions{CharsetReader: func(string, io.Reader) (io.Reader, error) {
+		return nil, charsetErr
+	}}
+	_, err = ParseXMLWithOptions(strings.NewReader(`<?xml version="1.0" encoding="x-test"?><a/>`), opts)
+	if pe, ok := err.(*ParseError); !ok || !errors.Is(err, charsetErr) || pe.Position != (Position{1, 1, 0}) {
+		t.Errorf("returned %T %v, want a *ParseError wrapping the charset error", err, err)
+	}
+}
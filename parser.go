@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"strings"
 )
 
 var l *log.Logger = log.New(ioutil.Discard, "", log.LstdFlags)
@@ -19,36 +20,41 @@ func xmlName(n xml.Name) string {
 	}
 }
 
-func (parent *Node) NewChildFromToken(tok xml.Token, data string) *Node {
+// NewChildFromToken appends to parent the node for a token read by the
+// decoder from the source text data.
+func (parent *Node) NewChildFromToken(tok xml.Token, data string) (*Node, Error) {
 	var n *Node
-	var err error
+	var err Error
 	doc := parent.ownerDocument
 	switch tok := tok.(type) {
 	case xml.StartElement:
 		se := parseStartElement(data)
+		if len(se.Attributes) != len(tok.Attr) {
+			return nil, &DOMError{SyntaxError}
+		}
 		n, err = doc.CreateElement(xmlName(tok.Name))
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		for i, attr := range tok.Attr {
 			sea := se.Attributes[i]
 			if xmlName(attr.Name) != sea.Name {
-				panic("unexpected name")
+				return nil, &DOMError{SyntaxError}
 			}
 			a, err := doc.CreateAttribute(xmlName(attr.Name))
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
 			a.SetNodeValue(attr.Value)
 			a.Raw = []string{sea.Before, sea.Name, sea.Between, sea.Value, sea.After}
 			a.ValueDirty = false
 			l.Printf("attr: %#v", a)
-			n.SetAttributeNode(a)
+			if _, err := n.SetAttributeNode(a); err != nil {
+				return nil, err
+			}
 		}
 		n.Raw = []string{se.Before, se.TagName, se.After}
 		n.ValueDirty = false
-	case xml.EndElement:
-		panic("end element")
 	case xml.CharData:
 		n = doc.CreateTextNode(string(tok))
 		n.Raw = append(n.Raw, data)
@@ -59,21 +65,34 @@ func (parent *Node) NewChildFromToken(tok xml.Token, data string) *Node {
 		n.ValueDirty = false
 	case xml.ProcInst: // Processing Instruction
 		n, err = doc.CreateProcessingInstruction(tok.Target, string(tok.Inst))
+		if err != nil {
+			return nil, err
+		}
 		n.Raw = append(n.Raw, data)
 		n.ValueDirty = false
 	case xml.Directive:
-		n = doc.CreateDocumentType(string(tok))
+		// the decoder replaces comments with spaces in directives, parse the
+		// source text to keep them in the internal subset
+		directive := string(tok)
+		if strings.HasPrefix(data, "<!") && strings.HasSuffix(data, ">") {
+			directive = data[2 : len(data)-1]
+		}
+		n = doc.CreateDocumentType(directive)
+		if n.decl != nil {
+			doc.declareIdAttributes(n.decl.internalSubset)
+		}
 		n.Raw = append(n.Raw, data)
 		n.ValueDirty = false
+	default:
+		return nil, &DOMError{NotSupportedError}
 	}
-	if err != nil {
-		panic(err)
+	if _, err = parent.AppendChild(n); err != nil {
+		return nil, err
 	}
-	_, err = parent.AppendChild(n)
-	if err != nil {
-		panic(err)
+	if n.nodeType == ElementNode {
+		n.resolveNamespaces()
 	}
-	return n
+	return n, nil
 }
 
 type xmlReader struct {
@@ -83,13 +102,32 @@ type xmlReader struct {
 	offset int64
 	acc    []byte
 	last   []byte
+	recent []byte // last bytes read, for error snippets
 }
 
 func (r *xmlReader) Read(p []byte) (n int, err error) {
-	panic("Read")
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0], err = r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
 }
 
 func (r *xmlReader) ReadByte() (byte, error) {
+	r.consumeLast()
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return b, err
+	}
+	r.last = append(r.last, b)
+	return b, nil
+}
+
+// consumeLast counts the byte read last and appends it to acc.
+func (r *xmlReader) consumeLast() {
 	for _, b := range r.last {
 		r.offset++
 		if b == '\n' {
@@ -99,46 +137,222 @@ func (r *xmlReader) ReadByte() (byte, error) {
 			r.col++
 		}
 		r.acc = append(r.acc, b)
+		r.recent = append(r.recent, b)
 	}
 	r.last = nil
-	b, err := r.r.ReadByte()
-	if err != nil {
-		return b, err
+	if len(r.recent) > 2*snippetLength {
+		r.recent = append(r.recent[:0], r.recent[len(r.recent)-snippetLength:]...)
 	}
-	r.last = append(r.last, b)
-	return b, nil
+}
+
+// pos returns the position of the next byte to count.
+func (r *xmlReader) pos() Position {
+	return Position{Line: int(r.line) + 1, Column: int(r.col) + 1, Offset: r.offset}
+}
+
+const snippetLength = 40
+
+// snippet returns the text of the current line around the reading position.
+// It reads ahead in the input and must only be called once parsing stopped.
+func (r *xmlReader) snippet() string {
+	before := r.recent
+	if len(before) > snippetLength {
+		before = before[len(before)-snippetLength:]
+	}
+	if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+	after := append([]byte{}, r.last...)
+	for len(after) < snippetLength && bytes.IndexByte(after, '\n') < 0 {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			break
+		}
+		after = append(after, b)
+	}
+	if i := bytes.IndexByte(after, '\n'); i >= 0 {
+		after = after[:i]
+	}
+	return string(before) + string(after)
+}
+
+// ParseOptions controls how documents are parsed. The zero value parses
+// documents as ParseXML does.
+type ParseOptions struct {
+	// Entities selects how references to entities other than the predefined
+	// ones are handled.
+	Entities EntityMode
+	// Entity maps entity names to their replacement text, like
+	// xml.Decoder.Entity. The replacement text is never parsed for markup.
+	Entity map[string]string
+	// Strict rejects documents that are not well-formed: the errors rejected
+	// by xml.Decoder.Strict and the errors that ParseXMLRecover reports as
+	// diagnostics. Otherwise the parser repairs them.
+	Strict bool
+	// CharsetReader converts documents declared in an encoding other than
+	// UTF-8, ISO-8859-1, US-ASCII, windows-1252 and UTF-16 to UTF-8, like
+	// xml.Decoder.CharsetReader. Raw holds the converted text, and positions
+	// count its bytes.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+	// StripWhitespace drops the text nodes that only contain whitespace.
+	// Whitespace in CDATA sections is kept.
+	StripWhitespace bool
+	// DiscardComments drops comments.
+	DiscardComments bool
+	// DiscardProcInsts drops processing instructions other than the XML
+	// declaration.
+	DiscardProcInsts bool
+	// CDATASections parses CDATA sections as CDATASectionNode nodes instead
+	// of text nodes.
+	CDATASections bool
+	// CoalesceCDATA merges the text of CDATA sections with the adjacent text
+	// nodes. It takes precedence over CDATASections.
+	CoalesceCDATA bool
+	// DiscardRaw does not record the source text of the nodes in Raw. This
+	// saves memory when documents do not need to be serialized as they were
+	// parsed.
+	DiscardRaw bool
+}
+
+type parser struct {
+	opts ParseOptions
+	doc  *Node
+	// replacement text of the entities expanded by the decoder
+	entities map[string]string
+	// entities whose replacement text is being parsed, to stop recursion
+	expanding map[string]bool
+	// size of the text of the entity references created so far
+	expansion int
+	// the input was converted to UTF-8 before the decoder
+	transcoded bool
+	// maps the positions in the text read by the decoder to the input, nil
+	// if they are the same
+	source *sourceMap
+	// well-formedness errors are recorded in diagnostics
+	recover     bool
+	diagnostics []Diagnostic
 }
 
 func ParseXML(rr io.Reader) (*Node, error) {
+	return ParseXMLWithOptions(rr, nil)
+}
+
+// ParseXMLWithEntities parses a document, handling the references to entities
+// other than the predefined ones according to mode. It is a shorthand for
+// ParseXMLWithOptions.
+func ParseXMLWithEntities(rr io.Reader, mode EntityMode, entity map[string]string) (*Node, error) {
+	return ParseXMLWithOptions(rr, &ParseOptions{Entities: mode, Entity: entity})
+}
+
+func ParseXMLWithOptions(rr io.Reader, opts *ParseOptions) (*Node, error) {
+	p := newParser(opts)
+	if err := p.parseDocument(rr); err != nil {
+		return nil, err
+	}
+	return p.doc, nil
+}
+
+func newParser(opts *ParseOptions) *parser {
+	p := &parser{doc: NewDocument(), expanding: map[string]bool{}}
+	if opts != nil {
+		p.opts = *opts
+	}
+	p.entities = map[string]string{}
+	for name, value := range p.opts.Entity {
+		p.entities[name] = value
+	}
+	return p
+}
+
+// parseDocument parses the document in rr into p.doc, converting it to UTF-8
+// from the encoding its byte order mark or XML declaration tells. Positions
+// are counted in the bytes of rr.
+func (p *parser) parseDocument(rr io.Reader) error {
+	input := &countingReader{r: rr}
+	br := bufio.NewReader(input)
+	rr = br
+	encoding, bom := sniffBOM(br)
+	if encoding == "" {
+		encoding = sniffEncoding(br)
+	}
+	if bom {
+		p.source = &sourceMap{base: input.n - int64(br.Buffered())}
+	}
+	switch cs := lookupCharset(encoding); {
+	case cs != nil:
+		encoding = cs.name
+		if p.source == nil {
+			p.source = &sourceMap{}
+		}
+		rr = &charsetReader{r: br, input: input, source: p.source, charset: cs}
+		p.transcoded = true
+	case encoding == "" || strings.EqualFold(encoding, "utf-8"):
+		encoding = "UTF-8"
+	case p.opts.CharsetReader != nil:
+		cr, err := p.opts.CharsetReader(encoding, br)
+		if err != nil {
+			return p.parseError(&xmlReader{r: br}, Position{Line: 1, Column: 1}, nil, nil, "", err)
+		}
+		rr = cr
+		p.transcoded = true
+	}
+	p.doc.state.encoding = encoding
+	p.doc.state.bom = bom
+	return p.parse(rr, p.doc)
+}
+
+// parse parses the content of rr as children of parent.
+func (p *parser) parse(rr io.Reader, parent *Node) error {
 	var r *xmlReader
 	if rb, ok := rr.(io.ByteReader); ok {
-		r = &xmlReader{rb, 0, 0, 0, nil, nil}
+		r = &xmlReader{r: rb}
 	} else {
-		r = &xmlReader{bufio.NewReader(rr), 0, 0, 0, nil, nil}
+		r = &xmlReader{r: bufio.NewReader(rr)}
 	}
 
 	decoder := xml.NewDecoder(r)
-	decoder.Strict = false
-	doc := NewDocument()
-	node := doc
+	decoder.Strict = p.opts.Strict
+	decoder.Entity = p.entities
+	if p.transcoded {
+		decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+	doc := p.doc
+	node := parent
 	for {
 		//l.Println()
 		//l.Printf("Before token o=%d l=%d c=%d", r.offset, r.line+1, r.col+1)
 		//l.Printf("xml offset=%d", decoder.InputOffset())
 		r.acc = nil
+		start := r.pos()
 		tok, err := decoder.RawToken()
 		switch {
 		case err == io.EOF:
 			//l.Printf("End of File")
+			for n := node; n != nil && n != parent; n = n.parentNode {
+				if e := p.report(r, n, parent, UnclosedElement, r.pos(), "element <"+n.nodeName+"> not closed", "closed at the end of the document"); e != nil {
+					return e
+				}
+			}
+			if parent == doc && doc.DocumentElement() == nil {
+				if e := p.report(r, node, parent, MissingRootElement, r.pos(), "no root element", "document kept without element"); e != nil {
+					return e
+				}
+			}
 			goto quit
 		case err != nil:
-			return nil, err
+			return p.parseError(r, r.pos(), node, parent, "", err)
 		}
 
 		inclLast := false
 		switch tok.(type) {
 		case xml.ProcInst:
 			inclLast = true
+		case xml.Comment:
+			inclLast = true
+		case xml.Directive:
+			inclLast = true
 		case xml.EndElement:
 			inclLast = true
 		case xml.StartElement:
@@ -149,9 +363,9 @@ func ParseXML(rr io.Reader) (*Node, error) {
 			}
 		}
 		if inclLast {
-			r.acc = append(r.acc, r.last...)
-			r.last = nil
+			r.consumeLast()
 		}
+		end := r.pos()
 
 		//l.Printf("After token o=%d l=%d c=%d", r.offset, r.line+1, r.col+1)
 		//l.Printf("acc=%#v", string(r.acc))
@@ -161,30 +375,185 @@ func ParseXML(rr io.Reader) (*Node, error) {
 		switch tok := tok.(type) {
 		default:
 			l.Printf("node: %#v", string(r.acc))
-			node.NewChildFromToken(tok, string(r.acc))
+			if p.discard(tok) {
+				continue
+			}
+			n, err := node.NewChildFromToken(tok, string(r.acc))
+			if err != nil {
+				return p.parseError(r, start, node, parent, "", err)
+			}
+			p.discardRaw(n)
+			p.setSource(n, start, end)
+			if n.decl != nil && !p.declareEntities(n) {
+				return p.parseError(r, start, node, parent, "entity expansion limit exceeded", nil)
+			}
+		case xml.CharData:
+			l.Printf("text: %#v", string(r.acc))
+			cdata := bytes.HasPrefix(r.acc, []byte("<![CDATA["))
+			if p.checking() && !cdata {
+				if e := p.checkText(r, node, parent, start, string(r.acc)); e != nil {
+					return e
+				}
+			}
+			if p.opts.StripWhitespace && !cdata && isWhitespace(string(tok)) {
+				continue
+			}
+			switch {
+			case cdata && p.opts.CDATASections && !p.opts.CoalesceCDATA:
+				n, _ := doc.CreateCDATASection(string(tok))
+				n.Raw = append(n.Raw, string(r.acc))
+				node.AppendChild(n)
+				p.discardRaw(n)
+				p.setSource(n, start, end)
+			case p.opts.Entities == EntityKeep && !cdata,
+				p.opts.Entities == EntityExpand && !cdata && p.hasMarkupReference(string(r.acc)):
+				p.appendText(node, string(r.acc), start)
+				if p.expansion > maxEntityExpansion {
+					return p.parseError(r, start, node, parent, "entity expansion limit exceeded", nil)
+				}
+			default:
+				last := node.LastChild()
+				n, err := node.NewChildFromToken(tok, string(r.acc))
+				if err != nil {
+					return p.parseError(r, start, node, parent, "", err)
+				}
+				p.discardRaw(n)
+				p.setSource(n, start, end)
+				if p.opts.CoalesceCDATA && last != nil && last.nodeType == TextNode {
+					last.mergeText(n)
+					p.setEnd(last, end)
+					node.RemoveChild(n)
+				}
+			}
 		case xml.StartElement:
 			l.Printf("start: %#v", string(r.acc))
-			node = node.NewChildFromToken(tok, string(r.acc))
+			n, err := node.NewChildFromToken(tok, string(r.acc))
+			if err != nil {
+				return p.parseError(r, start, node, parent, "", err)
+			}
+			node = n
+			if p.checking() {
+				if e := p.checkStartElement(r, n, parent, start, string(r.acc)); e != nil {
+					return e
+				}
+			}
+			p.setSource(node, start, end)
+			p.setAttributesSource(node, start, string(r.acc))
+			p.discardRaw(node)
 		case xml.EndElement:
 			l.Printf("end: %#v", string(r.acc))
-			for node.parentNode != nil && xmlName(tok.Name) != node.nodeName {
-				p := node.parentNode
-				for _, n := range node.childNodes {
-					_, err := p.AppendChild(n)
-					if err != nil {
-						panic(err)
+			name := xmlName(tok.Name)
+			open := node
+			for open != nil && open != parent && name != open.nodeName {
+				open = open.parentNode
+			}
+			if open == nil || open == parent {
+				// no element to close, ignore the end tag
+				if e := p.report(r, node, parent, UnexpectedEndTag, start, "unexpected end tag </"+name+">", "ignored"); e != nil {
+					return e
+				}
+				continue
+			}
+			for node != open {
+				if e := p.report(r, node, parent, UnclosedElement, start, "element <"+node.nodeName+"> not closed before </"+name+">", "content moved after it"); e != nil {
+					return e
+				}
+				up := node.parentNode
+				for len(node.childNodes) > 0 {
+					n := node.childNodes[0]
+					if _, err := up.AppendChild(n); err != nil {
+						return p.parseError(r, start, node, parent, "", err)
 					}
+					n.nsDirty = false
 				}
-				node.childNodes = NodeList{}
-				node = p
+				node = up
 			}
-			node.Raw = append(node.Raw, string(r.acc))
+			if !p.opts.DiscardRaw {
+				node.Raw = append(node.Raw, string(r.acc))
+			}
+			p.setEnd(node, end)
 			l.Printf("end2: %#v, %#v", string(node.nodeName), node.parentNode)
 			node = node.parentNode
 			l.Printf("end2: %#v", string(node.nodeName))
 		}
 	}
 quit:
-	l.Printf("doc: %s", doc.XML())
-	return doc, nil
+	for n := node; n != nil && n != parent; n = n.parentNode {
+		p.setEnd(n, r.pos())
+	}
+	if parent == doc {
+		p.setSource(doc, Position{Line: 1, Column: 1}, r.pos())
+	}
+	return nil
+}
+
+// discard tells whether the node for tok is dropped by the options.
+func (p *parser) discard(tok xml.Token) bool {
+	switch tok := tok.(type) {
+	case xml.Comment:
+		return p.opts.DiscardComments
+	case xml.ProcInst:
+		return p.opts.DiscardProcInsts && tok.Target != "xml"
+	}
+	return false
+}
+
+// discardRaw removes the source text of a new node if the options say so.
+func (p *parser) discardRaw(n *Node) {
+	if !p.opts.DiscardRaw {
+		return
+	}
+	n.Raw = nil
+	if n.attributes != nil {
+		for i := 0; i < n.attributes.Length(); i++ {
+			n.attributes.Item(i).Raw = nil
+		}
+	}
+}
+
+func isWhitespace(s string) bool {
+	return strings.Trim(s, " \t\r\n") == ""
+}
+
+// sniffEncoding returns the encoding declared by the XML declaration at the
+// start of br, if any.
+func sniffEncoding(br *bufio.Reader) string {
+	b, _ := br.Peek(1024)
+	if !bytes.HasPrefix(b, []byte("<?xml")) {
+		return ""
+	}
+	end := bytes.Index(b, []byte("?>"))
+	if end < 0 {
+		return ""
+	}
+	decl := string(b[:end])
+	i, j := pseudoAttribute(decl, "encoding")
+	if i < 0 {
+		return ""
+	}
+	return decl[i:j]
+}
+
+// pseudoAttribute returns the start and end offsets of the value of a
+// pseudo-attribute in an XML declaration, or -1, -1 if it is missing.
+func pseudoAttribute(decl, name string) (int, int) {
+	i := strings.Index(decl, name)
+	if i < 0 {
+		return -1, -1
+	}
+	i += len(name)
+	i += len(decl[i:]) - len(strings.TrimLeft(decl[i:], " \t\r\n"))
+	if !strings.HasPrefix(decl[i:], "=") {
+		return -1, -1
+	}
+	i++
+	i += len(decl[i:]) - len(strings.TrimLeft(decl[i:], " \t\r\n"))
+	if i == len(decl) || (decl[i] != '"' && decl[i] != '\'') {
+		return -1, -1
+	}
+	j := strings.IndexByte(decl[i+1:], decl[i])
+	if j < 0 {
+		return -1, -1
+	}
+	return i + 1, i + 1 + j
 }
@@ -0,0 +1,120 @@
+package xmldom
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseRoundTrip checks that an unmodified document is written back as it
+// was read, markup included.
+func TestParseRoundTrip(t *testing.T) {
+	tests := []string{
+		`<a/>`,
+		`<a>text</a>`,
+		`<!-- comment --><a/>`,
+		`<a><!--x--><!----></a>`,
+		`<!DOCTYPE a><a/>`,
+		`<!DOCTYPE a SYSTEM "a.dtd"><a/>`,
+		`<?xml version="1.0"?><a/>`,
+		`<a><?pi data?></a>`,
+		`<a><![CDATA[<x>]]></a>`,
+		`<a b='1'  c="2" ></a >`,
+	}
+	for _, src := range tests {
+		doc, err := ParseXML(strings.NewReader(src))
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got := doc.XML(); got != src {
+			t.Errorf("got %q, want %q", got, src)
+		}
+	}
+}
+
+func TestParseCDATA(t *testing.T) {
+	tests := []struct {
+		opts  *ParseOptions
+		types []NodeType
+		text  string
+	}{
+		{nil, []NodeType{TextNode, TextNode, TextNode}, "a<b>c"},
+		{&ParseOptions{CDATASections: true}, []NodeType{TextNode, CDATASectionNode, TextNode}, "a<b>c"},
+		{&ParseOptions{CoalesceCDATA: true}, []NodeType{TextNode}, "a<b>c"},
+		{&ParseOptions{CDATASections: true, CoalesceCDATA: true}, []NodeType{TextNode}, "a<b>c"},
+	}
+	for _, test := range tests {
+		doc, err := ParseXMLWithOptions(strings.NewReader(`<a>a<![CDATA[<b>]]>c</a>`), test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []NodeType
+		for c := doc.DocumentElement().FirstChild(); c != nil; c = c.NextSibling() {
+			types = append(types, c.NodeType())
+		}
+		if !reflect.DeepEqual(types, test.types) {
+			t.Errorf("%+v: node types %v, want %v", test.opts, types, test.types)
+		}
+		if text := doc.DocumentElement().AsText(); text != test.text {
+			t.Errorf("%+v: text %q, want %q", test.opts, text, test.text)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	src := "<?xml version=\"1.0\"?>\n<!-- c -->\n<a  x = '1'>\n  <?pi data?>\n  <b> t </b>\n  <!-- d -->\n</a>\n"
+	tests := []struct {
+		opts *ParseOptions
+		want string
+	}{
+		{nil, src},
+		{&ParseOptions{}, src},
+		{&ParseOptions{StripWhitespace: true}, "<?xml version=\"1.0\"?><!-- c --><a  x = '1'><?pi data?><b> t </b><!-- d --></a>"},
+		{&ParseOptions{DiscardComments: true}, "<?xml version=\"1.0\"?>\n\n<a  x = '1'>\n  <?pi data?>\n  <b> t </b>\n  \n</a>\n"},
+		{&ParseOptions{DiscardProcInsts: true}, "<?xml version=\"1.0\"?>\n<!-- c -->\n<a  x = '1'>\n  \n  <b> t </b>\n  <!-- d -->\n</a>\n"},
+		{&ParseOptions{DiscardRaw: true}, "<?xml version=\"1.0\"?>\n<!-- c -->\n<a x=\"1\">\n  <?pi data?>\n  <b> t </b>\n  <!-- d -->\n</a>\n"},
+		{&ParseOptions{StripWhitespace: true, DiscardComments: true, DiscardProcInsts: true}, "<?xml version=\"1.0\"?><a  x = '1'><b> t </b></a>"},
+	}
+	for _, test := range tests {
+		doc, err := ParseXMLWithOptions(strings.NewReader(src), test.opts)
+		if err != nil {
+			t.Errorf("%+v: %v", test.opts, err)
+			continue
+		}
+		if got := doc.XML(); got != test.want {
+			t.Errorf("%+v: got %q, want %q", test.opts, got, test.want)
+		}
+	}
+}
+
+func TestParseCharsetReader(t *testing.T) {
+	src := "<?xml version=\"1.0\" encoding=\"x-test\"?><a>\x80\x81\x82</a>"
+	// x-test maps the bytes from 0x80 to the lowercase letters
+	charsetReader := func(charset string, input io.Reader) (io.Reader, error) {
+		if charset != "x-test" {
+			return nil, fmt.Errorf("unknown charset %s", charset)
+		}
+		b, err := ioutil.ReadAll(input)
+		for i, c := range b {
+			if c >= 0x80 {
+				b[i] = 'a' + c - 0x80
+			}
+		}
+		return bytes.NewReader(b), err
+	}
+	if _, err := ParseXML(strings.NewReader(src)); err == nil {
+		t.Error("parsed an unknown encoding without a CharsetReader")
+	}
+	doc, err := ParseXMLWithOptions(strings.NewReader(src), &ParseOptions{CharsetReader: charsetReader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := doc.DocumentElement().AsText(); text != "abc" || doc.InputEncoding() != "x-test" {
+		t.Errorf("text %q in %s", text, doc.InputEncoding())
+	}
+}
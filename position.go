@@ -0,0 +1,159 @@
+package xmldom
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Position is a location in the source text of a document. Columns and
+// offsets count the bytes of the input, before its conversion to UTF-8.
+type Position struct {
+	Line   int   // starting at 1
+	Column int   // starting at 1, counted in bytes
+	Offset int64 // starting at 0, in bytes
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// advance returns the position after the text s starting at p.
+func (p Position) advance(s string) Position {
+	for i := 0; i < len(s); i++ {
+		p.Offset++
+		if s[i] == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
+
+// SourceRange is the location of a node in the source text it was parsed
+// from. End is the position just after the node: after the end tag of
+// elements and after the closing quote of attributes.
+type SourceRange struct {
+	Start Position
+	End   Position
+}
+
+func (r SourceRange) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// SourceRange returns the location of the node in the source text of its
+// document. It returns false for nodes that were not created by the parser,
+// or that were parsed from the replacement text of an entity. Clones keep the
+// location of the node they were cloned from.
+func (n *Node) SourceRange() (SourceRange, bool) {
+	if n.source == nil {
+		return SourceRange{}, false
+	}
+	return *n.source, true
+}
+
+// setSource records the location of a parsed node, unless the parser is
+// parsing the replacement text of an entity.
+func (p *parser) setSource(n *Node, start, end Position) {
+	if len(p.expanding) > 0 {
+		return
+	}
+	n.source = &SourceRange{p.sourcePosition(start), p.sourcePosition(end)}
+}
+
+// setEnd records where a parsed element ends.
+func (p *parser) setEnd(n *Node, end Position) {
+	if n.source != nil {
+		n.source.End = p.sourcePosition(end)
+	}
+}
+
+// sourcePosition returns the position in the input of the document of pos,
+// a position in the text read by the decoder.
+func (p *parser) sourcePosition(pos Position) Position {
+	if len(p.expanding) > 0 {
+		return pos
+	}
+	return p.source.position(pos)
+}
+
+// sourceMap maps the offsets in the UTF-8 text read by the decoder to the
+// offsets in the input of a document that starts with a byte order mark or
+// was converted to UTF-8.
+type sourceMap struct {
+	base  int64 // length of the byte order mark
+	runs  []sourceRun
+	text  int64 // end of the last run in the text
+	input int64 // end of the last run in the input, after base
+}
+
+// sourceRun is a run of characters that take size bytes in the text and
+// width bytes in the input.
+type sourceRun struct {
+	text, input int64 // start of the run
+	size, width int
+}
+
+// add maps the next character, of size bytes in the text and width bytes in
+// the input.
+func (m *sourceMap) add(size, width int) {
+	if k := len(m.runs); k == 0 || m.runs[k-1].size != size || m.runs[k-1].width != width {
+		m.runs = append(m.runs, sourceRun{m.text, m.base + m.input, size, width})
+	}
+	m.text += int64(size)
+	m.input += int64(width)
+}
+
+// offset returns the offset in the input of the offset o in the text.
+func (m *sourceMap) offset(o int64) int64 {
+	i := sort.Search(len(m.runs), func(i int) bool { return m.runs[i].text > o }) - 1
+	if i < 0 {
+		return m.base + o
+	}
+	r := m.runs[i]
+	o -= r.text
+	return r.input + o/int64(r.size)*int64(r.width) + o%int64(r.size)
+}
+
+// position returns the position in the input of pos, a position in the text.
+// Columns are counted in input bytes from the start of the line, after the
+// byte order mark on the first line.
+func (m *sourceMap) position(pos Position) Position {
+	if m == nil {
+		return pos
+	}
+	offset := m.offset(pos.Offset)
+	line := m.offset(pos.Offset - int64(pos.Column-1))
+	return Position{Line: pos.Line, Column: int(offset-line) + 1, Offset: offset}
+}
+
+// setAttributesSource records the location of the attributes of an element
+// from the source text of its start tag.
+func (p *parser) setAttributesSource(n *Node, start Position, data string) {
+	if n.attributes == nil || n.source == nil {
+		return
+	}
+	_, ranges := attributeRanges(start, data)
+	for i, rng := range ranges {
+		if i < n.attributes.Length() {
+			p.setSource(n.attributes.Item(i), rng.Start, rng.End)
+		}
+	}
+}
+
+// attributeRanges parses the source text of a start tag found at start, and
+// returns the location of its attributes.
+func attributeRanges(start Position, data string) (startElement, []SourceRange) {
+	se := parseStartElement(data)
+	ranges := make([]SourceRange, len(se.Attributes))
+	pos := start.advance(se.Before + se.TagName)
+	for i, sea := range se.Attributes {
+		pos = pos.advance(sea.Before)
+		end := pos.advance(sea.Name + sea.Between + sea.Value + sea.After)
+		ranges[i] = SourceRange{pos, end}
+		pos = end
+	}
+	return se, ranges
+}
@@ -0,0 +1,99 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceRange(t *testing.T) {
+	src := "<?xml version=\"1.0\"?>\n<!DOCTYPE r [<!ENTITY e \"<i>x</i>\">]>\n<r a=\"1\"  b = 'é'>\n" +
+		"  <c>text &e; é</c><!-- comment -->\n  <?pi data?><![CDATA[cd]]><d/>\n</r>"
+	doc, err := ParseXMLWithEntities(strings.NewReader(src), EntityKeep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := doc.DocumentElement()
+	c := r.ChildNodes()[1]
+	tests := []struct {
+		name string
+		node *Node
+		text string // empty if the node has no location
+	}{
+		{"declaration", doc.FirstChild(), `<?xml version="1.0"?>`},
+		{"doctype", doc.Doctype(), `<!DOCTYPE r [<!ENTITY e "<i>x</i>">]>`},
+		{"root", r, src[strings.Index(src, "<r "):]},
+		{"attribute", r.GetAttributeNode("a"), `a="1"`},
+		{"attribute with spaces", r.GetAttributeNode("b"), `b = 'é'`},
+		{"element", c, "<c>text &e; é</c>"},
+		{"text", c.FirstChild(), "text "},
+		{"entity reference", c.ChildNodes()[1], "&e;"},
+		{"text after a multibyte character", c.LastChild(), " é"},
+		{"comment", c.NextSibling(), "<!-- comment -->"},
+		{"processing instruction", r.ChildNodes()[4], "<?pi data?>"},
+		{"CDATA section", r.ChildNodes()[5], "<![CDATA[cd]]>"},
+		{"empty element", r.ChildNodes()[6], "<d/>"},
+		{"entity replacement text", c.ChildNodes()[1].FirstChild(), ""},
+		{"created", doc.CreateTextNode("x"), ""},
+		{"clone", c.CloneNode(true), "<c>text &e; é</c>"},
+	}
+	for _, test := range tests {
+		rng, ok := test.node.SourceRange()
+		if test.text == "" {
+			if ok {
+				t.Errorf("%s: SourceRange() = %v", test.name, rng)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: no SourceRange", test.name)
+			continue
+		}
+		if text := src[rng.Start.Offset:rng.End.Offset]; text != test.text {
+			t.Errorf("%s: range %v holds %q, want %q", test.name, rng, text, test.text)
+		}
+		start := Position{1, 1, 0}.advance(src[:rng.Start.Offset])
+		end := start.advance(test.text)
+		if rng.Start != start || rng.End != end {
+			t.Errorf("%s: range %+v, want %+v", test.name, rng, SourceRange{start, end})
+		}
+	}
+}
+
+func TestSourceRangeEncoding(t *testing.T) {
+	const latin1Decl = `<?xml version="1.0" encoding="ISO-8859-1"?>`
+	const utf16Decl = `<?xml version="1.0" encoding="UTF-16"?>`
+	tests := []struct {
+		name  string
+		src   string // <a>é\né<b/></a> and a trailing <
+		start int64  // after the byte order mark
+		b     SourceRange
+		error Position
+	}{
+		{"UTF-8 with BOM", bomUTF8 + "<a>é\né<b/></a><", 3, SourceRange{Position{2, 3, 11}, Position{2, 7, 15}}, Position{2, 12, 20}},
+		{"ISO-8859-1", latin1Decl + "<a>\xe9\n\xe9<b/></a><", 0, SourceRange{Position{2, 2, 49}, Position{2, 6, 53}}, Position{2, 11, 58}},
+		{"UTF-16LE with BOM", bomUTF16LE + utf16Bytes("<a>é\né<b/></a><", false), 2, SourceRange{Position{2, 3, 14}, Position{2, 11, 22}}, Position{2, 21, 32}},
+		{"UTF-16BE", utf16Bytes(utf16Decl+"<a>é\né<b/></a><", true), 0, SourceRange{Position{2, 3, 90}, Position{2, 11, 98}}, Position{2, 21, 108}},
+	}
+	for _, test := range tests {
+		_, err := ParseXML(strings.NewReader(test.src))
+		if pe, ok := err.(*ParseError); !ok || pe.Position != test.error {
+			t.Errorf("%s: error %#v, want a ParseError at %+v", test.name, err, test.error)
+		}
+		src := strings.TrimSuffix(test.src, "<")
+		if strings.HasPrefix(test.name, "UTF-16") {
+			src = test.src[:len(test.src)-2]
+		}
+		doc, err := ParseXML(strings.NewReader(src))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		b := doc.DocumentElement().LastChild()
+		if rng, _ := b.SourceRange(); rng != test.b {
+			t.Errorf("%s: <b/> at %+v, want %+v", test.name, rng, test.b)
+		}
+		if rng, _ := doc.SourceRange(); rng.Start != (Position{1, 1, test.start}) || rng.End.Offset != int64(len(src)) {
+			t.Errorf("%s: document at %+v, want from offset %d to %d", test.name, rng, test.start, len(src))
+		}
+	}
+}
@@ -0,0 +1,697 @@
+package xmldom
+
+// Offsets of ranges are counted in UTF-16 code units in character data, and
+// in children in the other nodes.
+
+// boundaryPoint is a position in a tree: before the child at offset, or
+// before the code unit at offset in character data.
+type boundaryPoint struct {
+	node   *Node
+	offset uint
+}
+
+// Range is a contiguous part of a document between two boundary points, as
+// in DOM Level 2 Range. It is live: its boundary points move with the changes
+// made to the tree, until Detach is called.
+type Range struct {
+	doc        *Node
+	start, end boundaryPoint
+	detached   bool
+}
+
+// CompareHow tells which boundary points CompareBoundaryPoints compares.
+type CompareHow uint
+
+const (
+	StartToStart CompareHow = iota
+	StartToEnd
+	EndToEnd
+	EndToStart
+)
+
+// CreateRange returns a range collapsed at the start of the document. The
+// document updates the range when its trees change until Detach is called.
+// The document holds the range until then, so Detach must be called once the
+// range is no longer used.
+func (d *Node) CreateRange() *Range {
+	r := &Range{doc: d, start: boundaryPoint{d, 0}, end: boundaryPoint{d, 0}}
+	if d.state != nil {
+		d.state.ranges = append(d.state.ranges, r)
+	}
+	return r
+}
+
+func (r *Range) StartContainer() *Node {
+	return r.start.node
+}
+
+func (r *Range) StartOffset() uint {
+	return r.start.offset
+}
+
+func (r *Range) EndContainer() *Node {
+	return r.end.node
+}
+
+func (r *Range) EndOffset() uint {
+	return r.end.offset
+}
+
+// Collapsed tells if the start and end of the range are the same.
+func (r *Range) Collapsed() bool {
+	return r.start == r.end
+}
+
+// CommonAncestorContainer returns the deepest node that contains the start
+// and end of the range.
+func (r *Range) CommonAncestorContainer() *Node {
+	n := r.start.node
+	for !isInclusiveAncestor(n, r.end.node) {
+		n = n.parentNode
+	}
+	return n
+}
+
+// nodeLength returns the largest offset of the boundary points in n.
+func nodeLength(n *Node) uint {
+	switch {
+	case n.nodeType == DocumentTypeNode:
+		return 0
+	case n.isCharacterData():
+		return n.Length()
+	}
+	return uint(len(n.childNodes))
+}
+
+// isInclusiveAncestor tells if ancestor is n or one of its ancestors.
+func isInclusiveAncestor(ancestor, n *Node) bool {
+	return n == ancestor || n.IsAncestor(ancestor)
+}
+
+// rootOf returns the ancestor of n that has no parent.
+func rootOf(n *Node) *Node {
+	for n.parentNode != nil {
+		n = n.parentNode
+	}
+	return n
+}
+
+// treeOrder returns -1 if a precedes b in the tree they are part of, 1 if it
+// follows it, and 0 if they are the same node.
+func treeOrder(a, b *Node) int {
+	if a == b {
+		return 0
+	}
+	var pa, pb NodeList
+	for n := a; n != nil; n = n.parentNode {
+		pa = append(NodeList{n}, pa...)
+	}
+	for n := b; n != nil; n = n.parentNode {
+		pb = append(NodeList{n}, pb...)
+	}
+	i := 0
+	for i < len(pa) && i < len(pb) && pa[i] == pb[i] {
+		i++
+	}
+	switch {
+	case i == len(pa):
+		return -1
+	case i == len(pb):
+		return 1
+	case pa[i].pos < pb[i].pos:
+		return -1
+	}
+	return 1
+}
+
+// compareBoundaryPoints returns -1 if a is before b, 0 if they are equal and
+// 1 if a is after b. They must be in the same tree.
+func compareBoundaryPoints(a, b boundaryPoint) int {
+	if a.node == b.node {
+		switch {
+		case a.offset < b.offset:
+			return -1
+		case a.offset > b.offset:
+			return 1
+		}
+		return 0
+	}
+	if treeOrder(a.node, b.node) > 0 {
+		return -compareBoundaryPoints(b, a)
+	}
+	if b.node.IsAncestor(a.node) {
+		child := b.node
+		for child.parentNode != a.node {
+			child = child.parentNode
+		}
+		if uint(child.pos) < a.offset {
+			return 1
+		}
+	}
+	return -1
+}
+
+// checkBoundaryPoint returns an error if n cannot contain the boundary points
+// of the range, or if offset is beyond its length.
+func (r *Range) checkBoundaryPoint(n *Node, offset uint) Error {
+	if r.detached {
+		return err(InvalidStateError)
+	}
+	if n.ownerDocument != r.doc {
+		return err(WrongDocumentError)
+	}
+	for a := n; a != nil; a = a.parentNode {
+		switch a.nodeType {
+		case DocumentTypeNode, EntityNode, NotationNode:
+			return err(InvalidNodeTypeError)
+		}
+	}
+	if offset > nodeLength(n) {
+		return err(IndexSizeError)
+	}
+	return nil
+}
+
+// SetStart sets the start of the range. The end is moved to the start if it
+// was before it or in another tree.
+func (r *Range) SetStart(n *Node, offset uint) Error {
+	if e := r.checkBoundaryPoint(n, offset); e != nil {
+		return e
+	}
+	bp := boundaryPoint{n, offset}
+	if rootOf(n) != rootOf(r.end.node) || compareBoundaryPoints(bp, r.end) > 0 {
+		r.end = bp
+	}
+	r.start = bp
+	return nil
+}
+
+// SetEnd sets the end of the range. The start is moved to the end if it was
+// after it or in another tree.
+func (r *Range) SetEnd(n *Node, offset uint) Error {
+	if e := r.checkBoundaryPoint(n, offset); e != nil {
+		return e
+	}
+	bp := boundaryPoint{n, offset}
+	if rootOf(n) != rootOf(r.start.node) || compareBoundaryPoints(bp, r.start) < 0 {
+		r.start = bp
+	}
+	r.end = bp
+	return nil
+}
+
+// siblingPoint returns the parent of n and the offset of n in it.
+func siblingPoint(n *Node) (*Node, uint, Error) {
+	if n.parentNode == nil {
+		return nil, 0, err(InvalidNodeTypeError)
+	}
+	return n.parentNode, uint(n.pos), nil
+}
+
+func (r *Range) SetStartBefore(n *Node) Error {
+	parent, offset, e := siblingPoint(n)
+	if e != nil {
+		return e
+	}
+	return r.SetStart(parent, offset)
+}
+
+func (r *Range) SetStartAfter(n *Node) Error {
+	parent, offset, e := siblingPoint(n)
+	if e != nil {
+		return e
+	}
+	return r.SetStart(parent, offset+1)
+}
+
+func (r *Range) SetEndBefore(n *Node) Error {
+	parent, offset, e := siblingPoint(n)
+	if e != nil {
+		return e
+	}
+	return r.SetEnd(parent, offset)
+}
+
+func (r *Range) SetEndAfter(n *Node) Error {
+	parent, offset, e := siblingPoint(n)
+	if e != nil {
+		return e
+	}
+	return r.SetEnd(parent, offset+1)
+}
+
+// Collapse moves the end of the range to its start if toStart is true, or
+// the start to the end otherwise.
+func (r *Range) Collapse(toStart bool) {
+	if toStart {
+		r.end = r.start
+	} else {
+		r.start = r.end
+	}
+}
+
+// SelectNode sets the range around n.
+func (r *Range) SelectNode(n *Node) Error {
+	parent, offset, e := siblingPoint(n)
+	if e == nil {
+		e = r.checkBoundaryPoint(parent, offset)
+	}
+	if e != nil {
+		return e
+	}
+	r.start = boundaryPoint{parent, offset}
+	r.end = boundaryPoint{parent, offset + 1}
+	return nil
+}
+
+// SelectNodeContents sets the range around the children or the data of n.
+func (r *Range) SelectNodeContents(n *Node) Error {
+	if e := r.checkBoundaryPoint(n, 0); e != nil {
+		return e
+	}
+	r.start = boundaryPoint{n, 0}
+	r.end = boundaryPoint{n, nodeLength(n)}
+	return nil
+}
+
+// CompareBoundaryPoints compares a boundary point of the range with one of
+// source, returning -1, 0 or 1 if it is before, equal to or after it. how
+// names the boundary point of source first.
+func (r *Range) CompareBoundaryPoints(how CompareHow, source *Range) (int, Error) {
+	if r.detached || source.detached {
+		return 0, err(InvalidStateError)
+	}
+	if rootOf(r.start.node) != rootOf(source.start.node) {
+		return 0, err(WrongDocumentError)
+	}
+	switch how {
+	case StartToStart:
+		return compareBoundaryPoints(r.start, source.start), nil
+	case StartToEnd:
+		return compareBoundaryPoints(r.end, source.start), nil
+	case EndToEnd:
+		return compareBoundaryPoints(r.end, source.end), nil
+	case EndToStart:
+		return compareBoundaryPoints(r.start, source.end), nil
+	}
+	return 0, err(NotSupportedError)
+}
+
+// contains tells if n is entirely between start and end.
+func contains(start, end boundaryPoint, n *Node) bool {
+	return rootOf(n) == rootOf(start.node) &&
+		compareBoundaryPoints(boundaryPoint{n, 0}, start) > 0 &&
+		compareBoundaryPoints(boundaryPoint{n, nodeLength(n)}, end) < 0
+}
+
+// partiallyContains tells if only one of start and end is in n.
+func partiallyContains(start, end boundaryPoint, n *Node) bool {
+	return isInclusiveAncestor(n, start.node) != isInclusiveAncestor(n, end.node)
+}
+
+// collapsedPoint returns where the range is collapsed once its content is
+// removed: after the ancestor of its start that is a sibling of an ancestor
+// of its end.
+func (r *Range) collapsedPoint() boundaryPoint {
+	if isInclusiveAncestor(r.start.node, r.end.node) {
+		return r.start
+	}
+	n := r.start.node
+	for !isInclusiveAncestor(n.parentNode, r.end.node) {
+		n = n.parentNode
+	}
+	return boundaryPoint{n.parentNode, uint(n.pos) + 1}
+}
+
+// DeleteContents removes the content of the range from the tree and
+// collapses it.
+func (r *Range) DeleteContents() Error {
+	if r.detached {
+		return err(InvalidStateError)
+	}
+	if r.Collapsed() {
+		return nil
+	}
+	start, end := r.start, r.end
+	if start.node == end.node && start.node.isCharacterData() {
+		return start.node.DeleteData(start.offset, end.offset-start.offset)
+	}
+	var removed NodeList
+	var collect func(n *Node)
+	collect = func(n *Node) {
+		for _, c := range n.childNodes {
+			if contains(start, end, c) {
+				removed = append(removed, c)
+			} else if partiallyContains(start, end, c) {
+				collect(c)
+			}
+		}
+	}
+	collect(r.CommonAncestorContainer())
+	point := r.collapsedPoint()
+	if start.node.isCharacterData() {
+		if e := start.node.DeleteData(start.offset, start.node.Length()-start.offset); e != nil {
+			return e
+		}
+	}
+	for _, n := range removed {
+		if _, e := n.parentNode.RemoveChild(n); e != nil {
+			return e
+		}
+	}
+	if end.node.isCharacterData() {
+		if e := end.node.DeleteData(0, end.offset); e != nil {
+			return e
+		}
+	}
+	r.start, r.end = point, point
+	return nil
+}
+
+// ExtractContents moves the content of the range to a new document fragment
+// and collapses the range. The nodes partially in the range are split: they
+// are left in the tree with the content out of the range, and copied in the
+// fragment with the content in the range.
+func (r *Range) ExtractContents() (*Node, Error) {
+	if r.detached {
+		return nil, err(InvalidStateError)
+	}
+	if r.Collapsed() {
+		return r.doc.CreateDocumentFragment(), nil
+	}
+	point := r.collapsedPoint()
+	fragment, e := r.contents(r.start, r.end, true)
+	if e != nil {
+		return nil, e
+	}
+	r.start, r.end = point, point
+	return fragment, nil
+}
+
+// CloneContents returns a document fragment with a copy of the content of
+// the range.
+func (r *Range) CloneContents() (*Node, Error) {
+	if r.detached {
+		return nil, err(InvalidStateError)
+	}
+	return r.contents(r.start, r.end, false)
+}
+
+// cloneData returns a copy of the character data node n with the data from
+// start to end, removing it from n if extract is true.
+func cloneData(n *Node, start, end uint, extract bool) (*Node, Error) {
+	data, e := n.SubstringData(start, end-start)
+	if e != nil {
+		return nil, e
+	}
+	clone := n.CloneNode(false)
+	clone.nodeValue = data
+	clone.ValueDirty = true
+	if extract {
+		if e := n.DeleteData(start, end-start); e != nil {
+			return nil, e
+		}
+	}
+	return clone, nil
+}
+
+// contents returns a document fragment with the content between start and
+// end, copied or extracted.
+func (r *Range) contents(start, end boundaryPoint, extract bool) (*Node, Error) {
+	fragment := r.doc.CreateDocumentFragment()
+	if start == end {
+		return fragment, nil
+	}
+	if start.node == end.node && start.node.isCharacterData() {
+		clone, e := cloneData(start.node, start.offset, end.offset, extract)
+		if e == nil {
+			_, e = fragment.AppendChild(clone)
+		}
+		return fragment, e
+	}
+
+	common := start.node
+	for !isInclusiveAncestor(common, end.node) {
+		common = common.parentNode
+	}
+	var first, last *Node
+	var contained NodeList
+	for _, c := range common.childNodes {
+		switch {
+		case contains(start, end, c):
+			if c.nodeType == DocumentTypeNode {
+				return nil, err(HierarchyRequestError)
+			}
+			contained = append(contained, c)
+		case !partiallyContains(start, end, c):
+		case first == nil && !isInclusiveAncestor(start.node, end.node):
+			first = c
+		default:
+			last = c
+		}
+	}
+
+	if first != nil {
+		var clone *Node
+		var e Error
+		if first.isCharacterData() {
+			clone, e = cloneData(first, start.offset, first.Length(), extract)
+		} else {
+			clone = first.CloneNode(false)
+			var sub *Node
+			if sub, e = r.contents(start, boundaryPoint{first, nodeLength(first)}, extract); e == nil {
+				_, e = clone.AppendChild(sub)
+			}
+		}
+		if e == nil {
+			_, e = fragment.AppendChild(clone)
+		}
+		if e != nil {
+			return nil, e
+		}
+	}
+	for _, c := range contained {
+		if !extract {
+			c = c.CloneNode(true)
+		}
+		if _, e := fragment.AppendChild(c); e != nil {
+			return nil, e
+		}
+	}
+	if last != nil {
+		var clone *Node
+		var e Error
+		if last.isCharacterData() {
+			clone, e = cloneData(last, 0, end.offset, extract)
+		} else {
+			clone = last.CloneNode(false)
+			var sub *Node
+			if sub, e = r.contents(boundaryPoint{last, 0}, end, extract); e == nil {
+				_, e = clone.AppendChild(sub)
+			}
+		}
+		if e == nil {
+			_, e = fragment.AppendChild(clone)
+		}
+		if e != nil {
+			return nil, e
+		}
+	}
+	return fragment, nil
+}
+
+// InsertNode inserts n at the start of the range, splitting the text node it
+// is in. The range is extended to contain n if it was collapsed.
+func (r *Range) InsertNode(n *Node) Error {
+	if r.detached {
+		return err(InvalidStateError)
+	}
+	switch n.nodeType {
+	case AttributeNode, EntityNode, NotationNode, DocumentNode:
+		return err(InvalidNodeTypeError)
+	}
+	container := r.start.node
+	if container.nodeType == CommentNode || container.nodeType == ProcessingInstructionNode ||
+		(container.isText() && container.parentNode == nil) || container == n {
+		return err(HierarchyRequestError)
+	}
+	var ref *Node
+	if container.isText() {
+		ref = container
+	} else if r.start.offset < uint(len(container.childNodes)) {
+		ref = container.childNodes[r.start.offset]
+	}
+	parent := container
+	if ref != nil {
+		parent = ref.parentNode
+	}
+	if isInclusiveAncestor(n, parent) {
+		return err(HierarchyRequestError)
+	}
+	if container.isText() {
+		var e Error
+		if ref, e = container.SplitText(r.start.offset); e != nil {
+			return e
+		}
+	}
+	if n == ref {
+		ref = n.NextSibling()
+	}
+	if n.parentNode != nil {
+		if _, e := n.parentNode.RemoveChild(n); e != nil {
+			return e
+		}
+	}
+	offset := uint(len(parent.childNodes))
+	if ref != nil {
+		offset = uint(ref.pos)
+	}
+	if n.nodeType == DocumentFragmentNode {
+		offset += uint(len(n.childNodes))
+	} else {
+		offset++
+	}
+	collapsed := r.Collapsed()
+	if _, e := parent.InsertBefore(n, ref); e != nil {
+		return e
+	}
+	if collapsed {
+		r.end = boundaryPoint{parent, offset}
+	}
+	return nil
+}
+
+// SurroundContents moves the content of the range into newParent, which
+// replaces it, and selects newParent. It fails if the range splits a node
+// other than a text node.
+func (r *Range) SurroundContents(newParent *Node) Error {
+	if r.detached {
+		return err(InvalidStateError)
+	}
+	for n := r.start.node; n != nil; n = n.parentNode {
+		if !n.isText() && partiallyContains(r.start, r.end, n) {
+			return err(InvalidStateError)
+		}
+	}
+	for n := r.end.node; n != nil; n = n.parentNode {
+		if !n.isText() && partiallyContains(r.start, r.end, n) {
+			return err(InvalidStateError)
+		}
+	}
+	switch newParent.nodeType {
+	case AttributeNode, EntityNode, DocumentTypeNode, NotationNode, DocumentNode, DocumentFragmentNode:
+		return err(InvalidNodeTypeError)
+	}
+	fragment, e := r.ExtractContents()
+	if e != nil {
+		return e
+	}
+	for len(newParent.childNodes) > 0 {
+		if _, e := newParent.RemoveChild(newParent.childNodes[0]); e != nil {
+			return e
+		}
+	}
+	if e := r.InsertNode(newParent); e != nil {
+		return e
+	}
+	if _, e := newParent.AppendChild(fragment); e != nil {
+		return e
+	}
+	return r.SelectNode(newParent)
+}
+
+// CloneRange returns a new range with the same boundary points. Like the
+// ranges from CreateRange, it must be detached once no longer used.
+func (r *Range) CloneRange() *Range {
+	clone := r.doc.CreateRange()
+	clone.start, clone.end = r.start, r.end
+	return clone
+}
+
+// String returns the text in the range, without markup.
+func (r *Range) String() string {
+	start, end := r.start, r.end
+	if start.node == end.node && start.node.isText() {
+		s, _ := start.node.SubstringData(start.offset, end.offset-start.offset)
+		return s
+	}
+	var res string
+	if start.node.isText() {
+		s, _ := start.node.SubstringData(start.offset, start.node.Length()-start.offset)
+		res += s
+	}
+	var collect func(n *Node)
+	collect = func(n *Node) {
+		for _, c := range n.childNodes {
+			if c.isText() && contains(start, end, c) {
+				res += c.nodeValue
+			}
+			collect(c)
+		}
+	}
+	collect(r.CommonAncestorContainer())
+	if end.node.isText() {
+		s, _ := end.node.SubstringData(0, end.offset)
+		res += s
+	}
+	return res
+}
+
+// Detach releases the range from its document, which keeps it in memory and
+// updates it on every change otherwise. Its methods returning an Error fail
+// afterwards.
+func (r *Range) Detach() {
+	if r.detached {
+		return
+	}
+	r.detached = true
+	if state := r.doc.state; state != nil {
+		for i, other := range state.ranges {
+			if other == r {
+				state.ranges = append(state.ranges[:i:i], state.ranges[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// removing moves the boundary point out of n before it is removed from the
+// tree.
+func (bp *boundaryPoint) removing(n *Node) {
+	if isInclusiveAncestor(n, bp.node) {
+		bp.node, bp.offset = n.parentNode, uint(n.pos)
+	} else if bp.node == n.parentNode && bp.offset > uint(n.pos) {
+		bp.offset--
+	}
+}
+
+// inserted moves the boundary point after count children inserted in parent
+// at index.
+func (bp *boundaryPoint) inserted(parent *Node, index, count uint) {
+	if bp.node == parent && bp.offset > index {
+		bp.offset += count
+	}
+}
+
+// replacingData moves the boundary point before count code units of the
+// data of n are replaced by length others from offset.
+func (bp *boundaryPoint) replacingData(n *Node, offset, count, length uint) {
+	if bp.node != n {
+		return
+	}
+	if bp.offset > offset+count {
+		bp.offset = bp.offset + length - count
+	} else if bp.offset > offset {
+		bp.offset = offset
+	}
+}
+
+// splittingText moves the boundary point after the data of n from offset
+// was copied to newNode, inserted after n.
+func (bp *boundaryPoint) splittingText(n, newNode *Node, offset uint) {
+	if bp.node == n && bp.offset > offset {
+		bp.node, bp.offset = newNode, bp.offset-offset
+	} else if bp.node == n.parentNode && bp.node != nil && bp.offset == uint(n.pos)+1 {
+		bp.offset++
+	}
+}
@@ -0,0 +1,214 @@
+package xmldom
+
+import (
+	"testing"
+)
+
+// text returns the first text node in the subtree of n.
+func text(n *Node) *Node {
+	if n.nodeType == TextNode {
+		return n
+	}
+	for _, c := range n.childNodes {
+		if t := text(c); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// element returns the first element named name in the document.
+func element(doc *Node, name string) *Node {
+	return doc.GetElementsByTagName(name).Item(0)
+}
+
+func checkBoundaries(t *testing.T, what string, r *Range, start *Node, startOffset uint, end *Node, endOffset uint) {
+	t.Helper()
+	if r.StartContainer() != start || r.StartOffset() != startOffset || r.EndContainer() != end || r.EndOffset() != endOffset {
+		t.Errorf("%s: range (%v, %d) (%v, %d), want (%v, %d) (%v, %d)", what,
+			r.StartContainer(), r.StartOffset(), r.EndContainer(), r.EndOffset(), start, startOffset, end, endOffset)
+	}
+}
+
+func TestRangeContents(t *testing.T) {
+	tests := []struct {
+		src, start, end        string // elements with the text where the range starts and ends
+		startOffset, endOffset uint
+		text, contents, rest   string
+	}{
+		{`<p>Hello <b>bold</b> world</p>`, "p", "b", 2, 2, "llo bo", "llo <b>bo</b>", `<p>He<b>ld</b> world</p>`},
+		{`<a><b>one</b><c>two<d/></c></a>`, "b", "c", 1, 2, "netw", "<b>ne</b><c>tw</c>", `<a><b>o</b><c>o<d/></c></a>`},
+		{`<a><b>one</b>mid<e/><c>two</c></a>`, "b", "c", 0, 3, "onemidtwo", "<b>one</b>mid<e/><c>two</c>", `<a><b></b><c></c></a>`},
+		{`<p>some text</p>`, "p", "p", 2, 6, "me t", "me t", `<p>soext</p>`},
+	}
+	for _, test := range tests {
+		for _, extract := range []bool{false, true} {
+			doc := parseTraversal(t, test.src)
+			r := doc.CreateRange()
+			if e := r.SetStart(text(element(doc, test.start)), test.startOffset); e != nil {
+				t.Fatal(e)
+			}
+			if e := r.SetEnd(text(element(doc, test.end)), test.endOffset); e != nil {
+				t.Fatal(e)
+			}
+			if s := r.String(); s != test.text {
+				t.Errorf("%s: String() = %q, want %q", test.src, s, test.text)
+			}
+			var fragment *Node
+			var e Error
+			if extract {
+				fragment, e = r.ExtractContents()
+			} else {
+				fragment, e = r.CloneContents()
+			}
+			if e != nil {
+				t.Fatal(e)
+			}
+			if fragment.XML() != test.contents {
+				t.Errorf("%s: contents %s, want %s", test.src, fragment.XML(), test.contents)
+			}
+			want := test.src
+			if extract {
+				want = test.rest
+				if !r.Collapsed() {
+					t.Errorf("%s: range not collapsed after ExtractContents", test.src)
+				}
+			}
+			if doc.XML() != want {
+				t.Errorf("%s: extract %v: document %s, want %s", test.src, extract, doc.XML(), want)
+			}
+		}
+
+		doc := parseTraversal(t, test.src)
+		r := doc.CreateRange()
+		r.SetStart(text(element(doc, test.start)), test.startOffset)
+		r.SetEnd(text(element(doc, test.end)), test.endOffset)
+		if e := r.DeleteContents(); e != nil {
+			t.Fatal(e)
+		}
+		if doc.XML() != test.rest {
+			t.Errorf("%s: DeleteContents: document %s, want %s", test.src, doc.XML(), test.rest)
+		}
+	}
+}
+
+func TestRangeInsertNode(t *testing.T) {
+	doc := parseTraversal(t, `<p>ab</p>`)
+	p := doc.DocumentElement()
+	r := doc.CreateRange()
+	r.SetStart(p.FirstChild(), 1)
+	r.Collapse(true)
+	br, _ := doc.CreateElement("br")
+	if e := r.InsertNode(br); e != nil {
+		t.Fatal(e)
+	}
+	if doc.XML() != `<p>a<br/>b</p>` {
+		t.Errorf("document %s", doc.XML())
+	}
+	checkBoundaries(t, "InsertNode", r, p.FirstChild(), 1, p, 2)
+
+	em, _ := doc.CreateElement("em")
+	r.SelectNodeContents(p.LastChild())
+	if e := r.SurroundContents(em); e != nil {
+		t.Fatal(e)
+	}
+	if doc.XML() != `<p>a<br/><em>b</em></p>` {
+		t.Errorf("document %s", doc.XML())
+	}
+	// The text node is split at the range, leaving empty text nodes.
+	checkBoundaries(t, "SurroundContents", r, p, 3, p, 4)
+
+	r.SetStart(p.FirstChild(), 0)
+	r.SetEnd(em.FirstChild(), 1)
+	if e := r.SurroundContents(doc.CreateTextNode("x")); e == nil || e.Code() != InvalidStateError {
+		t.Errorf("SurroundContents of a partially selected element: %v", e)
+	}
+	if e := r.InsertNode(p); e == nil || e.Code() != HierarchyRequestError {
+		t.Errorf("InsertNode of an ancestor: %v", e)
+	}
+}
+
+func TestRangeLive(t *testing.T) {
+	doc := parseTraversal(t, `<p>x<b>bold</b>y</p>`)
+	p := element(doc, "p")
+	b := element(doc, "b")
+	r := doc.CreateRange()
+	r.SelectNode(b)
+	checkBoundaries(t, "SelectNode", r, p, 1, p, 2)
+
+	p.InsertBefore(doc.CreateTextNode("new"), p.FirstChild())
+	checkBoundaries(t, "InsertBefore", r, p, 2, p, 3)
+	p.InsertBefore(doc.CreateTextNode("after"), p.LastChild())
+	checkBoundaries(t, "InsertBefore after the range", r, p, 2, p, 3)
+	p.RemoveChild(p.FirstChild())
+	checkBoundaries(t, "RemoveChild", r, p, 1, p, 2)
+
+	bold := b.FirstChild()
+	r.SetStart(bold, 1)
+	r.SetEnd(bold, 3)
+	second, _ := bold.SplitText(2)
+	checkBoundaries(t, "SplitText", r, bold, 1, second, 1)
+	if r.String() != "ol" {
+		t.Errorf("String() = %q after SplitText", r.String())
+	}
+	bold.InsertData(0, "--")
+	checkBoundaries(t, "InsertData", r, bold, 3, second, 1)
+	second.SetNodeValue("changed")
+	checkBoundaries(t, "SetNodeValue", r, bold, 3, second, 0)
+
+	r.SelectNodeContents(b)
+	p.RemoveChild(b)
+	checkBoundaries(t, "removing an ancestor", r, p, 1, p, 1)
+
+	other := doc.CreateRange()
+	other.SelectNodeContents(p)
+	r.Detach()
+	p.InsertBefore(doc.CreateTextNode("z"), p.FirstChild())
+	checkBoundaries(t, "Detach", r, p, 1, p, 1)
+	checkBoundaries(t, "another range", other, p, 0, p, 4)
+	if len(doc.state.ranges) != 1 {
+		t.Errorf("%d ranges after Detach", len(doc.state.ranges))
+	}
+	if e := r.SetStart(p, 0); e == nil || e.Code() != InvalidStateError {
+		t.Errorf("SetStart after Detach: %v", e)
+	}
+}
+
+func TestRangeCompareBoundaryPoints(t *testing.T) {
+	doc := parseTraversal(t, `<!DOCTYPE a><a><b>text</b><c/></a>`)
+	a := doc.DocumentElement()
+	r1 := doc.CreateRange()
+	r1.SelectNodeContents(element(doc, "b"))
+	r2 := doc.CreateRange()
+	r2.SetStart(text(a), 2)
+	r2.SetEnd(a, 2)
+	tests := []struct {
+		how  CompareHow
+		want int
+	}{
+		{StartToStart, -1},
+		{StartToEnd, 1},
+		{EndToEnd, -1},
+		{EndToStart, -1},
+	}
+	for _, test := range tests {
+		if got, e := r1.CompareBoundaryPoints(test.how, r2); e != nil || got != test.want {
+			t.Errorf("CompareBoundaryPoints(%d) = %d, %v, want %d", test.how, got, e, test.want)
+		}
+	}
+	if got, _ := r1.CompareBoundaryPoints(StartToStart, r1); got != 0 {
+		t.Errorf("CompareBoundaryPoints with itself = %d", got)
+	}
+
+	if e := r1.SetStart(text(a), 5); e == nil || e.Code() != IndexSizeError {
+		t.Errorf("SetStart beyond the data: %v", e)
+	}
+	if e := r1.SetStart(doc.FirstChild(), 0); e == nil || e.Code() != InvalidNodeTypeError {
+		t.Errorf("SetStart in a document type: %v", e)
+	}
+	if e := r1.SetStart(NewDocument(), 0); e == nil || e.Code() != WrongDocumentError {
+		t.Errorf("SetStart in another document: %v", e)
+	}
+	r1.SetEnd(a, 0)
+	checkBoundaries(t, "SetEnd before the start", r1, a, 0, a, 0)
+}
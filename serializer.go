@@ -0,0 +1,406 @@
+package xmldom
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// SerializeMode selects how a Serializer lays out the document.
+type SerializeMode uint
+
+const (
+	// Faithful writes the nodes that were parsed and not modified with their
+	// source text from Raw, like Node.XML.
+	Faithful SerializeMode = iota
+	// Pretty puts each node of element content on its own line, indented
+	// by its depth, and drops the whitespace-only text there. Mixed content
+	// and elements with xml:space="preserve" are written inline.
+	Pretty
+	// Minify drops the whitespace-only text of element content and the
+	// insignificant whitespace in tags.
+	Minify
+	// ReformatDirty writes the document like Faithful, except for the nodes
+	// created or modified after parsing, which are laid out like Pretty with
+	// the indentation of their siblings.
+	ReformatDirty
+)
+
+// Serializer writes nodes as XML to a writer without building the output in
+// memory. The layout options must be set before calling Serialize.
+type Serializer struct {
+	Mode SerializeMode
+	// Indent is the indentation of one level for Pretty and ReformatDirty.
+	// If empty, it is two spaces, or in ReformatDirty mode the indentation
+	// found in the document.
+	Indent string
+	// WrapAttributes puts the attributes of start tags longer than
+	// LineWidth on their own line, in Pretty and ReformatDirty modes. Zero
+	// LineWidth wraps all the start tags with several attributes.
+	WrapAttributes bool
+	LineWidth      int
+	// Encoding is the encoding of the output: UTF-8, ISO-8859-1, US-ASCII,
+	// windows-1252, UTF-16LE or UTF-16BE. If empty, it is the input encoding
+	// of the document, so that parsed documents are written back as they
+	// were read, or UTF-8. The characters of text and attribute values that
+	// the encoding cannot represent are written as character references, and
+	// CDATA sections are split around them. Elsewhere Serialize returns an
+	// *EncodingError. The XML declaration of documents is written with the
+	// output encoding, and is added if the encoding is neither UTF-8 nor
+	// UTF-16. UTF-16 documents start with a byte order mark.
+	Encoding string
+
+	enc    *encoder
+	noBOM  bool // do not write the byte order mark of UTF-8 documents
+	out    *countingWriter
+	w      *bufio.Writer
+	err    error
+	inline int    // depth in mixed content, where whitespace is not added
+	line   string // indentation of the current line, for ReformatDirty
+	unit   string // indentation of one level found in the document
+	indent bool   // the current line only has indentation so far
+}
+
+// NewSerializer returns a serializer writing to w.
+func NewSerializer(w io.Writer) *Serializer {
+	out := &countingWriter{w: w}
+	return &Serializer{out: out, w: bufio.NewWriter(out)}
+}
+
+// Serialize writes the node with its descendants and flushes the output. It
+// returns the first error from the writer.
+func (s *Serializer) Serialize(n *Node) error {
+	s.start(n)
+	switch s.Mode {
+	case Pretty, Minify:
+		s.layout(n, "")
+		if n.nodeType == DocumentNode && s.Mode == Pretty {
+			s.write("\n")
+		}
+	default:
+		s.node(n)
+	}
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	return s.err
+}
+
+// start sets the encoder of the output. For documents, it writes the byte
+// order mark that UTF-16 requires or that a UTF-8 document had, and an XML
+// declaration if the encoding needs one and the document has none.
+func (s *Serializer) start(n *Node) {
+	encoding := s.Encoding
+	doc := n.ownerDocument
+	if encoding == "" && doc != nil {
+		encoding = doc.InputEncoding()
+	}
+	s.enc = newEncoder(encoding)
+	if n.nodeType != DocumentNode || s.err != nil {
+		return
+	}
+	switch {
+	case s.enc == nil && n.HasByteOrderMark() && !s.noBOM:
+		_, s.err = s.w.WriteString(bomUTF8)
+	case s.enc != nil && s.enc.charset == utf16BE:
+		_, s.err = s.w.WriteString(bomUTF16BE)
+	case s.enc != nil && s.enc.charset == utf16LE:
+		_, s.err = s.w.WriteString(bomUTF16LE)
+	}
+	if s.needsDeclaration() && !hasDeclaration(n) {
+		s.write("<?xml version=\"1.0\" encoding=\"" + s.declaredEncoding() + "\"?>")
+		if s.Mode != Minify {
+			s.write("\n")
+		}
+	}
+}
+
+// needsDeclaration tells whether the output encoding must be declared: it is
+// neither UTF-8 nor UTF-16, which the byte order mark identifies.
+func (s *Serializer) needsDeclaration() bool {
+	return s.enc != nil && s.enc.charset != utf16BE && s.enc.charset != utf16LE
+}
+
+// declaredEncoding returns the name of the output encoding in the XML
+// declaration.
+func (s *Serializer) declaredEncoding() string {
+	switch {
+	case s.enc == nil:
+		return "UTF-8"
+	case s.enc.charset == utf16BE || s.enc.charset == utf16LE:
+		return "UTF-16"
+	}
+	return s.enc.charset.name
+}
+
+// declares tells whether an encoding name from an XML declaration stands for
+// the output encoding.
+func (s *Serializer) declares(name string) bool {
+	switch {
+	case s.enc == nil:
+		return strings.EqualFold(name, "utf-8")
+	case strings.EqualFold(name, "utf-16"):
+		return s.enc.charset == utf16BE || s.enc.charset == utf16LE
+	}
+	return lookupCharset(name) == s.enc.charset
+}
+
+func hasDeclaration(doc *Node) bool {
+	c := doc.FirstChild()
+	return c != nil && c.nodeType == ProcessingInstructionNode && c.nodeName == "xml"
+}
+
+// declaration writes the XML declaration of a document, with the encoding
+// pseudo-attribute rewritten or inserted for the output encoding.
+func (s *Serializer) declaration(n *Node) {
+	decl := "<?xml " + n.nodeValue + "?>"
+	if len(n.Raw) > 0 && !n.ValueDirty {
+		decl = strings.Join(n.Raw, "")
+	}
+	if i, j := pseudoAttribute(decl, "encoding"); i >= 0 {
+		if !s.declares(decl[i:j]) {
+			decl = decl[:i] + s.declaredEncoding() + decl[j:]
+		}
+	} else if s.needsDeclaration() {
+		// the encoding follows the version
+		k := len("<?xml")
+		if _, j := pseudoAttribute(decl, "version"); j >= 0 {
+			k = j + 1
+		}
+		decl = decl[:k] + " encoding=\"" + s.declaredEncoding() + "\"" + decl[k:]
+	}
+	s.write(decl)
+}
+
+// WriteTo writes the node with its descendants as XML to w, in the input
+// encoding of the document, see Serializer. It implements io.WriterTo.
+func (n *Node) WriteTo(w io.Writer) (int64, error) {
+	s := NewSerializer(w)
+	err := s.Serialize(n)
+	return s.out.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// write writes markup.
+func (s *Serializer) write(str string) {
+	if s.err == nil && s.enc != nil {
+		var b []byte
+		if b, s.err = s.enc.encode(str); s.err == nil {
+			_, s.err = s.w.Write(b)
+		}
+	} else if s.err == nil {
+		_, s.err = s.w.WriteString(str)
+	}
+	if s.Mode == ReformatDirty {
+		s.trackIndentation(str)
+	}
+}
+
+// writeText writes the escaped character data of text or of an attribute
+// value, where the characters that the encoding cannot represent are written
+// as character references.
+func (s *Serializer) writeText(str string) {
+	if s.err == nil && s.enc != nil {
+		_, s.err = s.w.Write(s.enc.encodeText(str))
+	} else if s.err == nil {
+		_, s.err = s.w.WriteString(str)
+	}
+	if s.Mode == ReformatDirty {
+		s.trackIndentation(str)
+	}
+}
+
+// writeCDATA writes a CDATA section, with the characters that the encoding
+// cannot represent moved out of the section as character references.
+func (s *Serializer) writeCDATA(str string) {
+	if s.enc != nil {
+		str = s.enc.cdata(str)
+	}
+	s.write(str)
+}
+
+// trackIndentation keeps the indentation of the current output line.
+func (s *Serializer) trackIndentation(str string) {
+	if i := strings.LastIndexByte(str, '\n'); i >= 0 {
+		s.line = ""
+		s.indent = true
+		str = str[i+1:]
+	}
+	if s.indent {
+		ws := len(str) - len(strings.TrimLeft(str, " \t"))
+		s.line += str[:ws]
+		s.indent = ws == len(str)
+	}
+}
+
+// writeRaw writes the source text of a node.
+func (s *Serializer) writeRaw(raw []string) {
+	for _, r := range raw {
+		s.write(r)
+	}
+}
+
+// writeRawText writes the source text of a text or CDATA section node, made
+// of character data and CDATA sections.
+func (s *Serializer) writeRawText(raw []string) {
+	for _, r := range raw {
+		if strings.HasPrefix(r, "<![CDATA[") {
+			s.writeCDATA(r)
+		} else {
+			s.writeText(r)
+		}
+	}
+}
+
+func (s *Serializer) node(n *Node) {
+	switch n.nodeType {
+	case DocumentFragmentNode, DocumentNode:
+		for _, c := range n.childNodes {
+			s.node(c)
+		}
+		return
+	case ElementNode:
+		s.element(n)
+		return
+	case AttributeNode:
+		s.attribute(n)
+		return
+	case ProcessingInstructionNode:
+		if n.nodeName == "xml" && n.parentNode != nil && n.parentNode.nodeType == DocumentNode {
+			s.declaration(n)
+			return
+		}
+	}
+	if len(n.Raw) > 0 && !n.ValueDirty {
+		if n.isText() {
+			s.writeRawText(n.Raw)
+		} else {
+			s.writeRaw(n.Raw)
+		}
+		return
+	}
+	switch n.nodeType {
+	case TextNode:
+		s.text(n.nodeValue)
+	case CDATASectionNode:
+		s.writeCDATA("<![CDATA[" + n.nodeValue + "]]>")
+	case ProcessingInstructionNode:
+		s.write("<?" + n.nodeName + " " + n.nodeValue + "?>")
+	case CommentNode:
+		s.write("<!--" + n.nodeValue + "-->")
+	case DocumentTypeNode:
+		if n.decl != nil {
+			s.write(n.declarationXML())
+		} else {
+			s.write("<!" + n.nodeValue + ">")
+		}
+	case EntityNode, NotationNode:
+		s.write(n.declarationXML())
+	case EntityReferenceNode:
+		s.write("&" + n.nodeName + ";")
+	}
+}
+
+func (s *Serializer) element(n *Node) {
+	indent := s.line
+	if len(n.Raw) >= 1 {
+		s.write(n.Raw[0])
+	} else {
+		s.write("<")
+	}
+	s.write(n.nodeName)
+	for i := 0; i < n.attributes.Length(); i++ {
+		s.attribute(n.attributes.Item(i))
+	}
+
+	var last string
+	var selfClosing bool = len(n.childNodes) == 0
+	var notSelfClosing bool = !selfClosing
+
+	if len(n.Raw) >= 4 {
+		if n.Raw[3] == "" {
+			if selfClosing {
+				s.write(n.Raw[2])
+				last = n.Raw[3]
+				selfClosing = false
+			}
+		} else if n.Raw[1] == n.nodeName || n.Raw[3] == "" {
+			last = n.Raw[3]
+			s.write(n.Raw[2])
+			selfClosing = false
+			notSelfClosing = false
+		}
+	}
+	if selfClosing {
+		s.write("/>")
+		last = ""
+	} else if notSelfClosing {
+		s.write(">")
+		last = "</" + n.nodeName + ">"
+	}
+
+	if s.Mode == ReformatDirty && s.unit == "" {
+		s.inferIndentUnit(n, indent)
+	}
+	if s.Mode == ReformatDirty && hasDirtyChild(n) && !hasMixedContent(n) && !preserveSpace(n) {
+		s.reformatChildren(n, indent)
+	} else {
+		for _, c := range n.childNodes {
+			s.node(c)
+		}
+	}
+
+	s.write(last)
+}
+
+func (s *Serializer) attribute(n *Node) {
+	if len(n.Raw) >= 1 {
+		s.write(n.Raw[0])
+	} else {
+		s.write(" ")
+	}
+	s.write(n.nodeName)
+	if len(n.Raw) >= 5 && !n.ValueDirty {
+		s.write(n.Raw[2])
+		s.writeText(n.Raw[3])
+		s.write(n.Raw[4])
+	} else {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(n.nodeValue))
+		s.write("=\"")
+		s.writeText(b.String())
+		s.write("\"")
+	}
+}
+
+// text writes character data, escaping markup characters.
+func (s *Serializer) text(data string) {
+	for {
+		i := strings.IndexAny(data, "<>&")
+		if i < 0 {
+			s.writeText(data)
+			return
+		}
+		s.writeText(data[:i])
+		switch data[i] {
+		case '<':
+			s.write("&lt;")
+		case '>':
+			s.write("&gt;")
+		case '&':
+			s.write("&amp;")
+		}
+		data = data[i+1:]
+	}
+}
@@ -0,0 +1,316 @@
+package xmldom
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// benchmarkDocument returns a document of about size bytes, with nested
+// elements, attributes, text and comments.
+func benchmarkDocument(size int) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\"?>\n<catalog xmlns=\"urn:catalog\">\n")
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "  <item id=\"i%d\" price='%d.99'>\n", i, i%100)
+		fmt.Fprintf(&b, "    <name>Item &amp; thing %d</name>\n", i)
+		fmt.Fprintf(&b, "    <!-- comment %d -->\n", i)
+		fmt.Fprintf(&b, "    <description><![CDATA[<p>Item %d</p>]]> and text</description>\n", i)
+		b.WriteString("    <empty/>\n  </item>\n")
+	}
+	b.WriteString("</catalog>\n")
+	return b.Bytes()
+}
+
+func benchmarkSerialize(b *testing.B, size int, serialize func(doc *Node)) {
+	src := benchmarkDocument(size)
+	doc, err := ParseXML(bytes.NewReader(src))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serialize(doc)
+	}
+}
+
+// concatXML is XML as it was before the Serializer: it builds the result by
+// concatenating strings. It is kept as the baseline of the benchmarks.
+func concatXML(n *Node) string {
+	switch n.nodeType {
+	case DocumentFragmentNode, DocumentNode:
+		var res string
+		for _, cn := range n.childNodes {
+			res += concatXML(cn)
+		}
+		return res
+	case ElementNode:
+		var res string
+		if len(n.Raw) >= 1 {
+			res += n.Raw[0]
+		} else {
+			res += "<"
+		}
+		res += n.nodeName
+		for i := 0; i < n.Attributes().Length(); i++ {
+			res += concatXML(n.Attributes().Item(i))
+		}
+
+		var last string
+		var self_closing bool = len(n.childNodes) == 0
+		var not_self_closing bool = !self_closing
+
+		if len(n.Raw) >= 4 {
+			if n.Raw[3] == "" {
+				if self_closing {
+					res += n.Raw[2]
+					last = n.Raw[3]
+					self_closing = false
+				}
+			} else if n.Raw[1] == n.nodeName || n.Raw[3] == "" {
+				last = n.Raw[3]
+				res += n.Raw[2]
+				self_closing = false
+				not_self_closing = false
+			}
+		}
+		if self_closing {
+			res += "/>"
+			last = ""
+		} else if not_self_closing {
+			res += ">"
+			last = fmt.Sprintf("</%s>", n.nodeName)
+		}
+
+		for _, cn := range n.childNodes {
+			res += concatXML(cn)
+		}
+
+		res += last
+		return res
+	case AttributeNode:
+		var res string
+		if len(n.Raw) >= 1 {
+			res += n.Raw[0]
+		} else {
+			res += " "
+		}
+		res += n.nodeName
+		if len(n.Raw) >= 5 && !n.ValueDirty {
+			res += n.Raw[2]
+			res += n.Raw[3]
+			res += n.Raw[4]
+		} else {
+			var b bytes.Buffer
+			res += "=\""
+			xml.EscapeText(&b, []byte(n.nodeValue))
+			res += string(b.Bytes())
+			res += "\""
+		}
+		return res
+	case TextNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		var res string
+		for _, c := range n.nodeValue {
+			if c == '<' {
+				res += "&lt;"
+			} else if c == '>' {
+				res += "&gt;"
+			} else if c == '&' {
+				res += "&amp;"
+			} else {
+				res += string(c)
+			}
+		}
+		return res
+	case CDATASectionNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		return "<![CDATA[" + n.nodeValue + "]]>"
+	case ProcessingInstructionNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		return "<?" + n.nodeName + " " + n.nodeValue + "?>"
+	case CommentNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		return "<!--" + n.nodeValue + "-->"
+	case DocumentTypeNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		} else if n.decl != nil {
+			return n.declarationXML()
+		}
+		return "<!" + n.nodeValue + ">"
+	case EntityNode, NotationNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		return n.declarationXML()
+	case EntityReferenceNode:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		return "&" + n.nodeName + ";"
+	default:
+		if len(n.Raw) > 0 && !n.ValueDirty {
+			return strings.Join(n.Raw, "")
+		}
+		return ""
+	}
+}
+
+// BenchmarkConcatXML1MB is the baseline of BenchmarkXML1MB. There is no 8 MB
+// variant: concatenation is quadratic and takes minutes at that size.
+func BenchmarkConcatXML1MB(b *testing.B) {
+	benchmarkSerialize(b, 1<<20, func(doc *Node) { concatXML(doc) })
+}
+
+func BenchmarkXML1MB(b *testing.B) {
+	benchmarkSerialize(b, 1<<20, func(doc *Node) { doc.XML() })
+}
+
+func BenchmarkXML8MB(b *testing.B) {
+	benchmarkSerialize(b, 8<<20, func(doc *Node) { doc.XML() })
+}
+
+func BenchmarkWriteTo1MB(b *testing.B) {
+	benchmarkSerialize(b, 1<<20, func(doc *Node) { doc.WriteTo(ioutil.Discard) })
+}
+
+func BenchmarkWriteTo8MB(b *testing.B) {
+	benchmarkSerialize(b, 8<<20, func(doc *Node) { doc.WriteTo(ioutil.Discard) })
+}
+
+func TestWriteTo(t *testing.T) {
+	src := "<?xml version='1.0'?>\n<!DOCTYPE r [\n  <!ENTITY e \"entity\">\n]>\n" +
+		"<r  a = 'x&amp;y' >\n  <i id=\"1\">text &e; &#x41;</i>\n  <!-- c -->\n" +
+		"  <?pi  data ?>\n  <d><![CDATA[<p>]]></d>\n  <e/><f></f >\n</r>\n"
+	tests := []struct {
+		name string
+		edit func(r *Node)
+		want string
+	}{
+		{"unmodified", func(r *Node) {}, src},
+		{"attribute", func(r *Node) {
+			r.SetAttribute("a", "<free & \"cheap\">")
+		}, "<?xml version='1.0'?>\n<!DOCTYPE r [\n  <!ENTITY e \"entity\">\n]>\n" +
+			"<r  a=\"&lt;free &amp; &#34;cheap&#34;&gt;\" >\n  <i id=\"1\">text &e; &#x41;</i>\n  <!-- c -->\n" +
+			"  <?pi  data ?>\n  <d><![CDATA[<p>]]></d>\n  <e/><f></f >\n</r>\n"},
+		{"children", func(r *Node) {
+			r.GetElementsByTagName("e").Item(0).AppendChild(r.OwnerDocument().CreateTextNode("a<b"))
+			f := r.GetElementsByTagName("f").Item(0)
+			for f.FirstChild() != nil {
+				f.RemoveChild(f.FirstChild())
+			}
+			r.GetElementsByTagName("i").Item(0).FirstChild().SetNodeValue("new")
+		}, "<?xml version='1.0'?>\n<!DOCTYPE r [\n  <!ENTITY e \"entity\">\n]>\n" +
+			"<r  a = 'x&amp;y' >\n  <i id=\"1\">new</i>\n  <!-- c -->\n" +
+			"  <?pi  data ?>\n  <d><![CDATA[<p>]]></d>\n  <e>a&lt;b</e><f></f >\n</r>\n"},
+	}
+	for _, test := range tests {
+		doc, err := ParseXML(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.edit(doc.DocumentElement())
+		var b bytes.Buffer
+		n, err := doc.WriteTo(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.want {
+			t.Errorf("%s: WriteTo wrote %q, want %q", test.name, b.String(), test.want)
+		}
+		if n != int64(b.Len()) {
+			t.Errorf("%s: WriteTo returned %d, wrote %d bytes", test.name, n, b.Len())
+		}
+		if xml := doc.XML(); xml != test.want {
+			t.Errorf("%s: XML() = %q, want %q", test.name, xml, test.want)
+		}
+	}
+}
+
+func TestSerializerModes(t *testing.T) {
+	src := "<root  a = \"1\">\n    <item><name>One</name>\n      <price>1</price></item>\n    <mixed>text <b>bold</b> </mixed>\n</root>\n"
+	tests := []struct {
+		mode   SerializeMode
+		indent string
+		edit   bool
+		want   string
+	}{
+		{Pretty, "\t", false, "<root a=\"1\">\n\t<item>\n\t\t<name>One</name>\n\t\t<price>1</price>\n\t</item>\n\t<mixed>text <b>bold</b> </mixed>\n</root>\n"},
+		{Minify, "", false, "<root a=\"1\"><item><name>One</name><price>1</price></item><mixed>text <b>bold</b> </mixed></root>"},
+		{ReformatDirty, "", false, src},
+		{ReformatDirty, "", true, "<root  a = \"1\">\n    <item><name>One</name>\n      <price>1</price></item>\n    <mixed>text <b>bold</b> </mixed>\n    <new>\n        <child/>\n    </new>\n</root>\n"},
+	}
+	for _, test := range tests {
+		doc, err := ParseXML(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.edit {
+			e, _ := doc.CreateElement("new")
+			c, _ := doc.CreateElement("child")
+			e.AppendChild(c)
+			doc.DocumentElement().AppendChild(e)
+		}
+		var b bytes.Buffer
+		s := NewSerializer(&b)
+		s.Mode = test.mode
+		s.Indent = test.indent
+		if err := s.Serialize(doc); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.want {
+			t.Errorf("mode %d: got %q, want %q", test.mode, b.String(), test.want)
+		}
+	}
+}
+
+// TestReformatDirtyEdited checks that the parsed nodes modified after parsing
+// are laid out like the created ones, and the unmodified ones are not.
+func TestReformatDirtyEdited(t *testing.T) {
+	src := "<root>\n  <a><b/></a><!--c-->\n  <d>text</d>\n</root>"
+	tests := []struct {
+		name string
+		edit func(root *Node)
+		want string
+	}{
+		{"unmodified", func(root *Node) {}, src},
+		{"comment", func(root *Node) {
+			root.ChildNodes()[2].SetNodeValue("new")
+		}, "<root>\n  <a><b/></a>\n  <!--new-->\n  <d>text</d>\n</root>"},
+		{"renamed", func(root *Node) {
+			root.ChildNodes()[1].SetNodeName("e")
+		}, "<root>\n  <e>\n    <b/>\n  </e>\n  <!--c-->\n  <d>text</d>\n</root>"},
+		{"text in mixed content", func(root *Node) {
+			root.ChildNodes()[4].FirstChild().SetNodeValue("new")
+		}, "<root>\n  <a><b/></a><!--c-->\n  <d>new</d>\n</root>"},
+	}
+	for _, test := range tests {
+		doc, err := ParseXML(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.edit(doc.DocumentElement())
+		var b bytes.Buffer
+		s := NewSerializer(&b)
+		s.Mode = ReformatDirty
+		if err := s.Serialize(doc); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, b.String(), test.want)
+		}
+	}
+}
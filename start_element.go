@@ -57,10 +57,10 @@ func parseStartElement(code string) startElement {
 	elem.Before, code = parseWhile(code, "<"+xmlWhitespace)
 	elem.TagName, code = parseUntil(code, "/>"+xmlWhitespace)
 	sp, code = parseWhile(code, xmlWhitespace)
-	for !strings.HasPrefix(code, "/") && !strings.HasPrefix(code, ">") {
+	for code != "" && !strings.HasPrefix(code, "/") && !strings.HasPrefix(code, ">") {
 		var attr startElementAttribute
 		attr.Before = sp
-		attr.Name, code = parseUntil(code, "="+xmlWhitespace)
+		attr.Name, code = parseUntil(code, "=/>"+xmlWhitespace)
 		sp, code = parseWhile(code, xmlWhitespace)
 		if strings.HasPrefix(code, "=") {
 			attr.Between, code = parseWhile(code, "="+xmlWhitespace)
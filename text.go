@@ -0,0 +1,123 @@
+package xmldom
+
+import (
+	"unicode/utf16"
+)
+
+func (n *Node) isText() bool {
+	return n.nodeType == TextNode || n.nodeType == CDATASectionNode
+}
+
+// SplitText breaks a text or CDATA section node in two at offset, counted in
+// UTF-16 code units. The node keeps the data before offset and a new node of
+// the same type with the rest of the data is inserted after it and returned.
+func (n *Node) SplitText(offset uint) (*Node, Error) {
+	if !n.isText() {
+		return nil, err(NotSupportedError)
+	}
+	data := utf16.Encode([]rune(n.nodeValue))
+	if offset > uint(len(data)) {
+		return nil, err(IndexSizeError)
+	}
+	newNode := n.CloneNode(false)
+	newNode.nodeValue = string(utf16.Decode(data[offset:]))
+	newNode.ValueDirty = true
+	if n.parentNode != nil {
+		_, e := n.parentNode.InsertBefore(newNode, n.NextSibling())
+		if e != nil {
+			return nil, e
+		}
+		n.ownerDocument.splittingText(n, newNode, offset)
+	}
+	n.ownerDocument.replacingData(n, offset, uint(len(data))-offset, 0)
+	n.setNodeValue(string(utf16.Decode(data[:offset])))
+	return newNode, nil
+}
+
+// Normalize merges the adjacent text nodes in the subtree of the node and
+// removes the empty ones. Text nodes that were not modified are merged with
+// their source text so that the serialization does not change.
+func (n *Node) Normalize() {
+	for i := 0; i < len(n.childNodes); {
+		c := n.childNodes[i]
+		if c.nodeType != TextNode {
+			c.Normalize()
+			i++
+			continue
+		}
+		for next := c.NextSibling(); next != nil && next.nodeType == TextNode; next = c.NextSibling() {
+			c.mergeText(next)
+			n.RemoveChild(next)
+		}
+		if c.nodeValue == "" {
+			n.RemoveChild(c)
+		} else {
+			i++
+		}
+	}
+}
+
+// mergeText appends the data of the text node next to the text node.
+func (n *Node) mergeText(next *Node) {
+	if len(n.Raw) > 0 && !n.ValueDirty && len(next.Raw) > 0 && !next.ValueDirty {
+		n.changing()
+		n.nodeValue += next.nodeValue
+		n.Raw = append(n.Raw, next.Raw...)
+	} else {
+		n.AppendData(next.nodeValue)
+	}
+}
+
+// logicallyAdjacentText returns the text and CDATA section nodes adjacent to
+// the node, in document order and including itself.
+func (n *Node) logicallyAdjacentText() NodeList {
+	first := n
+	for p := n.PreviousSibling(); p != nil && p.isText(); p = p.PreviousSibling() {
+		first = p
+	}
+	var res NodeList
+	for t := first; t != nil && t.isText(); t = t.NextSibling() {
+		res = append(res, t)
+	}
+	return res
+}
+
+// WholeText returns the text of the node concatenated with the text of the
+// text and CDATA section nodes adjacent to it.
+func (n *Node) WholeText() string {
+	if !n.isText() {
+		return ""
+	}
+	var res string
+	for _, t := range n.logicallyAdjacentText() {
+		res += t.nodeValue
+	}
+	return res
+}
+
+// ReplaceWholeText replaces the text of the node and of the text nodes
+// adjacent to it with content. The adjacent nodes are removed and the node
+// is returned, or nil if content is empty in which case it is removed too.
+func (n *Node) ReplaceWholeText(content string) (*Node, Error) {
+	if !n.isText() {
+		return nil, err(NotSupportedError)
+	}
+	for _, t := range n.logicallyAdjacentText() {
+		if t == n || t.parentNode == nil {
+			continue
+		}
+		if _, e := t.parentNode.RemoveChild(t); e != nil {
+			return nil, e
+		}
+	}
+	if content == "" {
+		if n.parentNode != nil {
+			if _, e := n.parentNode.RemoveChild(n); e != nil {
+				return nil, e
+			}
+		}
+		return nil, nil
+	}
+	n.SetNodeValue(content)
+	return n, nil
+}
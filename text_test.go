@@ -0,0 +1,139 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		src         string
+		offset      uint
+		left, right string
+		xml         string
+		code        ErrorCode
+	}{
+		{`<a>hello</a>`, 2, "he", "llo", `<a>hello</a>`, 0},
+		{`<a>hello</a>`, 0, "", "hello", `<a>hello</a>`, 0},
+		{`<a>hello</a>`, 5, "hello", "", `<a>hello</a>`, 0},
+		{`<a>hello</a>`, 6, "hello", "", `<a>hello</a>`, IndexSizeError},
+		{`<a>é𝄞x</a>`, 3, "é𝄞", "x", `<a>é𝄞x</a>`, 0},
+		{`<a>a&amp;b</a>`, 2, "a&", "b", `<a>a&amp;b</a>`, 0},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, test.src)
+		a := doc.DocumentElement()
+		text := a.FirstChild()
+		right, e := text.SplitText(test.offset)
+		if test.code != 0 {
+			if e == nil || e.Code() != test.code || len(a.ChildNodes()) != 1 {
+				t.Errorf("%s: SplitText(%d) = %v, %v", test.src, test.offset, right, e)
+			}
+			continue
+		}
+		if e != nil {
+			t.Errorf("%s: SplitText(%d): %v", test.src, test.offset, e)
+			continue
+		}
+		if text.Data() != test.left || right.Data() != test.right || text.NextSibling() != right {
+			t.Errorf("%s: SplitText(%d) gave %q and %q", test.src, test.offset, text.Data(), right.Data())
+		}
+		if got := doc.XML(); got != test.xml {
+			t.Errorf("%s: XML() = %s, want %s", test.src, got, test.xml)
+		}
+	}
+
+	doc := NewDocument()
+	c, _ := doc.CreateCDATASection("abc")
+	right, e := c.SplitText(1)
+	if e != nil || right.NodeType() != CDATASectionNode || right.Data() != "bc" || right.ParentNode() != nil {
+		t.Errorf("SplitText of a detached CDATA section = %v, %v", right, e)
+	}
+	if _, e := doc.CreateComment("abc").SplitText(1); e == nil || e.Code() != NotSupportedError {
+		t.Errorf("SplitText of a comment: %v", e)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		edit func(doc, a *Node)
+		xml  string
+		n    int
+	}{
+		{"parsed", `<a>x<![CDATA[<y>]]>z<b/>w</a>`, func(doc, a *Node) {}, `<a>x<![CDATA[<y>]]>z<b/>w</a>`, 3},
+		{"split", `<a>a&amp;b</a>`, func(doc, a *Node) {
+			a.FirstChild().SplitText(1)
+		}, `<a>a&amp;b</a>`, 1},
+		{"appended", `<a>x</a>`, func(doc, a *Node) {
+			a.AppendChild(doc.CreateTextNode("<y>"))
+		}, `<a>x&lt;y&gt;</a>`, 1},
+		{"empty", `<a><b/></a>`, func(doc, a *Node) {
+			a.AppendChild(doc.CreateTextNode(""))
+			a.FirstChild().AppendChild(doc.CreateTextNode(""))
+		}, `<a><b/></a>`, 1},
+		{"nested", `<a><b>x</b></a>`, func(doc, a *Node) {
+			b := a.FirstChild()
+			b.AppendChild(doc.CreateTextNode("y"))
+			b.InsertBefore(doc.CreateTextNode("w"), b.FirstChild())
+		}, `<a><b>wxy</b></a>`, 1},
+		{"CDATA section", `<a>x</a>`, func(doc, a *Node) {
+			c, _ := doc.CreateCDATASection("y")
+			a.AppendChild(c)
+			a.AppendChild(doc.CreateTextNode("z"))
+		}, `<a>x<![CDATA[y]]>z</a>`, 3},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, test.src)
+		a := doc.DocumentElement()
+		test.edit(doc, a)
+		text := a.AsText()
+		doc.Normalize()
+		if got := doc.XML(); got != test.xml {
+			t.Errorf("%s: XML() = %s, want %s", test.name, got, test.xml)
+		}
+		if len(a.ChildNodes()) != test.n || a.AsText() != text {
+			t.Errorf("%s: %d children with text %q, want %d with text %q", test.name, len(a.ChildNodes()), a.AsText(), test.n, text)
+		}
+		checkChildren(t, a)
+	}
+}
+
+func TestWholeText(t *testing.T) {
+	tests := []struct {
+		index   int
+		whole   string
+		content string
+		xml     string
+	}{
+		{0, "xyz", "new", `<a>new<b/>w</a>`},
+		{2, "xyz", "", `<a><b/>w</a>`},
+		{4, "w", "v", `<a>x<![CDATA[y]]>z<b/>v</a>`},
+		{3, "", "", ""},
+	}
+	for _, test := range tests {
+		doc, err := ParseXMLWithOptions(strings.NewReader(`<a>x<![CDATA[y]]>z<b/>w</a>`), &ParseOptions{CDATASections: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := doc.DocumentElement()
+		n := a.ChildNodes()[test.index]
+		if whole := n.WholeText(); whole != test.whole {
+			t.Errorf("%d: WholeText() = %q, want %q", test.index, whole, test.whole)
+		}
+		res, e := n.ReplaceWholeText(test.content)
+		if test.xml == "" {
+			if e == nil || e.Code() != NotSupportedError {
+				t.Errorf("%d: ReplaceWholeText of an element: %v", test.index, e)
+			}
+			continue
+		}
+		if e != nil || (test.content == "") != (res == nil) {
+			t.Errorf("%d: ReplaceWholeText(%q) = %v, %v", test.index, test.content, res, e)
+		}
+		if got := doc.XML(); got != test.xml {
+			t.Errorf("%d: XML() = %s, want %s", test.index, got, test.xml)
+		}
+	}
+}
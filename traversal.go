@@ -0,0 +1,446 @@
+package xmldom
+
+// Flags of whatToShow, selecting the types of the nodes that NodeIterator and
+// TreeWalker show. The flag of a node type is 1 << (NodeType - 1).
+const (
+	ShowElement uint32 = 1 << iota
+	ShowAttribute
+	ShowText
+	ShowCDATASection
+	ShowEntityReference
+	ShowEntity
+	ShowProcessingInstruction
+	ShowComment
+	ShowDocument
+	ShowDocumentType
+	ShowDocumentFragment
+	ShowNotation
+
+	ShowAll uint32 = 0xFFFFFFFF
+)
+
+// FilterResult tells whether a NodeFilter accepts a node.
+type FilterResult uint
+
+const (
+	// FilterAccept shows the node.
+	FilterAccept FilterResult = iota + 1
+	// FilterReject hides the node. A TreeWalker also hides its
+	// descendants, but a NodeIterator still shows them.
+	FilterReject
+	// FilterSkip hides the node but not its descendants.
+	FilterSkip
+)
+
+// NodeFilter selects the nodes that NodeIterator and TreeWalker show among
+// the ones whatToShow shows.
+type NodeFilter interface {
+	AcceptNode(n *Node) FilterResult
+}
+
+// NodeFilterFunc is a function used as a NodeFilter.
+type NodeFilterFunc func(n *Node) FilterResult
+
+func (f NodeFilterFunc) AcceptNode(n *Node) FilterResult {
+	return f(n)
+}
+
+// traversal holds what NodeIterator and TreeWalker have in common.
+type traversal struct {
+	root                   *Node
+	whatToShow             uint32
+	filter                 NodeFilter
+	expandEntityReferences bool
+}
+
+func (t *traversal) Root() *Node {
+	return t.root
+}
+
+func (t *traversal) WhatToShow() uint32 {
+	return t.whatToShow
+}
+
+func (t *traversal) Filter() NodeFilter {
+	return t.filter
+}
+
+// ExpandEntityReferences tells if the children of the entity references are
+// shown.
+func (t *traversal) ExpandEntityReferences() bool {
+	return t.expandEntityReferences
+}
+
+func (t *traversal) accept(n *Node) FilterResult {
+	if t.whatToShow&(1<<(n.nodeType-1)) == 0 {
+		return FilterSkip
+	}
+	if t.filter == nil {
+		return FilterAccept
+	}
+	return t.filter.AcceptNode(n)
+}
+
+// children returns the children of n that are traversed.
+func (t *traversal) children(n *Node) NodeList {
+	if n.nodeType == EntityReferenceNode && !t.expandEntityReferences {
+		return nil
+	}
+	return n.childNodes
+}
+
+func (t *traversal) firstChild(n *Node) *Node {
+	if children := t.children(n); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+func (t *traversal) lastChild(n *Node) *Node {
+	if children := t.children(n); len(children) > 0 {
+		return children[len(children)-1]
+	}
+	return nil
+}
+
+// following returns the node after n in the subtree of the root, in document
+// order, skipping the descendants of n if descendants is false.
+func (t *traversal) following(n *Node, descendants bool) *Node {
+	if c := t.firstChild(n); c != nil && descendants {
+		return c
+	}
+	for ; n != nil && n != t.root; n = n.parentNode {
+		if next := n.NextSibling(); next != nil {
+			return next
+		}
+	}
+	return nil
+}
+
+// preceding returns the node before n in the subtree of the root, in
+// document order.
+func (t *traversal) preceding(n *Node) *Node {
+	if n == t.root {
+		return nil
+	}
+	if prev := n.PreviousSibling(); prev != nil {
+		for c := t.lastChild(prev); c != nil; c = t.lastChild(c) {
+			prev = c
+		}
+		return prev
+	}
+	return n.parentNode
+}
+
+// NodeIterator iterates over the nodes of a subtree in document order, as
+// a flat list. It keeps its position when nodes are removed from the tree.
+type NodeIterator struct {
+	traversal
+	referenceNode              *Node
+	pointerBeforeReferenceNode bool
+	detached                   bool
+}
+
+// CreateNodeIterator returns an iterator over root and its descendants,
+// positioned before root. whatToShow is a combination of the Show flags, and
+// filter may be nil. The document updates the iterator when nodes are
+// removed until Detach is called. The document holds the iterator until then,
+// so Detach must be called once the iterator is no longer used.
+func (d *Node) CreateNodeIterator(root *Node, whatToShow uint32, filter NodeFilter, entityReferenceExpansion bool) (*NodeIterator, Error) {
+	if root == nil {
+		return nil, err(NotSupportedError)
+	}
+	it := &NodeIterator{
+		traversal:                  traversal{root, whatToShow, filter, entityReferenceExpansion},
+		referenceNode:              root,
+		pointerBeforeReferenceNode: true,
+	}
+	if doc := root.ownerDocument; doc != nil && doc.state != nil {
+		doc.state.iterators = append(doc.state.iterators, it)
+	}
+	return it, nil
+}
+
+// ReferenceNode returns the node the iterator is positioned before or after.
+func (it *NodeIterator) ReferenceNode() *Node {
+	return it.referenceNode
+}
+
+// PointerBeforeReferenceNode tells if the iterator is positioned before its
+// reference node.
+func (it *NodeIterator) PointerBeforeReferenceNode() bool {
+	return it.pointerBeforeReferenceNode
+}
+
+// NextNode returns the next node shown and moves the iterator after it, or
+// returns nil at the end of the subtree.
+func (it *NodeIterator) NextNode() (*Node, Error) {
+	return it.traverse(true)
+}
+
+// PreviousNode returns the previous node shown and moves the iterator before
+// it, or returns nil at the start of the subtree.
+func (it *NodeIterator) PreviousNode() (*Node, Error) {
+	return it.traverse(false)
+}
+
+func (it *NodeIterator) traverse(next bool) (*Node, Error) {
+	if it.detached {
+		return nil, err(InvalidStateError)
+	}
+	node := it.referenceNode
+	before := it.pointerBeforeReferenceNode
+	for {
+		if next && !before {
+			if node = it.following(node, true); node == nil {
+				return nil, nil
+			}
+		} else if !next && before {
+			if node = it.preceding(node); node == nil {
+				return nil, nil
+			}
+		}
+		before = !next
+		if it.accept(node) == FilterAccept {
+			break
+		}
+	}
+	it.referenceNode = node
+	it.pointerBeforeReferenceNode = before
+	return node, nil
+}
+
+// Detach releases the iterator from its document, which keeps it in memory
+// and updates it on every removal otherwise. NextNode and PreviousNode fail
+// afterwards.
+func (it *NodeIterator) Detach() {
+	if it.detached {
+		return
+	}
+	it.detached = true
+	if doc := it.root.ownerDocument; doc != nil && doc.state != nil {
+		iterators := doc.state.iterators
+		for i, other := range iterators {
+			if other == it {
+				doc.state.iterators = append(iterators[:i:i], iterators[i+1:]...)
+				break
+			}
+		}
+	}
+	it.referenceNode = nil
+}
+
+// removing moves the iterator out of the subtree of n before it is removed
+// from the tree.
+func (it *NodeIterator) removing(n *Node) {
+	ref := it.referenceNode
+	if n == it.root || it.root.IsAncestor(n) || (n != ref && !ref.IsAncestor(n)) {
+		return
+	}
+	if it.pointerBeforeReferenceNode {
+		if next := it.following(n, false); next != nil {
+			it.referenceNode = next
+			return
+		}
+		it.pointerBeforeReferenceNode = false
+	}
+	it.referenceNode = it.preceding(n)
+}
+
+// TreeWalker navigates the subtree of a node, showing the tree as if the
+// nodes it does not show were replaced by their children.
+type TreeWalker struct {
+	traversal
+	currentNode *Node
+}
+
+// CreateTreeWalker returns a tree walker over the subtree of root,
+// positioned on root. whatToShow is a combination of the Show flags, and
+// filter may be nil.
+func (d *Node) CreateTreeWalker(root *Node, whatToShow uint32, filter NodeFilter, entityReferenceExpansion bool) (*TreeWalker, Error) {
+	if root == nil {
+		return nil, err(NotSupportedError)
+	}
+	return &TreeWalker{
+		traversal:   traversal{root, whatToShow, filter, entityReferenceExpansion},
+		currentNode: root,
+	}, nil
+}
+
+// CurrentNode returns the node the walker is positioned on, which it may not
+// show.
+func (w *TreeWalker) CurrentNode() *Node {
+	return w.currentNode
+}
+
+// SetCurrentNode positions the walker on any node, even outside its subtree.
+func (w *TreeWalker) SetCurrentNode(n *Node) Error {
+	if n == nil {
+		return err(NotSupportedError)
+	}
+	w.currentNode = n
+	return nil
+}
+
+// ParentNode moves to the closest ancestor of the current node shown in the
+// subtree and returns it, or returns nil without moving.
+func (w *TreeWalker) ParentNode() *Node {
+	for n := w.currentNode; n != nil && n != w.root; {
+		n = n.parentNode
+		if n != nil && w.accept(n) == FilterAccept {
+			w.currentNode = n
+			return n
+		}
+	}
+	return nil
+}
+
+// FirstChild moves to the first child shown of the current node and returns
+// it, or returns nil without moving.
+func (w *TreeWalker) FirstChild() *Node {
+	return w.traverseChildren(true)
+}
+
+// LastChild moves to the last child shown of the current node and returns
+// it, or returns nil without moving.
+func (w *TreeWalker) LastChild() *Node {
+	return w.traverseChildren(false)
+}
+
+// PreviousSibling moves to the previous sibling shown of the current node
+// and returns it, or returns nil without moving.
+func (w *TreeWalker) PreviousSibling() *Node {
+	return w.traverseSiblings(false)
+}
+
+// NextSibling moves to the next sibling shown of the current node and
+// returns it, or returns nil without moving.
+func (w *TreeWalker) NextSibling() *Node {
+	return w.traverseSiblings(true)
+}
+
+// first returns the first child of n if forward is true, otherwise the last.
+func (w *TreeWalker) first(n *Node, forward bool) *Node {
+	if forward {
+		return w.firstChild(n)
+	}
+	return w.lastChild(n)
+}
+
+// sibling returns the next sibling of n if forward is true, otherwise the
+// previous.
+func sibling(n *Node, forward bool) *Node {
+	if forward {
+		return n.NextSibling()
+	}
+	return n.PreviousSibling()
+}
+
+func (w *TreeWalker) traverseChildren(forward bool) *Node {
+	n := w.first(w.currentNode, forward)
+	for n != nil {
+		result := w.accept(n)
+		if result == FilterAccept {
+			w.currentNode = n
+			return n
+		}
+		if result == FilterSkip {
+			if c := w.first(n, forward); c != nil {
+				n = c
+				continue
+			}
+		}
+		for n != nil {
+			if s := sibling(n, forward); s != nil {
+				n = s
+				break
+			}
+			parent := n.parentNode
+			if parent == nil || parent == w.root || parent == w.currentNode {
+				return nil
+			}
+			n = parent
+		}
+	}
+	return nil
+}
+
+func (w *TreeWalker) traverseSiblings(forward bool) *Node {
+	n := w.currentNode
+	if n == w.root {
+		return nil
+	}
+	for {
+		s := sibling(n, forward)
+		for s != nil {
+			n = s
+			result := w.accept(n)
+			if result == FilterAccept {
+				w.currentNode = n
+				return n
+			}
+			s = w.first(n, forward)
+			if result == FilterReject || s == nil {
+				s = sibling(n, forward)
+			}
+		}
+		n = n.parentNode
+		if n == nil || n == w.root || w.accept(n) == FilterAccept {
+			return nil
+		}
+	}
+}
+
+// PreviousNode moves to the previous node shown in document order and
+// returns it, or returns nil without moving.
+func (w *TreeWalker) PreviousNode() *Node {
+	n := w.currentNode
+	for n != w.root {
+		s := n.PreviousSibling()
+		for s != nil {
+			n = s
+			result := w.accept(n)
+			for result != FilterReject && w.lastChild(n) != nil {
+				n = w.lastChild(n)
+				result = w.accept(n)
+			}
+			if result == FilterAccept {
+				w.currentNode = n
+				return n
+			}
+			s = n.PreviousSibling()
+		}
+		if n == w.root || n.parentNode == nil {
+			return nil
+		}
+		n = n.parentNode
+		if w.accept(n) == FilterAccept {
+			w.currentNode = n
+			return n
+		}
+	}
+	return nil
+}
+
+// NextNode moves to the next node shown in document order and returns it,
+// or returns nil without moving.
+func (w *TreeWalker) NextNode() *Node {
+	n := w.currentNode
+	result := FilterAccept
+	for {
+		for result != FilterReject && w.firstChild(n) != nil {
+			n = w.firstChild(n)
+			if result = w.accept(n); result == FilterAccept {
+				w.currentNode = n
+				return n
+			}
+		}
+		if n = w.following(n, false); n == nil {
+			return nil
+		}
+		if result = w.accept(n); result == FilterAccept {
+			w.currentNode = n
+			return n
+		}
+	}
+}
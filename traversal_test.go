@@ -0,0 +1,198 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+const traversalDocument = `<a><b><c/>text<d/></b><!--comment--><e><f/></e></a>`
+
+// names returns the names of the nodes, with the text of text nodes.
+func names(nodes []*Node) string {
+	var res []string
+	for _, n := range nodes {
+		if n.nodeType == TextNode || n.nodeType == CommentNode {
+			res = append(res, n.nodeValue)
+		} else {
+			res = append(res, n.nodeName)
+		}
+	}
+	return strings.Join(res, " ")
+}
+
+func parseTraversal(t *testing.T, src string) *Node {
+	doc, err := ParseXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestNodeIterator(t *testing.T) {
+	doc := parseTraversal(t, traversalDocument)
+	rejectB := NodeFilterFunc(func(n *Node) FilterResult {
+		if n.nodeName == "b" {
+			return FilterReject
+		}
+		return FilterAccept
+	})
+	tests := []struct {
+		whatToShow uint32
+		filter     NodeFilter
+		want       string
+	}{
+		{ShowAll, nil, "#document a b c text d comment e f"},
+		{ShowElement, nil, "a b c d e f"},
+		{ShowText | ShowComment, nil, "text comment"},
+		{ShowElement, rejectB, "a c d e f"},
+	}
+	for _, test := range tests {
+		it, e := doc.CreateNodeIterator(doc, test.whatToShow, test.filter, false)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var forward, backward []*Node
+		for n, _ := it.NextNode(); n != nil; n, _ = it.NextNode() {
+			forward = append(forward, n)
+		}
+		for n, _ := it.PreviousNode(); n != nil; n, _ = it.PreviousNode() {
+			backward = append([]*Node{n}, backward...)
+		}
+		if names(forward) != test.want || names(backward) != test.want {
+			t.Errorf("whatToShow %x: got %q forward, %q backward, want %q", test.whatToShow, names(forward), names(backward), test.want)
+		}
+		it.Detach()
+		if _, e := it.NextNode(); e == nil || e.Code() != InvalidStateError {
+			t.Errorf("NextNode after Detach: %v", e)
+		}
+	}
+	if len(doc.state.iterators) != 0 {
+		t.Errorf("%d iterators left after Detach", len(doc.state.iterators))
+	}
+}
+
+func TestNodeIteratorRemoval(t *testing.T) {
+	tests := []struct {
+		steps   int // calls to NextNode before the removal
+		back    bool
+		remove  string
+		want    string // the following nodes
+		wantRef string
+	}{
+		// The reference node is removed, the iterator being after it.
+		{steps: 3, remove: "c", want: "text d comment e f", wantRef: "b"},
+		// An ancestor of the reference node is removed.
+		{steps: 4, remove: "b", want: "comment e f", wantRef: "a"},
+		// The iterator is before the reference node.
+		{steps: 4, back: true, remove: "b", want: "comment e f", wantRef: "#comment"},
+		{steps: 7, back: true, remove: "e", want: "", wantRef: "#comment"},
+		// Removing nodes after the iterator has no effect on it.
+		{steps: 2, remove: "e", want: "c text d comment", wantRef: "b"},
+	}
+	for _, test := range tests {
+		doc := parseTraversal(t, traversalDocument)
+		it, _ := doc.CreateNodeIterator(doc.DocumentElement(), ShowAll, nil, false)
+		for i := 0; i < test.steps; i++ {
+			it.NextNode()
+		}
+		if test.back {
+			it.PreviousNode()
+		}
+		removed := doc.GetElementsByTagName(test.remove).Item(0)
+		removed.ParentNode().RemoveChild(removed)
+		if it.ReferenceNode().NodeName() != test.wantRef {
+			t.Errorf("removing %s after %d steps: reference node %s, want %s", test.remove, test.steps, it.ReferenceNode().NodeName(), test.wantRef)
+		}
+		var rest []*Node
+		for n, _ := it.NextNode(); n != nil; n, _ = it.NextNode() {
+			rest = append(rest, n)
+		}
+		if names(rest) != test.want {
+			t.Errorf("removing %s after %d steps: got %q, want %q", test.remove, test.steps, names(rest), test.want)
+		}
+	}
+}
+
+func TestTreeWalker(t *testing.T) {
+	doc := parseTraversal(t, traversalDocument)
+	rejectB := NodeFilterFunc(func(n *Node) FilterResult {
+		if n.nodeName == "b" {
+			return FilterReject
+		}
+		return FilterAccept
+	})
+	skipB := NodeFilterFunc(func(n *Node) FilterResult {
+		if n.nodeName == "b" {
+			return FilterSkip
+		}
+		return FilterAccept
+	})
+	tests := []struct {
+		filter NodeFilter
+		want   string
+	}{
+		{nil, "a b c d e f"},
+		{rejectB, "a e f"},
+		{skipB, "a c d e f"},
+	}
+	for _, test := range tests {
+		w, _ := doc.CreateTreeWalker(doc.DocumentElement(), ShowElement, test.filter, false)
+		nodes := []*Node{w.CurrentNode()}
+		for n := w.NextNode(); n != nil; n = w.NextNode() {
+			nodes = append(nodes, n)
+		}
+		var backward []*Node
+		for n := w.PreviousNode(); n != nil; n = w.PreviousNode() {
+			backward = append([]*Node{n}, backward...)
+		}
+		backward = append(backward, nodes[len(nodes)-1])
+		if names(nodes) != test.want || names(backward) != test.want {
+			t.Errorf("got %q forward, %q backward, want %q", names(nodes), names(backward), test.want)
+		}
+	}
+
+	// Skipped nodes are replaced by their children.
+	w, _ := doc.CreateTreeWalker(doc.DocumentElement(), ShowElement, skipB, false)
+	var children []*Node
+	for n := w.FirstChild(); n != nil; n = w.NextSibling() {
+		children = append(children, n)
+	}
+	if names(children) != "c d e" {
+		t.Errorf("children %q, want %q", names(children), "c d e")
+	}
+	if w.CurrentNode().NodeName() != "e" || w.PreviousSibling().NodeName() != "d" || w.ParentNode().NodeName() != "a" {
+		t.Errorf("walker at %s", w.CurrentNode().NodeName())
+	}
+	if w.LastChild().NodeName() != "e" || w.ParentNode() != w.Root() || w.ParentNode() != nil {
+		t.Errorf("walker at %s, want the root", w.CurrentNode().NodeName())
+	}
+	if e := w.SetCurrentNode(nil); e == nil || e.Code() != NotSupportedError {
+		t.Errorf("SetCurrentNode(nil): %v", e)
+	}
+}
+
+func TestTraversalEntityReferences(t *testing.T) {
+	doc, err := ParseXMLWithOptions(strings.NewReader(`<!DOCTYPE a [<!ENTITY e "<b/>">]><a>&e;<c/></a>`), &ParseOptions{Entities: EntityKeep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expand := range []bool{false, true} {
+		want := "a e c"
+		if expand {
+			want = "a e b c"
+		}
+		it, _ := doc.CreateNodeIterator(doc.DocumentElement(), ShowElement|ShowEntityReference, nil, expand)
+		var nodes []*Node
+		for n, _ := it.NextNode(); n != nil; n, _ = it.NextNode() {
+			nodes = append(nodes, n)
+		}
+		w, _ := doc.CreateTreeWalker(doc.DocumentElement(), ShowElement|ShowEntityReference, nil, expand)
+		walked := []*Node{w.CurrentNode()}
+		for n := w.NextNode(); n != nil; n = w.NextNode() {
+			walked = append(walked, n)
+		}
+		if names(nodes) != want || names(walked) != want {
+			t.Errorf("expand %v: iterator %q, walker %q, want %q", expand, names(nodes), names(walked), want)
+		}
+	}
+}
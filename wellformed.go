@@ -0,0 +1,212 @@
+package xmldom
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DiagnosticKind classifies the well-formedness errors that the parser
+// repairs in lenient mode.
+type DiagnosticKind uint
+
+const (
+	_ DiagnosticKind = iota
+	// UnclosedElement is reported for elements left open at the end tag of an
+	// ancestor, whose following content is moved to the parent, and for
+	// elements left open at the end of the document.
+	UnclosedElement
+	// UnexpectedEndTag is reported for end tags that do not match an open
+	// element. They are ignored.
+	UnexpectedEndTag
+	// DuplicateAttribute is reported for attributes given twice on an
+	// element. The last value is kept.
+	DuplicateAttribute
+	// MalformedAttribute is reported for attributes without a value, whose
+	// value is the attribute name, and for unquoted values.
+	MalformedAttribute
+	// BadReference is reported for references to undeclared entities and for
+	// "&" not starting a reference. They are kept as text.
+	BadReference
+	// UnboundPrefix is reported for element and attribute names whose prefix
+	// is not declared. They are kept without namespace.
+	UnboundPrefix
+	// ContentOutsideRoot is reported for text and elements after the root
+	// element or outside of it. They are kept.
+	ContentOutsideRoot
+	// MissingRootElement is reported for documents without an element.
+	MissingRootElement
+)
+
+func (k DiagnosticKind) String() string {
+	switch k {
+	case UnclosedElement:
+		return "unclosed element"
+	case UnexpectedEndTag:
+		return "unexpected end tag"
+	case DuplicateAttribute:
+		return "duplicate attribute"
+	case MalformedAttribute:
+		return "malformed attribute"
+	case BadReference:
+		return "bad reference"
+	case UnboundPrefix:
+		return "unbound prefix"
+	case ContentOutsideRoot:
+		return "content outside root element"
+	case MissingRootElement:
+		return "missing root element"
+	default:
+		return fmt.Sprintf("diagnostic %d", k)
+	}
+}
+
+// Diagnostic describes a well-formedness error found in a document and how
+// the parser repaired it.
+type Diagnostic struct {
+	Kind     DiagnosticKind
+	Position Position
+	Msg      string // the error
+	Repair   string // what the parser did
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%v: %v: %s, %s", d.Position, d.Kind, d.Msg, d.Repair)
+}
+
+// ParseXMLRecover parses a document in lenient mode like ParseXMLWithOptions
+// and returns the well-formedness errors that were repaired, in document
+// order. Errors that cannot be repaired are returned as a ParseError. The
+// Strict option is ignored.
+func ParseXMLRecover(rr io.Reader, opts *ParseOptions) (*Node, []Diagnostic, error) {
+	p := newParser(opts)
+	p.opts.Strict = false
+	p.recover = true
+	if err := p.parseDocument(rr); err != nil {
+		return nil, p.diagnostics, err
+	}
+	return p.doc, p.diagnostics, nil
+}
+
+// checking tells whether well-formedness errors repaired by the parser are
+// looked for.
+func (p *parser) checking() bool {
+	return (p.opts.Strict || p.recover) && len(p.expanding) == 0
+}
+
+// report handles a well-formedness error that the parser can repair. It
+// stops parsing in strict mode and is recorded in recovery mode.
+func (p *parser) report(r *xmlReader, node, parent *Node, kind DiagnosticKind, pos Position, msg, repair string) error {
+	if !p.checking() {
+		return nil
+	}
+	if p.opts.Strict {
+		return p.parseError(r, pos, node, parent, msg, nil)
+	}
+	p.diagnostics = append(p.diagnostics, Diagnostic{kind, p.sourcePosition(pos), msg, repair})
+	return nil
+}
+
+// checkStartElement checks the start tag of the element n, found at start in
+// the source text data.
+func (p *parser) checkStartElement(r *xmlReader, n, parent *Node, start Position, data string) error {
+	if n.parentNode == p.doc && n.PreviousSibling() != nil {
+		for s := n.PreviousSibling(); s != nil; s = s.PreviousSibling() {
+			if s.nodeType == ElementNode {
+				if e := p.report(r, n, parent, ContentOutsideRoot, start, "element <"+n.nodeName+"> after the root element", "kept"); e != nil {
+					return e
+				}
+				break
+			}
+		}
+	}
+	if n.prefix != "" && n.namespaceURI == "" {
+		if e := p.report(r, n, parent, UnboundPrefix, start, "undeclared prefix "+n.prefix+" in <"+n.nodeName+">", "name kept without namespace"); e != nil {
+			return e
+		}
+	}
+	se, ranges := attributeRanges(start, data)
+	seen := map[string]bool{}
+	for i, sea := range se.Attributes {
+		pos := ranges[i].Start
+		var e error
+		switch {
+		case seen[sea.Name]:
+			e = p.report(r, n, parent, DuplicateAttribute, pos, "attribute "+sea.Name+" repeated", "last value kept")
+		case sea.Between == "":
+			e = p.report(r, n, parent, MalformedAttribute, pos, "attribute "+sea.Name+" without value", "name used as value")
+		case !strings.HasSuffix(sea.Between, "\"") && !strings.HasSuffix(sea.Between, "'"):
+			e = p.report(r, n, parent, MalformedAttribute, pos, "unquoted value of attribute "+sea.Name, "value read up to whitespace")
+		default:
+			e = p.checkReferences(r, n, parent, pos.advance(sea.Name+sea.Between), sea.Value)
+		}
+		if e != nil {
+			return e
+		}
+		seen[sea.Name] = true
+		if a := n.GetAttributeNode(sea.Name); a != nil && a.prefix != "" && a.prefix != "xmlns" && a.namespaceURI == "" {
+			if e := p.report(r, n, parent, UnboundPrefix, pos, "undeclared prefix "+a.prefix+" in attribute "+a.nodeName, "name kept without namespace"); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// checkText checks the source text raw of a text node found at start.
+func (p *parser) checkText(r *xmlReader, node, parent *Node, start Position, raw string) error {
+	if node == p.doc && !isWhitespace(raw) {
+		if e := p.report(r, node, parent, ContentOutsideRoot, start, "text outside the root element", "kept"); e != nil {
+			return e
+		}
+	}
+	return p.checkReferences(r, node, parent, start, raw)
+}
+
+// checkReferences checks the entity and character references in text found
+// at pos.
+func (p *parser) checkReferences(r *xmlReader, node, parent *Node, pos Position, text string) error {
+	for {
+		i := strings.IndexByte(text, '&')
+		if i < 0 {
+			return nil
+		}
+		pos = pos.advance(text[:i])
+		text = text[i:]
+		end := strings.IndexAny(text[1:], ";&<\"' \t\r\n") + 1
+		if end < 1 || text[end] != ';' {
+			if e := p.report(r, node, parent, BadReference, pos, "& not starting a reference", "kept as text"); e != nil {
+				return e
+			}
+			pos = pos.advance("&")
+			text = text[1:]
+			continue
+		}
+		name := text[1:end]
+		if !p.declaredEntity(name) {
+			if e := p.report(r, node, parent, BadReference, pos, "reference to undeclared entity &"+name+";", "kept as text"); e != nil {
+				return e
+			}
+		}
+		pos = pos.advance(text[:end+1])
+		text = text[end+1:]
+	}
+}
+
+// declaredEntity tells whether the entity name, or character reference, can
+// be referenced.
+func (p *parser) declaredEntity(name string) bool {
+	if _, ok := predefinedEntities[name]; ok {
+		return true
+	}
+	if _, ok := p.entities[name]; ok {
+		return true
+	}
+	if _, ok := parseCharRef(name); ok {
+		return true
+	}
+	if doctype := p.doc.Doctype(); doctype != nil && doctype.decl.entities.GetNamedItem(name) != nil {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package xmldom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseXMLRecover(t *testing.T) {
+	// The repaired tree is checked through its text and its minified
+	// serialization, which writes the repaired attribute values. Text is
+	// written as its source, so it is not checked for bad references.
+	tests := []struct {
+		src   string
+		kinds []DiagnosticKind
+		text  string
+		xml   string
+	}{
+		{`<a><b>x</a>`, []DiagnosticKind{UnclosedElement}, "x", `<a><b/>x</a>`},
+		{`<a>x</b></a>`, []DiagnosticKind{UnexpectedEndTag}, "x", `<a>x</a>`},
+		{`<a x="1" x="2"/>`, []DiagnosticKind{DuplicateAttribute}, "", `<a x="2"/>`},
+		{`<a x y=1/>`, []DiagnosticKind{MalformedAttribute, MalformedAttribute}, "", `<a x="x" y="1"/>`},
+		{`<a>&u; &#65;</a>`, []DiagnosticKind{BadReference}, "&u; A", ""},
+		{`<a>& b</a>`, []DiagnosticKind{BadReference}, "& b", ""},
+		{`<p:a q:x="1"/>`, []DiagnosticKind{UnboundPrefix, UnboundPrefix}, "", `<p:a q:x="1"/>`},
+		{`<a/>text<b/>`, []DiagnosticKind{ContentOutsideRoot, ContentOutsideRoot}, "", `<a/>text<b/>`},
+		{`<!-- only -->`, []DiagnosticKind{MissingRootElement}, "", `<!-- only -->`},
+		{`<a><b>`, []DiagnosticKind{UnclosedElement, UnclosedElement}, "", `<a><b/></a>`},
+		{`<a x="1">ok</a>`, nil, "ok", `<a x="1">ok</a>`},
+	}
+	for _, test := range tests {
+		doc, diagnostics, err := ParseXMLRecover(strings.NewReader(test.src), nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+		var kinds []DiagnosticKind
+		for _, d := range diagnostics {
+			kinds = append(kinds, d.Kind)
+		}
+		if len(kinds) != len(test.kinds) {
+			t.Errorf("%s: diagnostics %v, want %v", test.src, diagnostics, test.kinds)
+		} else {
+			for i := range kinds {
+				if kinds[i] != test.kinds[i] {
+					t.Errorf("%s: diagnostics %v, want %v", test.src, diagnostics, test.kinds)
+					break
+				}
+			}
+		}
+		if root := doc.DocumentElement(); root != nil && root.AsText() != test.text {
+			t.Errorf("%s: text %q, want %q", test.src, root.AsText(), test.text)
+		}
+		var b strings.Builder
+		s := NewSerializer(&b)
+		s.Mode = Minify
+		s.Serialize(doc)
+		if got := b.String(); test.xml != "" && got != test.xml {
+			t.Errorf("%s: got %s, want %s", test.src, got, test.xml)
+		}
+
+		_, err = ParseXMLWithOptions(strings.NewReader(test.src), &ParseOptions{Strict: true})
+		if _, ok := err.(*ParseError); ok != (len(test.kinds) > 0) {
+			t.Errorf("%s: strict mode returned %v", test.src, err)
+		}
+	}
+}
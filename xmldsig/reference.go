@@ -0,0 +1,147 @@
+package xmldsig
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/mildred/xml-dom"
+)
+
+// Reference is data to sign.
+type Reference struct {
+	// URI identifies the data: an empty string for the whole document of
+	// the signature, "#" followed by the ID of one of its elements, or
+	// another URI for data outside the document.
+	URI string
+	// Enveloped removes the signature from the data it is part of.
+	Enveloped bool
+	// Data is the content of a URI outside the document.
+	Data []byte
+}
+
+// digestReference returns the digest of the data a Reference element of the
+// signature refers to, and the node it refers to in the document, if any.
+func digestReference(signature, ref *xmldom.Node, resolve func(uri string) ([]byte, error)) (*xmldom.Node, []byte, error) {
+	dm := child(ref, "DigestMethod")
+	if dm == nil || !ref.HasAttribute("URI") {
+		return nil, nil, ErrMalformed
+	}
+	hash, ok := digestMethods[dm.GetAttribute("Algorithm")]
+	if !ok {
+		return nil, nil, ErrUnsupportedAlgorithm
+	}
+	var transforms []*xmldom.Node
+	if t := child(ref, "Transforms"); t != nil {
+		transforms = children(t, "Transform")
+	}
+	node, data, err := dereference(signature, ref.GetAttribute("URI"), transforms, resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := hash.New()
+	h.Write(data)
+	return node, h.Sum(nil), nil
+}
+
+// dereference returns the node a URI refers to, if it is in the document of
+// the signature, and the octets resulting from the transforms. Node-sets are
+// canonicalized with Canonical XML 1.0 if the transforms do not end with
+// a canonicalization.
+func dereference(signature *xmldom.Node, uri string, transforms []*xmldom.Node, resolve func(uri string) ([]byte, error)) (*xmldom.Node, []byte, error) {
+	var root *xmldom.Node
+	var data []byte
+	var err error
+	doc := signature.OwnerDocument()
+	switch {
+	case uri == "":
+		root = doc
+	case strings.HasPrefix(uri, "#"):
+		root, err = elementByID(doc, uri[1:])
+	case resolve != nil:
+		data, err = resolve(uri)
+	default:
+		err = ErrReference
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enveloped := false
+	var c14n *xmldom.Canonicalizer
+	for i, t := range transforms {
+		switch {
+		case t.GetAttribute("Algorithm") == EnvelopedSignature && root != nil && c14n == nil:
+			enveloped = true
+		case i == len(transforms)-1:
+			c14n, err = canonicalizer(t)
+			if err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, ErrUnsupportedAlgorithm
+		}
+	}
+
+	var b bytes.Buffer
+	if root == nil {
+		if c14n == nil {
+			return nil, data, nil
+		}
+		external, err := xmldom.ParseXMLWithOptions(bytes.NewReader(data), &xmldom.ParseOptions{Entities: xmldom.EntityKeep})
+		if err != nil {
+			return nil, nil, err
+		}
+		err = c14n.Canonicalize(&b, external)
+		return nil, b.Bytes(), err
+	}
+	if c14n == nil {
+		c14n = &xmldom.Canonicalizer{Method: xmldom.C14N10}
+	}
+	var exclude *xmldom.Node
+	if enveloped {
+		exclude = signature
+	}
+	err = c14n.CanonicalizeSubset(&b, nodeSet(root, exclude))
+	return root, b.Bytes(), err
+}
+
+// nodeSet returns the nodes of the subtree of root, without the comments and
+// the subtree of exclude, as same-document references select them.
+func nodeSet(root, exclude *xmldom.Node) []*xmldom.Node {
+	var res []*xmldom.Node
+	var walk func(n *xmldom.Node)
+	walk = func(n *xmldom.Node) {
+		if n == exclude || n.NodeType() == xmldom.CommentNode {
+			return
+		}
+		res = append(res, n)
+		if n.NodeType() == xmldom.ElementNode {
+			attrs := n.Attributes()
+			for i := 0; i < attrs.Length(); i++ {
+				res = append(res, attrs.Item(i))
+			}
+		}
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			walk(c)
+		}
+	}
+	walk(root)
+	return res
+}
+
+// canonicalizer returns the canonicalizer for a CanonicalizationMethod or
+// Transform element.
+func canonicalizer(method *xmldom.Node) (*xmldom.Canonicalizer, error) {
+	c, e := xmldom.NewCanonicalizer(method.GetAttribute("Algorithm"))
+	if e != nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if c.Method == xmldom.ExclusiveC14N {
+		for n := method.FirstChild(); n != nil; n = n.NextSibling() {
+			if n.NamespaceURI() == ExclusiveC14NNamespace && n.LocalName() == "InclusiveNamespaces" {
+				c.InclusiveNamespaces = strings.Fields(n.GetAttribute("PrefixList"))
+			}
+		}
+	}
+	return c, nil
+}
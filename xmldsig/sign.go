@@ -0,0 +1,293 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/mildred/xml-dom"
+)
+
+// Signer creates signatures.
+type Signer struct {
+	// Key is an *rsa.PrivateKey, an *ecdsa.PrivateKey or the []byte secret
+	// of HMAC.
+	Key interface{}
+	// SignatureMethod defaults to the SHA-256 method for the key.
+	SignatureMethod string
+	// DigestMethod defaults to SHA256.
+	DigestMethod string
+	// Canonicalizer canonicalizes the signed info and the data from the
+	// document. It defaults to exclusive canonicalization without comments.
+	Canonicalizer *xmldom.Canonicalizer
+	// Prefix is the prefix of the signature elements, "ds" if empty.
+	Prefix string
+	// KeyName and Certificates are written in the KeyInfo element of the
+	// signatures, to tell verifiers which key to use.
+	KeyName      string
+	Certificates []*x509.Certificate
+}
+
+var defaultSignatureMethods = map[keyKind]string{
+	rsaKey:   RSASHA256,
+	ecdsaKey: ECDSASHA256,
+	hmacKey:  HMACSHA256,
+}
+
+// Sign creates a signature of the references, appended to parent. The
+// references to the document are resolved in the document of parent.
+func (s *Signer) Sign(parent *xmldom.Node, refs ...Reference) (*xmldom.Node, error) {
+	signature, err := s.newSignature(parent.OwnerDocument())
+	if err != nil {
+		return nil, err
+	}
+	if _, e := parent.AppendChild(signature); e != nil {
+		return nil, e
+	}
+	if err := s.sign(signature, refs); err != nil {
+		parent.RemoveChild(signature)
+		return nil, err
+	}
+	return signature, nil
+}
+
+// SignEnveloped signs an element with a signature appended to it. The element
+// is referred to by its ID, or by the whole document if it is the document
+// element without an ID.
+func (s *Signer) SignEnveloped(e *xmldom.Node) (*xmldom.Node, error) {
+	uri := ""
+	if id := elementID(e); id != "" {
+		uri = "#" + id
+	} else if e.OwnerDocument().DocumentElement() != e {
+		return nil, errors.New("xmldsig: the signed element has no ID")
+	}
+	return s.Sign(e, Reference{URI: uri, Enveloped: true})
+}
+
+// SignEnveloping returns a new document made of a signature of a copy of
+// content, which it contains in an Object element with the ID.
+func (s *Signer) SignEnveloping(content *xmldom.Node, id string) (*xmldom.Node, error) {
+	doc := xmldom.NewDocument()
+	signature, err := s.newSignature(doc)
+	if err != nil {
+		return nil, err
+	}
+	doc.AppendChild(signature)
+	b := &builder{doc: doc, prefix: s.prefix()}
+	object := b.element(signature, "Object")
+	b.attribute(object, "Id", id)
+	clone := content.CloneNode(true)
+	if b.err == nil {
+		b.err = doc.ImportNode(clone)
+	}
+	if b.err == nil {
+		_, b.err = object.AppendChild(clone)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := s.sign(signature, []Reference{{URI: "#" + id}}); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *Signer) prefix() string {
+	if s.Prefix == "" {
+		return "ds"
+	}
+	return s.Prefix
+}
+
+func (s *Signer) canonicalizer() *xmldom.Canonicalizer {
+	if s.Canonicalizer == nil {
+		return &xmldom.Canonicalizer{Method: xmldom.ExclusiveC14N}
+	}
+	return s.Canonicalizer
+}
+
+// method returns the signature method, checking that it suits the key.
+func (s *Signer) method() (string, signatureMethod, error) {
+	kind, ok := kindOf(s.Key)
+	if !ok {
+		return "", signatureMethod{}, ErrKeyType
+	}
+	name := s.SignatureMethod
+	if name == "" {
+		name = defaultSignatureMethods[kind]
+	}
+	m, ok := signatureMethods[name]
+	if !ok {
+		return "", signatureMethod{}, ErrUnsupportedAlgorithm
+	}
+	if m.kind != kind {
+		return "", signatureMethod{}, ErrKeyType
+	}
+	return name, m, nil
+}
+
+// newSignature creates a Signature element with its SignedInfo, without
+// references, and its KeyInfo.
+func (s *Signer) newSignature(doc *xmldom.Node) (*xmldom.Node, error) {
+	name, _, err := s.method()
+	if err != nil {
+		return nil, err
+	}
+	b := &builder{doc: doc, prefix: s.prefix()}
+	signature := b.element(nil, "Signature")
+	if b.err == nil {
+		b.err = signature.SetAttributeNS(xmldom.XMLNSNamespace, "xmlns:"+b.prefix, Namespace)
+	}
+	signedInfo := b.element(signature, "SignedInfo")
+	b.canonicalizationMethod(b.element(signedInfo, "CanonicalizationMethod"), s.canonicalizer())
+	b.attribute(b.element(signedInfo, "SignatureMethod"), "Algorithm", name)
+	b.element(signature, "SignatureValue")
+	if s.KeyName != "" || len(s.Certificates) > 0 {
+		keyInfo := b.element(signature, "KeyInfo")
+		if s.KeyName != "" {
+			b.text(b.element(keyInfo, "KeyName"), s.KeyName)
+		}
+		if len(s.Certificates) > 0 {
+			data := b.element(keyInfo, "X509Data")
+			for _, cert := range s.Certificates {
+				b.text(b.element(data, "X509Certificate"), base64.StdEncoding.EncodeToString(cert.Raw))
+			}
+		}
+	}
+	return signature, b.err
+}
+
+// sign adds the references to the signature in the tree and computes its
+// value.
+func (s *Signer) sign(signature *xmldom.Node, refs []Reference) error {
+	digestMethod := s.DigestMethod
+	if digestMethod == "" {
+		digestMethod = SHA256
+	}
+	b := &builder{doc: signature.OwnerDocument(), prefix: s.prefix()}
+	signedInfo := child(signature, "SignedInfo")
+	for _, r := range refs {
+		ref := b.element(signedInfo, "Reference")
+		b.attribute(ref, "URI", r.URI)
+		if r.URI == "" || strings.HasPrefix(r.URI, "#") {
+			transforms := b.element(ref, "Transforms")
+			if r.Enveloped {
+				b.attribute(b.element(transforms, "Transform"), "Algorithm", EnvelopedSignature)
+			}
+			b.canonicalizationMethod(b.element(transforms, "Transform"), s.canonicalizer())
+		}
+		b.attribute(b.element(ref, "DigestMethod"), "Algorithm", digestMethod)
+		digestValue := b.element(ref, "DigestValue")
+		if b.err != nil {
+			return b.err
+		}
+		data := r.Data
+		_, digest, err := digestReference(signature, ref, func(string) ([]byte, error) { return data, nil })
+		if err != nil {
+			return err
+		}
+		b.text(digestValue, base64.StdEncoding.EncodeToString(digest))
+	}
+	if b.err != nil {
+		return b.err
+	}
+
+	var info bytes.Buffer
+	if err := s.canonicalizer().Canonicalize(&info, signedInfo); err != nil {
+		return err
+	}
+	value, err := s.signatureValue(info.Bytes())
+	if err != nil {
+		return err
+	}
+	b.text(child(signature, "SignatureValue"), base64.StdEncoding.EncodeToString(value))
+	return b.err
+}
+
+// signatureValue signs the canonical signed info.
+func (s *Signer) signatureValue(data []byte) ([]byte, error) {
+	_, m, err := s.method()
+	if err != nil {
+		return nil, err
+	}
+	h := m.hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch key := s.Key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, key, m.hash, digest)
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		res := make([]byte, 2*size)
+		r.FillBytes(res[:size])
+		ss.FillBytes(res[size:])
+		return res, nil
+	case []byte:
+		mac := hmac.New(m.hash.New, key)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	}
+	return nil, ErrKeyType
+}
+
+// builder creates the elements of a signature, keeping the first error.
+type builder struct {
+	doc    *xmldom.Node
+	prefix string
+	err    error
+}
+
+// element creates an element of the signature namespace, appended to parent
+// if it is not nil.
+func (b *builder) element(parent *xmldom.Node, localName string) *xmldom.Node {
+	if b.err != nil {
+		return nil
+	}
+	var e *xmldom.Node
+	e, b.err = b.doc.CreateElementNS(Namespace, b.prefix+":"+localName)
+	if b.err == nil && parent != nil {
+		_, b.err = parent.AppendChild(e)
+	}
+	return e
+}
+
+func (b *builder) attribute(e *xmldom.Node, name, value string) {
+	if b.err == nil {
+		b.err = e.SetAttribute(name, value)
+	}
+}
+
+func (b *builder) text(e *xmldom.Node, text string) {
+	if b.err == nil {
+		_, b.err = e.AppendChild(b.doc.CreateTextNode(text))
+	}
+}
+
+// canonicalizationMethod sets the algorithm of a CanonicalizationMethod or
+// Transform element, with the inclusive namespaces of exclusive
+// canonicalization.
+func (b *builder) canonicalizationMethod(e *xmldom.Node, c *xmldom.Canonicalizer) {
+	b.attribute(e, "Algorithm", c.Algorithm())
+	if c.Method != xmldom.ExclusiveC14N || len(c.InclusiveNamespaces) == 0 || b.err != nil {
+		return
+	}
+	var inclusive *xmldom.Node
+	inclusive, b.err = b.doc.CreateElementNS(ExclusiveC14NNamespace, "ec:InclusiveNamespaces")
+	if b.err == nil {
+		b.err = inclusive.SetAttributeNS(xmldom.XMLNSNamespace, "xmlns:ec", ExclusiveC14NNamespace)
+	}
+	b.attribute(inclusive, "PrefixList", strings.Join(c.InclusiveNamespaces, " "))
+	if b.err == nil {
+		_, b.err = e.AppendChild(inclusive)
+	}
+}
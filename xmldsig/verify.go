@@ -0,0 +1,156 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/mildred/xml-dom"
+)
+
+// Verifier checks signatures.
+type Verifier struct {
+	// Key is an *rsa.PublicKey, an *ecdsa.PublicKey or the []byte secret
+	// of HMAC. The key is never taken from the signature itself.
+	Key interface{}
+	// Resolve returns the data of the references to URIs outside the
+	// document. If nil, these references fail.
+	Resolve func(uri string) ([]byte, error)
+}
+
+// Verify checks the value of a Signature element and the digests of its
+// references. It returns the nodes of the document the references refer to,
+// the document itself for URI="", in the order of the references. Only the
+// content of these nodes is signed, so they are the ones to process rather
+// than looking up the signed data again.
+func (v *Verifier) Verify(signature *xmldom.Node) ([]*xmldom.Node, error) {
+	signedInfo := child(signature, "SignedInfo")
+	if signedInfo == nil || child(signature, "SignatureValue") == nil {
+		return nil, ErrMalformed
+	}
+	cm := child(signedInfo, "CanonicalizationMethod")
+	sm := child(signedInfo, "SignatureMethod")
+	refs := children(signedInfo, "Reference")
+	if cm == nil || sm == nil || len(refs) == 0 {
+		return nil, ErrMalformed
+	}
+	c14n, err := canonicalizer(cm)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := signatureMethods[sm.GetAttribute("Algorithm")]
+	if !ok || child(sm, "HMACOutputLength") != nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if kind, ok := kindOf(v.Key); !ok || kind != m.kind {
+		return nil, ErrKeyType
+	}
+
+	var info bytes.Buffer
+	if err := c14n.Canonicalize(&info, signedInfo); err != nil {
+		return nil, err
+	}
+	value, err := base64.StdEncoding.DecodeString(base64Text(child(signature, "SignatureValue")))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !v.checkValue(m, info.Bytes(), value) {
+		return nil, ErrInvalidSignature
+	}
+
+	var res []*xmldom.Node
+	for _, ref := range refs {
+		node, digest, err := digestReference(signature, ref, v.Resolve)
+		if err != nil {
+			return nil, err
+		}
+		dv := child(ref, "DigestValue")
+		if dv == nil {
+			return nil, ErrMalformed
+		}
+		expected, err := base64.StdEncoding.DecodeString(base64Text(dv))
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		if !hmac.Equal(digest, expected) {
+			return nil, ErrDigestMismatch
+		}
+		if node != nil {
+			res = append(res, node)
+		}
+	}
+	return res, nil
+}
+
+// checkValue checks the signature value of the canonical signed info.
+func (v *Verifier) checkValue(m signatureMethod, data, value []byte) bool {
+	h := m.hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch key := v.Key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.VerifyPKCS1v15(&key.PublicKey, m.hash, digest, value) == nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, m.hash, digest, value) == nil
+	case *ecdsa.PrivateKey:
+		return verifyECDSA(&key.PublicKey, digest, value)
+	case *ecdsa.PublicKey:
+		return verifyECDSA(key, digest, value)
+	case []byte:
+		mac := hmac.New(m.hash.New, key)
+		mac.Write(data)
+		return hmac.Equal(mac.Sum(nil), value)
+	}
+	return false
+}
+
+// verifyECDSA checks a signature value made of the r and s integers of the
+// same size.
+func verifyECDSA(key *ecdsa.PublicKey, digest, value []byte) bool {
+	if len(value) == 0 || len(value)%2 != 0 {
+		return false
+	}
+	size := len(value) / 2
+	r := new(big.Int).SetBytes(value[:size])
+	s := new(big.Int).SetBytes(value[size:])
+	return ecdsa.Verify(key, digest, r, s)
+}
+
+// KeyName returns the name of the key in the KeyInfo of a signature, or an
+// empty string.
+func KeyName(signature *xmldom.Node) string {
+	if keyInfo := child(signature, "KeyInfo"); keyInfo != nil {
+		if name := child(keyInfo, "KeyName"); name != nil {
+			return name.AsText()
+		}
+	}
+	return ""
+}
+
+// Certificates returns the X.509 certificates in the KeyInfo of a signature.
+// They are not verified: whether they are trusted is up to the caller.
+func Certificates(signature *xmldom.Node) ([]*x509.Certificate, error) {
+	keyInfo := child(signature, "KeyInfo")
+	if keyInfo == nil {
+		return nil, nil
+	}
+	var res []*x509.Certificate
+	for _, data := range children(keyInfo, "X509Data") {
+		for _, c := range children(data, "X509Certificate") {
+			der, err := base64.StdEncoding.DecodeString(base64Text(c))
+			if err != nil {
+				return nil, ErrMalformed
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, cert)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,217 @@
+// Package xmldsig creates and verifies XML signatures over xmldom trees, as
+// defined by the XML Signature Syntax and Processing recommendation.
+//
+// Signatures can be enveloped in the element they sign, envelop the data they
+// sign in an Object element, or be detached from it. References are resolved
+// within the document of the signature, by ID for URI="#id" or to the whole
+// document for URI="", or with a resolver for other URIs. Signatures use RSA,
+// ECDSA or HMAC with the hash functions of the standard library.
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"strings"
+
+	"github.com/mildred/xml-dom"
+)
+
+// Namespace is the namespace of the elements of XML signatures.
+const Namespace = "http://www.w3.org/2000/09/xmldsig#"
+
+// ExclusiveC14NNamespace is the namespace of the InclusiveNamespaces element
+// parameterizing exclusive canonicalization.
+const ExclusiveC14NNamespace = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+// Digest methods.
+const (
+	SHA1   = Namespace + "sha1"
+	SHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	SHA384 = "http://www.w3.org/2001/04/xmldsig-more#sha384"
+	SHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+// Signature methods.
+const (
+	RSASHA1     = Namespace + "rsa-sha1"
+	RSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	RSASHA384   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384"
+	RSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	ECDSASHA1   = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha1"
+	ECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	ECDSASHA384 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	ECDSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+	HMACSHA1    = Namespace + "hmac-sha1"
+	HMACSHA256  = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha256"
+	HMACSHA384  = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha384"
+	HMACSHA512  = "http://www.w3.org/2001/04/xmldsig-more#hmac-sha512"
+)
+
+// EnvelopedSignature is the transform removing the signature from the data
+// it signs.
+const EnvelopedSignature = Namespace + "enveloped-signature"
+
+var (
+	// ErrUnsupportedAlgorithm is returned for the algorithms this package
+	// does not implement.
+	ErrUnsupportedAlgorithm = errors.New("xmldsig: unsupported algorithm")
+	// ErrKeyType is returned when the key does not suit the signature
+	// method.
+	ErrKeyType = errors.New("xmldsig: key type does not match the signature method")
+	// ErrMalformed is returned for signatures missing required elements.
+	ErrMalformed = errors.New("xmldsig: malformed signature")
+	// ErrReference is returned when a reference cannot be resolved.
+	ErrReference = errors.New("xmldsig: unresolved reference")
+	// ErrDigestMismatch is returned when the digest of a reference does
+	// not match the data it refers to.
+	ErrDigestMismatch = errors.New("xmldsig: digest mismatch")
+	// ErrInvalidSignature is returned when the signature value does not
+	// match the signed info.
+	ErrInvalidSignature = errors.New("xmldsig: invalid signature value")
+)
+
+var digestMethods = map[string]crypto.Hash{
+	SHA1:   crypto.SHA1,
+	SHA256: crypto.SHA256,
+	SHA384: crypto.SHA384,
+	SHA512: crypto.SHA512,
+}
+
+// keyKind is the family of a signature method, which determines its key type.
+type keyKind uint
+
+const (
+	rsaKey keyKind = iota
+	ecdsaKey
+	hmacKey
+)
+
+type signatureMethod struct {
+	kind keyKind
+	hash crypto.Hash
+}
+
+var signatureMethods = map[string]signatureMethod{
+	RSASHA1:     {rsaKey, crypto.SHA1},
+	RSASHA256:   {rsaKey, crypto.SHA256},
+	RSASHA384:   {rsaKey, crypto.SHA384},
+	RSASHA512:   {rsaKey, crypto.SHA512},
+	ECDSASHA1:   {ecdsaKey, crypto.SHA1},
+	ECDSASHA256: {ecdsaKey, crypto.SHA256},
+	ECDSASHA384: {ecdsaKey, crypto.SHA384},
+	ECDSASHA512: {ecdsaKey, crypto.SHA512},
+	HMACSHA1:    {hmacKey, crypto.SHA1},
+	HMACSHA256:  {hmacKey, crypto.SHA256},
+	HMACSHA384:  {hmacKey, crypto.SHA384},
+	HMACSHA512:  {hmacKey, crypto.SHA512},
+}
+
+// kindOf returns the family of signature methods a private or public key is
+// used with.
+func kindOf(key interface{}) (keyKind, bool) {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return rsaKey, true
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return ecdsaKey, true
+	case []byte:
+		return hmacKey, true
+	}
+	return 0, false
+}
+
+// child returns the first child element of n in the signature namespace with
+// the local name, or nil.
+func child(n *xmldom.Node, localName string) *xmldom.Node {
+	if res := children(n, localName); len(res) > 0 {
+		return res[0]
+	}
+	return nil
+}
+
+// children returns the child elements of n in the signature namespace with
+// the local name.
+func children(n *xmldom.Node, localName string) []*xmldom.Node {
+	var res []*xmldom.Node
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.NodeType() == xmldom.ElementNode && c.NamespaceURI() == Namespace && c.LocalName() == localName {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// base64Text returns the text of an element holding base64 data, without the
+// whitespace that may wrap it.
+func base64Text(n *xmldom.Node) string {
+	return strings.Join(strings.Fields(n.AsText()), "")
+}
+
+// idAttributes are the names of the attributes used as IDs by the
+// vocabularies using signatures, without declaring them in a DTD.
+var idAttributes = []string{"Id", "ID", "id"}
+
+// elementByID returns the only element of the document with the ID. IDs
+// are the ones of the document and the attributes in idAttributes. It fails
+// if several elements have the ID, as a signed element could then be
+// substituted.
+func elementByID(doc *xmldom.Node, id string) (*xmldom.Node, error) {
+	var found []*xmldom.Node
+	var walk func(n *xmldom.Node)
+	walk = func(n *xmldom.Node) {
+		if n.NodeType() == xmldom.ElementNode && hasID(n, id) {
+			found = append(found, n)
+		}
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			walk(c)
+		}
+	}
+	walk(doc)
+	switch len(found) {
+	case 0:
+		return nil, ErrReference
+	case 1:
+		return found[0], nil
+	}
+	return nil, errors.New("xmldsig: several elements with ID " + id)
+}
+
+func hasID(e *xmldom.Node, id string) bool {
+	attrs := e.Attributes()
+	for i := 0; i < attrs.Length(); i++ {
+		a := attrs.Item(i)
+		if a.NodeValue() != id {
+			continue
+		}
+		if a.IsId() {
+			return true
+		}
+		for _, name := range idAttributes {
+			if a.NodeName() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// elementID returns the ID of an element, or an empty string.
+func elementID(e *xmldom.Node) string {
+	attrs := e.Attributes()
+	for i := 0; i < attrs.Length(); i++ {
+		if a := attrs.Item(i); a.IsId() {
+			return a.NodeValue()
+		}
+	}
+	for _, name := range idAttributes {
+		if e.HasAttribute(name) {
+			return e.GetAttribute(name)
+		}
+	}
+	return ""
+}
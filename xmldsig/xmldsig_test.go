@@ -0,0 +1,219 @@
+package xmldsig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mildred/xml-dom"
+)
+
+const response = `<?xml version="1.0"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_r1">
+  <saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1">
+    <saml:Subject><!-- user --><saml:NameID>alice@example.org</saml:NameID></saml:Subject>
+    <saml:Attribute Name="role">admin &amp; user</saml:Attribute>
+  </saml:Assertion>
+</samlp:Response>
+`
+
+// testKeys returns the private and public keys of the families of signature
+// methods.
+func testKeys(t *testing.T) map[string][2]interface{} {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	return map[string][2]interface{}{
+		RSASHA256:   {rsaKey, &rsaKey.PublicKey},
+		RSASHA1:     {rsaKey, &rsaKey.PublicKey},
+		ECDSASHA256: {p256, &p256.PublicKey},
+		ECDSASHA384: {p384, &p384.PublicKey},
+		HMACSHA256:  {secret, secret},
+		HMACSHA512:  {secret, secret},
+	}
+}
+
+func parse(t *testing.T, src string) *xmldom.Node {
+	doc, err := xmldom.ParseXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// signature returns the only signature of the document.
+func signature(t *testing.T, doc *xmldom.Node) *xmldom.Node {
+	signatures := doc.GetElementsByTagNameNS(Namespace, "Signature")
+	if signatures.Length() != 1 {
+		t.Fatalf("found %d signatures", signatures.Length())
+	}
+	return signatures.Item(0)
+}
+
+func assertion(doc *xmldom.Node) *xmldom.Node {
+	return doc.GetElementsByTagNameNS("urn:oasis:names:tc:SAML:2.0:assertion", "Assertion").Item(0)
+}
+
+func TestSignEnveloped(t *testing.T) {
+	for method, keys := range testKeys(t) {
+		signer := &Signer{Key: keys[0], SignatureMethod: method, KeyName: "test"}
+		doc := parse(t, response)
+		if _, err := signer.SignEnveloped(assertion(doc)); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		// The signature is verified on the serialized document.
+		signed := parse(t, doc.XML())
+		verifier := &Verifier{Key: keys[1]}
+		nodes, err := verifier.Verify(signature(t, signed))
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", method, err, doc.XML())
+		}
+		if len(nodes) != 1 || nodes[0] != assertion(signed) {
+			t.Errorf("%s: verified %v, want the assertion", method, nodes)
+		}
+		if name := KeyName(signature(t, signed)); name != "test" {
+			t.Errorf("%s: key name %q", method, name)
+		}
+
+		// Comments are not signed.
+		assertion(signed).AppendChild(signed.CreateComment("added"))
+		if _, err := verifier.Verify(signature(t, signed)); err != nil {
+			t.Errorf("%s: comment: %v", method, err)
+		}
+
+		name := assertion(signed).GetElementsByTagNameNS("*", "NameID").Item(0)
+		name.FirstChild().SetNodeValue("mallory@example.org")
+		if _, err := verifier.Verify(signature(t, signed)); err != ErrDigestMismatch {
+			t.Errorf("%s: tampered data: got %v, want %v", method, err, ErrDigestMismatch)
+		}
+	}
+}
+
+func TestSignEnvelopedDocument(t *testing.T) {
+	keys := testKeys(t)[RSASHA256]
+	doc := parse(t, `<root><a>1</a></root>`)
+	signer := &Signer{Key: keys[0], Canonicalizer: &xmldom.Canonicalizer{Method: xmldom.C14N11, WithComments: true}}
+	if _, err := signer.SignEnveloped(doc.DocumentElement()); err != nil {
+		t.Fatal(err)
+	}
+	signed := parse(t, doc.XML())
+	nodes, err := (&Verifier{Key: keys[1]}).Verify(signature(t, signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != signed {
+		t.Errorf("verified %v, want the document", nodes)
+	}
+	if _, err := signer.SignEnveloped(doc.DocumentElement().FirstChild()); err == nil {
+		t.Error("signed an element without ID")
+	}
+}
+
+func TestSignEnveloping(t *testing.T) {
+	keys := testKeys(t)[ECDSASHA256]
+	signer := &Signer{Key: keys[0], Canonicalizer: &xmldom.Canonicalizer{Method: xmldom.ExclusiveC14N, InclusiveNamespaces: []string{"saml"}}}
+	doc, err := signer.SignEnveloping(assertion(parse(t, response)), "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := parse(t, doc.XML())
+	if signed.DocumentElement().LocalName() != "Signature" {
+		t.Fatalf("document element is %s", signed.DocumentElement().NodeName())
+	}
+	nodes, err := (&Verifier{Key: keys[1]}).Verify(signature(t, signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].LocalName() != "Object" || assertion(signed).ParentNode() != nodes[0] {
+		t.Errorf("verified %v, want the object", nodes)
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	keys := testKeys(t)[HMACSHA256]
+	doc := parse(t, `<root><data Id="d1">one</data><data Id="d2">two</data></root>`)
+	external := map[string][]byte{"http://example.org/data": []byte("external data")}
+	signer := &Signer{Key: keys[0], DigestMethod: SHA512}
+	_, err := signer.Sign(doc.DocumentElement(),
+		Reference{URI: "#d1"},
+		Reference{URI: "http://example.org/data", Data: external["http://example.org/data"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := parse(t, doc.XML())
+	verifier := &Verifier{Key: keys[1]}
+	if _, err := verifier.Verify(signature(t, signed)); err != ErrReference {
+		t.Errorf("verified without resolver: %v", err)
+	}
+	verifier.Resolve = func(uri string) ([]byte, error) {
+		if data, ok := external[uri]; ok {
+			return data, nil
+		}
+		return nil, errors.New("not found")
+	}
+	nodes, err := verifier.Verify(signature(t, signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].GetAttribute("Id") != "d1" {
+		t.Errorf("verified %v, want d1", nodes)
+	}
+
+	// The second element is not signed.
+	signed.DocumentElement().ChildNodes()[1].FirstChild().SetNodeValue("three")
+	if _, err := verifier.Verify(signature(t, signed)); err != nil {
+		t.Errorf("unsigned data changed: %v", err)
+	}
+	external["http://example.org/data"] = []byte("changed")
+	if _, err := verifier.Verify(signature(t, signed)); err != ErrDigestMismatch {
+		t.Errorf("external data changed: got %v, want %v", err, ErrDigestMismatch)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	keys := testKeys(t)
+	rsaKeys := keys[RSASHA256]
+	doc := parse(t, response)
+	if _, err := (&Signer{Key: rsaKeys[0]}).SignEnveloped(assertion(doc)); err != nil {
+		t.Fatal(err)
+	}
+	src := doc.XML()
+
+	if _, err := (&Verifier{Key: keys[ECDSASHA256][1]}).Verify(signature(t, parse(t, src))); err != ErrKeyType {
+		t.Errorf("wrong key type: got %v, want %v", err, ErrKeyType)
+	}
+	if _, err := (&Verifier{Key: keys[HMACSHA256][1]}).Verify(signature(t, parse(t, src))); err != ErrKeyType {
+		t.Errorf("HMAC key for RSA: got %v, want %v", err, ErrKeyType)
+	}
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := (&Verifier{Key: &other.PublicKey}).Verify(signature(t, parse(t, src))); err != ErrInvalidSignature {
+		t.Errorf("wrong key: got %v, want %v", err, ErrInvalidSignature)
+	}
+
+	// A copy of the signed assertion with another ID could be substituted.
+	wrapped := parse(t, src)
+	root := wrapped.DocumentElement()
+	root.InsertBefore(assertion(wrapped).CloneNode(true), root.FirstChild())
+	if _, err := (&Verifier{Key: rsaKeys[1]}).Verify(signature(t, assertion(wrapped).NextSibling().NextSibling())); err == nil {
+		t.Error("verified a document with a duplicate ID")
+	}
+
+	if _, err := (&Signer{Key: rsaKeys[0], SignatureMethod: HMACSHA256}).SignEnveloped(assertion(parse(t, response))); err != ErrKeyType {
+		t.Errorf("signed with RSA key and HMAC method: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package xpath
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mildred/xml-dom"
+)
+
+// TestCanonicalizeSubset canonicalizes the document subset of example 3.7 of
+// the Canonical XML recommendation. The namespace axis of the original
+// expression is not available and is left out.
+func TestCanonicalizeSubset(t *testing.T) {
+	src := `<!DOCTYPE doc [
+<!ATTLIST e2 xml:space (default|preserve) 'preserve'>
+<!ATTLIST e3 id ID #IMPLIED>
+]>
+<doc xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org">
+   <e1>
+      <e2 xmlns="">
+         <e3 id="E3"/>
+      </e2>
+   </e1>
+</doc>`
+	expr := MustCompileNS(`(//. | //@*)[self::ietf:e1 or (parent::ietf:e1 and not(self::text() or self::e2)) or count(id("E3")|ancestor-or-self::node()) = count(ancestor-or-self::node())]`,
+		map[string]string{"ietf": "http://www.ietf.org"})
+	tests := []struct {
+		c    xmldom.Canonicalizer
+		want string
+	}{
+		{xmldom.Canonicalizer{Method: xmldom.C14N10}, `<e1 xmlns="http://www.ietf.org" xmlns:w3c="http://www.w3.org"><e3 xmlns="" id="E3" xml:space="preserve"></e3></e1>`},
+		{xmldom.Canonicalizer{Method: xmldom.ExclusiveC14N}, `<e1 xmlns="http://www.ietf.org"><e3 xmlns="" id="E3"></e3></e1>`},
+	}
+	doc, err := xmldom.ParseXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := expr.EvaluateNode(doc).Nodes()
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := test.c.CanonicalizeSubset(&b, nodes); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.c.Algorithm(), b.String(), test.want)
+		}
+	}
+}
@@ -5,43 +5,289 @@ import (
 	"github.com/antchfx/xpath"
 	"github.com/mildred/xml-dom"
 	"github.com/mildred/xml-dom/node-navigator"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type Expr struct {
 	*xpath.Expr
+	namespaces map[string]string
+	// for an expression calling id(), the source around the calls and their
+	// arguments, compiled again with the result of the calls for every
+	// evaluation
+	texts []string
+	ids   []*Expr
 }
 
-func convert(e *xpath.Expr) *Expr {
-	if e == nil {
-		return nil
-	} else {
-		return &Expr{e}
+// compile compiles expr. The calls to id() are checked and replaced by an
+// empty node-set, the expression is compiled again with their result at
+// evaluation.
+func compile(expr string, namespaces map[string]string) (*Expr, error) {
+	if namespaces != nil {
+		expr = resolvePrefixes(expr, namespaces)
+	}
+	return compileResolved(expr, namespaces)
+}
+
+// compileResolved compiles expr, whose prefixes are already resolved.
+func compileResolved(expr string, namespaces map[string]string) (*Expr, error) {
+	texts, args, err := splitIds(expr)
+	if err != nil {
+		return nil, err
+	}
+	e, err := xpath.Compile(strings.Join(texts, "(/..)"))
+	if err != nil {
+		return nil, err
+	}
+	res := &Expr{Expr: e, namespaces: namespaces}
+	if len(args) == 0 {
+		return res, nil
+	}
+	res.texts = texts
+	for _, arg := range args {
+		id, err := compileResolved(arg, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		res.ids = append(res.ids, id)
 	}
+	return res, nil
 }
 
+func mustCompile(expr string, namespaces map[string]string) *Expr {
+	e, err := compile(expr, namespaces)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// CompileNS compiles an expression whose prefixes are bound to namespace URIs
+// by namespaces. Names in the expression then match nodes by namespace URI,
+// whatever prefix the document uses, and unprefixed names only match nodes
+// in no namespace.
 func CompileNS(expr string, namespaces map[string]string) (*Expr, error) {
-	// FIXME: handle namespaces
-	e, err := xpath.Compile(expr)
-	return convert(e), err
+	return compile(expr, copyNamespaces(namespaces))
 }
 
 func MustCompileNS(expr string, namespaces map[string]string) *Expr {
-	// FIXME: handle namespaces
-	return convert(xpath.MustCompile(expr))
+	return mustCompile(expr, copyNamespaces(namespaces))
+}
+
+// scan returns the end of the token of expr starting at i, and if it is a
+// name. String literals are single tokens.
+func scan(expr string, i int) (end int, name bool) {
+	switch c := expr[i]; {
+	case c == '"' || c == '\'':
+		if end := strings.IndexByte(expr[i+1:], c); end >= 0 {
+			return i + end + 2, false
+		}
+		return len(expr), false
+	case isNameStart(c):
+		end = i + 1
+		for end < len(expr) && isNameChar(expr[end]) {
+			end++
+		}
+		return end, true
+	default:
+		return i + 1, false
+	}
+}
+
+// resolvePrefixes replaces the prefixes of the names in expr by the prefix
+// the navigator reports for their namespace URI, so that all the prefixes
+// bound to a URI match its nodes.
+func resolvePrefixes(expr string, namespaces map[string]string) string {
+	prefixes := node_navigator.NamespacePrefixes(namespaces)
+	var b strings.Builder
+	for i := 0; i < len(expr); {
+		j, name := scan(expr, i)
+		tok := expr[i:j]
+		// a prefix is followed by a single colon, an axis by two
+		qualified := j+1 < len(expr) && expr[j] == ':' && expr[j+1] != ':'
+		if uri, ok := namespaces[tok]; ok && name && qualified && (i == 0 || expr[i-1] != '$') {
+			tok = prefixes[uri]
+		}
+		b.WriteString(tok)
+		i = j
+	}
+	return b.String()
+}
+
+// splitIds splits expr at the calls to the id() function. It returns the
+// source around the calls, one more than the calls, and their arguments.
+// Arguments in predicates must not depend on the context node.
+func splitIds(expr string) (texts, args []string, err error) {
+	var b strings.Builder
+	predicates := 0
+	for i := 0; i < len(expr); {
+		j, name := scan(expr, i)
+		switch expr[i:j] {
+		case "[":
+			predicates++
+		case "]":
+			predicates--
+		}
+		call := strings.TrimLeft(expr[j:], xmlWhitespace)
+		if !name || expr[i:j] != "id" || !strings.HasPrefix(call, "(") || (i > 0 && strings.ContainsRune(":$@", rune(expr[i-1]))) {
+			b.WriteString(expr[i:j])
+			i = j
+			continue
+		}
+		start := len(expr) - len(call) + 1
+		end, err := argumentEnd(expr, start)
+		if err != nil {
+			return nil, nil, err
+		}
+		arg := strings.Trim(expr[start:end], xmlWhitespace)
+		if arg == "" {
+			return nil, nil, fmt.Errorf("xpath: id() takes one argument in %s", expr)
+		}
+		if predicates > 0 && arg[0] != '/' && arg[0] != '"' && arg[0] != '\'' {
+			return nil, nil, fmt.Errorf("xpath: the argument of id() in a predicate must be a string literal or an absolute path in %s", expr)
+		}
+		texts = append(texts, b.String())
+		args = append(args, arg)
+		b.Reset()
+		i = end + 1
+	}
+	return append(texts, b.String()), args, nil
+}
+
+// argumentEnd returns the position of the parenthesis closing the single
+// argument of a function call starting at start in expr.
+func argumentEnd(expr string, start int) (int, error) {
+	depth := 0
+	for i := start; i < len(expr); {
+		j, _ := scan(expr, i)
+		switch expr[i:j] {
+		case "(", "[":
+			depth++
+		case "]":
+			depth--
+		case ")":
+			if depth == 0 {
+				return i, nil
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				return 0, fmt.Errorf("xpath: id() takes one argument in %s", expr)
+			}
+		}
+		i = j
+	}
+	return 0, fmt.Errorf("xpath: unclosed call to id() in %s", expr)
+}
+
+const xmlWhitespace = " \t\r\n"
+
+// elementsPath returns an expression selecting the elements, in document
+// order, by their position among the elements of their parent.
+func elementsPath(elements []*xmldom.Node) string {
+	var paths []string
+	for _, e := range elements {
+		var steps []string
+		for ; e != nil && e.NodeType() == xmldom.ElementNode; e = e.ParentNode() {
+			pos := 1
+			for s := e.PreviousSibling(); s != nil; s = s.PreviousSibling() {
+				if s.NodeType() == xmldom.ElementNode {
+					pos++
+				}
+			}
+			steps = append([]string{fmt.Sprintf("/*[%d]", pos)}, steps...)
+		}
+		// elements in entity references cannot be reached by the engine
+		if e != nil && e.NodeType() == xmldom.DocumentNode {
+			paths = append(paths, strings.Join(steps, ""))
+		}
+	}
+	if len(paths) == 0 {
+		return "(/..)"
+	}
+	return "(" + strings.Join(paths, " | ") + ")"
+}
+
+// expr returns the compiled expression to evaluate from n, where the calls to
+// id() are replaced by the elements they select.
+func (e *Expr) expr(n *xmldom.Node) *xpath.Expr {
+	if len(e.ids) == 0 {
+		return e.Expr
+	}
+	var b strings.Builder
+	for i, id := range e.ids {
+		b.WriteString(e.texts[i])
+		b.WriteString(elementsPath(ID(n, id.idList(n))))
+	}
+	b.WriteString(e.texts[len(e.ids)])
+	res, err := xpath.Compile(b.String())
+	if err != nil {
+		// it compiled with empty node-sets instead of the elements
+		panic(fmt.Sprintf("xpath: cannot compile %s: %v", b.String(), err))
+	}
+	return res
+}
+
+// idList returns the IDs selected by the argument e of id() evaluated from
+// n: the string-values of the nodes of a node-set, or the value converted to
+// a string.
+func (e *Expr) idList(n *xmldom.Node) string {
+	switch res := e.expr(n).Evaluate(e.navigator(n)).(type) {
+	case *xpath.NodeIterator:
+		var ids []string
+		for res.MoveNext() {
+			ids = append(ids, res.Current().Value())
+		}
+		return strings.Join(ids, " ")
+	case string:
+		return res
+	case float64:
+		return strconv.FormatFloat(res, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(res)
+	}
+	return ""
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c == '-' || c == '.' || c >= '0' && c <= '9'
+}
+
+func copyNamespaces(namespaces map[string]string) map[string]string {
+	res := map[string]string{}
+	for prefix, uri := range namespaces {
+		res[prefix] = uri
+	}
+	return res
 }
 
+// Compile compiles an expression. The id() function selects elements with
+// the ID index of the document, see xmldom.Node.GetElementById. Its argument
+// is evaluated from the node the expression is evaluated from, and must be a
+// string literal or an absolute path in predicates.
 func Compile(expr string) (*Expr, error) {
-	e, err := xpath.Compile(expr)
-	return convert(e), err
+	return compile(expr, nil)
 }
 
 func MustCompile(expr string) *Expr {
-	return convert(xpath.MustCompile(expr))
+	return mustCompile(expr, nil)
+}
+
+func (e *Expr) navigator(n *xmldom.Node) *node_navigator.NodeNavigator {
+	if e.namespaces == nil {
+		return node_navigator.NewNodeNavigator(n)
+	}
+	return node_navigator.NewNodeNavigatorNS(n, e.namespaces)
 }
 
 // Return *Iterator,bool,float64,string
 func (e *Expr) Evaluate(n *xmldom.Node) interface{} {
-	res := e.Expr.Evaluate(node_navigator.NewNodeNavigator(n))
+	res := e.expr(n).Evaluate(e.navigator(n))
 	switch res.(type) {
 	case *xpath.NodeIterator:
 		i := res.(*xpath.NodeIterator)
@@ -54,7 +300,7 @@ func (e *Expr) Evaluate(n *xmldom.Node) interface{} {
 // Evaluate that return always an iterator (empty in case the result is not a
 // node)
 func (e *Expr) EvaluateNode(n *xmldom.Node) *Iterator {
-	return &Iterator{e.Expr.Evaluate(node_navigator.NewNodeNavigator(n)).(*xpath.NodeIterator)}
+	return &Iterator{e.expr(n).Evaluate(e.navigator(n)).(*xpath.NodeIterator)}
 }
 
 func (e *Expr) Exists(n *xmldom.Node) bool {
@@ -71,6 +317,26 @@ func Exists(res interface{}) bool {
 	}
 }
 
+// ID returns the elements of the document of n having one of the IDs in the
+// whitespace separated list ids, in document order, as the id() function of
+// the expressions does. It uses the ID index of the document, see
+// xmldom.Node.GetElementById.
+func ID(n *xmldom.Node, ids string) []*xmldom.Node {
+	var res []*xmldom.Node
+	seen := map[*xmldom.Node]bool{}
+	doc := n.OwnerDocument()
+	for _, id := range strings.Fields(ids) {
+		if e := doc.GetElementById(id); e != nil && !seen[e] {
+			seen[e] = true
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CompareDocumentPosition(res[j])&xmldom.DocumentPositionFollowing != 0
+	})
+	return res
+}
+
 // Iterator for nodes, initialized before the first element. Call MoveNext() to
 // get started. When MoveNext() returns false, it means we are past the end and
 // there is no current element.
@@ -108,8 +374,17 @@ func (i *Iterator) Current() *xmldom.Node {
 	} else if nn, ok := res.(*node_navigator.NodeNavigator); ok {
 		return nn.Current()
 	} else {
-		panic("Could not convert NodeNavigator")
+		return nil
+	}
+}
+
+// SourceRange returns the location in the source text of the current node,
+// see xmldom.Node.SourceRange.
+func (i *Iterator) SourceRange() (xmldom.SourceRange, bool) {
+	if n := i.Current(); n != nil {
+		return n.SourceRange()
 	}
+	return xmldom.SourceRange{}, false
 }
 
 func (i *Iterator) MoveNext() bool {
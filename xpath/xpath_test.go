@@ -0,0 +1,114 @@
+package xpath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mildred/xml-dom"
+)
+
+func names(nodes []*xmldom.Node) string {
+	var res []string
+	for _, n := range nodes {
+		res = append(res, n.NodeName()+"="+n.AsText())
+	}
+	return strings.Join(res, " ")
+}
+
+func TestCompileNS(t *testing.T) {
+	src := `<r xmlns:p="urn:u" xmlns:q="urn:v"><p:x p:y="1">a</p:x><x xmlns="urn:u">b</x><q:x>c</q:x><x>d</x></r>`
+	doc, err := xmldom.ParseXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := map[string]string{"a": "urn:u", "b": "urn:u", "v": "urn:v"}
+	tests := []struct {
+		expr       string
+		namespaces map[string]string
+		want       string
+	}{
+		{`//a:x`, same, "p:x=a x=b"},
+		{`//b:x`, same, "p:x=a x=b"},
+		{`//v:x`, same, "q:x=c"},
+		{`//x`, same, "x=d"},
+		{`//b:x[@a:y='1']`, same, "p:x=a"},
+		{`//a:x[@b:y]`, same, "p:x=a"},
+		{`//*[self::b:x and . = 'b:x']`, same, ""},
+		{`/descendant::b:x`, same, "p:x=a x=b"},
+		{`//p:x`, map[string]string{"p": "urn:v"}, "q:x=c"},
+		{`//p:x`, nil, "p:x=a"},
+	}
+	for _, test := range tests {
+		var expr *Expr
+		if test.namespaces == nil {
+			expr, err = Compile(test.expr)
+		} else {
+			expr, err = CompileNS(test.expr, test.namespaces)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := names(expr.EvaluateNode(doc).Nodes()); got != test.want {
+			t.Errorf("%s with %v: got %q, want %q", test.expr, test.namespaces, got, test.want)
+		}
+	}
+}
+
+func TestID(t *testing.T) {
+	src := `<!DOCTYPE r [<!ATTLIST e id ID #IMPLIED>]>
+<r><e id="b"><c>1</c></e><f xml:id="a" t="id('b')"><c>2</c><c>3</c></f><e id="x"/><g ref="x a"/></r>`
+	doc, err := xmldom.ParseXML(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr, want string
+	}{
+		{`id('a')`, "f=23"},
+		{`id("b a")`, "e=1 f=23"},
+		{`id('a b a')`, "e=1 f=23"},
+		{`id('a')/c`, "c=2 c=3"},
+		{`id( 'a' )/c[2]`, "c=3"},
+		{`id('a')[1]`, "f=23"},
+		{`id('b') | id('a')/c`, "e=1 c=2 c=3"},
+		{`//e[count(id('a')/c) = 2]/c`, "c=1"},
+		{`//*[@t = "id('b')"]`, "f=23"},
+		{`id('unknown')`, ""},
+		{`id('')/c`, ""},
+		{`id(//g/@ref)`, "f=23 e="},
+		{`id(//@id)/c`, "c=1"},
+		{`id(//c)`, ""},
+		{`id(concat('a', ' ', "b"))`, "e=1 f=23"},
+		{`id(id('x')/following-sibling::g/@ref)/c[1]`, "c=2"},
+		{`//c[count(id(//g/@ref)) = 2]`, "c=1 c=2 c=3"},
+	}
+	for _, test := range tests {
+		expr, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := names(expr.EvaluateNode(doc).Nodes()); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.expr, got, test.want)
+		}
+	}
+	g := doc.DocumentElement().LastChild()
+	if got := names(MustCompile(`id(@ref)/c`).EvaluateNode(g).Nodes()); got != "c=2 c=3" {
+		t.Errorf("id(@ref)/c from <g>: got %q", got)
+	}
+	for _, expr := range []string{`id()`, `id('a', 'b')`, `id('a'`, `//e[id(@t)]`, `id(//e[id(.)])`} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("%s compiled", expr)
+		}
+	}
+
+	expr := MustCompile(`count(id('a b x'))`)
+	if got := expr.Evaluate(doc); got != float64(3) {
+		t.Errorf("count: got %v", got)
+	}
+	doc.GetElementById("x").SetAttribute("id", "y")
+	if got := expr.Evaluate(doc); got != float64(2) {
+		t.Errorf("count after changing an ID: got %v", got)
+	}
+}